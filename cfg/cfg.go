@@ -1,28 +1,197 @@
 package cfg
 
 import (
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"iter"
 	"log/slog"
 	"net"
+	"net/netip"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 // Duration is a wrapper around time.Duration that supports unmarshalling from a JSON string.
 type Duration time.Duration
 
+// globMeta is a set of special characters of glob patterns.
+const globMeta = "*?["
+
 const (
 	// minPeriod is a minimal period value of subscriptions' group refresh.
 	minPeriod = Duration(time.Second)
 	// minTimeout is a minimal timeout value of subscription refresh.
 	minTimeout = Duration(10 * time.Millisecond)
+	// defaultBaseDelay is a default base delay between retry attempts.
+	defaultBaseDelay = Duration(20 * time.Millisecond)
+	// defaultMaxDelay is a default maximum delay between retry attempts.
+	defaultMaxDelay = Duration(5 * time.Second)
+	// defaultCoolDown is a default period of an open circuit breaker.
+	defaultCoolDown = Duration(time.Minute)
+	// defaultDebounce is a default delay to group local files' changes.
+	defaultDebounce = Duration(time.Second)
+	// defaultPollInterval is a default interval of local files' polling.
+	defaultPollInterval = Duration(5 * time.Second)
+	// minTokenLen is a minimal length of access tokens.
+	minTokenLen = 8
+	// defaultUsersStats is a default file name of users' usage statistics inside the root directory.
+	defaultUsersStats = "users_stats.json"
+	// defaultAdminPrefix is a default path prefix of admin API.
+	defaultAdminPrefix = "/admin"
+	// defaultMetricsPath is a default path of Prometheus metrics.
+	defaultMetricsPath = "/metrics"
+	// defaultOverlay is a default file name of groups changed by the management API inside the root directory.
+	defaultOverlay = "overlay.json"
+	// defaultAuditLog is a default file name of the management API audit log inside the root directory.
+	defaultAuditLog = "audit.log"
+	// defaultStaleFactor is a default multiple of groups' periods after which their results are stale.
+	defaultStaleFactor = 3
+	// defaultTLSMinVersion is a default minimum TLS version of the main listener.
+	defaultTLSMinVersion = "1.2"
+	// defaultIPv4Prefix is a default prefix length of IPv4 rate limiter keys, every address has its own bucket.
+	defaultIPv4Prefix = 32
+	// defaultIPv6Prefix is a default prefix length of IPv6 rate limiter keys, a usual client's network.
+	defaultIPv6Prefix = 64
+	// defaultMaxBuckets is a default maximum number of rate limiter buckets.
+	defaultMaxBuckets = 100_000
+)
+
+// tlsVersions is a map of supported minimum TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// MergeStrategy is a way to merge subscriptions' results of a group.
+type MergeStrategy string
+
+const (
+	// MergeUnion merges results of all subscriptions, it's a default strategy.
+	MergeUnion MergeStrategy = "union"
+	// MergeFirstNonEmpty uses only the first non-empty result of subscriptions ordered by priority.
+	MergeFirstNonEmpty MergeStrategy = "first_non_empty"
+	// MergePriorityTiers merges results of the highest priority subscriptions having non-empty results.
+	MergePriorityTiers MergeStrategy = "priority_tiers"
+)
+
+// Format is an output format of group data.
+type Format string
+
+const (
+	// FormatPlain is a list of URIs separated by new lines.
+	FormatPlain Format = "plain"
+	// FormatBase64 is a base64 encoded list of URIs.
+	FormatBase64 Format = "base64"
+	// FormatClash is a Clash Meta YAML configuration of supported URIs.
+	FormatClash Format = "clash"
+	// FormatSingBox is a sing-box JSON configuration of supported URIs.
+	FormatSingBox Format = "singbox"
+)
+
+// Validate checks that the format is known, an empty format is not allowed.
+func (f Format) Validate() error {
+	switch f {
+	case FormatPlain, FormatBase64, FormatClash, FormatSingBox:
+		return nil
+	default:
+		return errors.Join(ErrParse, fmt.Errorf("unknown format %q", f))
+	}
+}
+
+// FormatRule chooses an output format of group data for clients by their User-Agent header.
+type FormatRule struct {
+	UserAgent string `json:"user_agent"` // regular expression
+	Format    Format `json:"format"`
+	re        *regexp.Regexp
+}
+
+// Match returns true if the User-Agent header value matches the rule.
+func (f *FormatRule) Match(userAgent string) bool {
+	return f.re != nil && f.re.MatchString(userAgent)
+}
+
+// Validate checks the rule and compiles its regular expression.
+func (f *FormatRule) Validate() error {
+	if f.UserAgent == "" {
+		return errors.Join(ErrRequiredField, errors.New("format rule user agent is empty"))
+	}
+
+	re, err := regexp.Compile(f.UserAgent)
+	if err != nil {
+		return errors.Join(ErrParse, fmt.Errorf("format rule user agent %q: %w", f.UserAgent, err))
+	}
+
+	if err = f.Format.Validate(); err != nil {
+		return errors.Join(err, fmt.Errorf("format rule %q", f.UserAgent))
+	}
+
+	f.re = re
+	return nil
+}
+
+// FormatRules is a list of format rules, the first matched rule is used.
+type FormatRules []FormatRule
+
+// Format returns the output format of the first rule matched by the User-Agent header.
+func (rules FormatRules) Format(userAgent string) (Format, bool) {
+	for i := range rules {
+		if rules[i].Match(userAgent) {
+			return rules[i].Format, true
+		}
+	}
+	return "", false
+}
+
+// SelectMode is a way to select urls if their number is limited by max_urls.
+type SelectMode string
+
+const (
+	// SelectFirst selects the first urls, it's a default mode.
+	SelectFirst SelectMode = "first"
+	// SelectRandom selects random urls, the random generator is seeded per group fetch.
+	SelectRandom SelectMode = "random"
+	// SelectRoundRobin selects urls taking them one by one from every subscription in turn, only for groups.
+	SelectRoundRobin SelectMode = "round_robin"
+)
+
+const (
+	// LogText is a text log format.
+	LogText = "text"
+	// LogJSON is a JSON log format.
+	LogJSON = "json"
+	// LogStdout is a standard output log destination.
+	LogStdout = "stdout"
+	// LogStderr is a standard error log destination.
+	LogStderr = "stderr"
+
+	// AccessLogCombined is Apache combined access log format with extra group and duration fields.
+	AccessLogCombined = "combined"
+	// AccessLogJSON is a JSON lines access log format.
+	AccessLogJSON = "json"
+)
+
+const (
+	// ListenUnix is a prefix of Unix socket listener addresses "unix:<path>".
+	ListenUnix = "unix:"
+	// TrustedUnix is a trusted proxies' value to trust peers of Unix socket listeners.
+	TrustedUnix = "unix"
+	// ListenSystemd is a listener address of all sockets passed by systemd socket activation,
+	// "systemd:<name>" address selects sockets by their FileDescriptorName.
+	ListenSystemd = "systemd"
+	// defaultSocketMode is a default file mode of Unix sockets.
+	defaultSocketMode = "0660"
 )
 
 var (
@@ -116,6 +285,18 @@ func (su SubPath) String() string {
 	return string(su)
 }
 
+// Pattern splits the path to a directory and a glob pattern of files' names.
+// The last value is false if the path isn't a pattern.
+// Only the last path element should be a pattern, it's checked by Subscription validation.
+func (su SubPath) Pattern() (string, string, bool) {
+	if !strings.ContainsAny(string(su), globMeta) {
+		return "", "", false
+	}
+
+	dir, pattern := filepath.Split(filepath.Clean(string(su)))
+	return filepath.Clean(dir), pattern, true
+}
+
 // LogValue returns a slog.Value to implement slog.LogValuer interface.
 func (su SubPath) LogValue() slog.Value {
 	const maxLen = 32
@@ -134,14 +315,391 @@ func (su SubPath) LogValue() slog.Value {
 	return slog.StringValue(value)
 }
 
+// RetryOptions is a retry policy configuration for subscription requests.
+// Empty Statuses means that 429 and all 5xx response statuses are retried.
+type RetryOptions struct {
+	Retries    uint8    `json:"retries"`
+	Statuses   []int    `json:"statuses"`
+	SkipErrors bool     `json:"skip_errors"`
+	BaseDelay  Duration `json:"base_delay"`
+	MaxDelay   Duration `json:"max_delay"`
+	Jitter     bool     `json:"jitter"`
+	RetryAfter bool     `json:"retry_after"`
+}
+
+// Validate checks the retry options for correctness and sets default delays.
+func (r *RetryOptions) Validate() error {
+	for _, status := range r.Statuses {
+		if status < 400 || status > 599 {
+			return errors.Join(ErrParse, fmt.Errorf("retry status %d is not an error HTTP status", status))
+		}
+	}
+
+	if r.BaseDelay < 0 || r.MaxDelay < 0 {
+		return errors.Join(ErrDenyInterval, fmt.Errorf("retry delays should not be negative"))
+	}
+
+	if r.BaseDelay == 0 {
+		r.BaseDelay = defaultBaseDelay
+	}
+
+	if r.MaxDelay == 0 {
+		r.MaxDelay = max(defaultMaxDelay, r.BaseDelay)
+	}
+
+	if r.MaxDelay < r.BaseDelay {
+		return errors.Join(ErrDenyInterval, fmt.Errorf("retry max delay %v is less than base delay %v", &r.MaxDelay, &r.BaseDelay))
+	}
+
+	return nil
+}
+
+// BreakerOptions is a per-host circuit breaker configuration.
+// The circuit breaker is disabled if Failures is 0.
+type BreakerOptions struct {
+	Failures  uint32   `json:"failures"`
+	Successes uint32   `json:"successes"`
+	CoolDown  Duration `json:"cool_down"`
+}
+
+// Enabled returns true if the circuit breaker is enabled.
+func (b *BreakerOptions) Enabled() bool {
+	return b.Failures > 0
+}
+
+// Validate checks the circuit breaker options for correctness and sets default values.
+func (b *BreakerOptions) Validate() error {
+	if !b.Enabled() {
+		return nil
+	}
+
+	if b.CoolDown < 0 {
+		return errors.Join(ErrDenyInterval, fmt.Errorf("breaker cool down should not be negative"))
+	}
+
+	if b.CoolDown == 0 {
+		b.CoolDown = defaultCoolDown
+	}
+
+	b.Successes = max(b.Successes, 1)
+	return nil
+}
+
+// WatchOptions is a configuration of local subscription files' watching.
+// If it's enabled, groups are refreshed after changes of their local files.
+type WatchOptions struct {
+	Enabled      bool     `json:"enabled"`
+	Poll         bool     `json:"poll"` // use polling even if inotify is available
+	Debounce     Duration `json:"debounce"`
+	PollInterval Duration `json:"poll_interval"`
+}
+
+// Validate checks the watch options for correctness and sets default values.
+func (w *WatchOptions) Validate() error {
+	if !w.Enabled {
+		return nil
+	}
+
+	if w.Debounce < 0 || w.PollInterval < 0 {
+		return errors.Join(ErrDenyInterval, fmt.Errorf("watch intervals should not be negative"))
+	}
+
+	if w.Debounce == 0 {
+		w.Debounce = defaultDebounce
+	}
+
+	if w.PollInterval == 0 {
+		w.PollInterval = defaultPollInterval
+	}
+
+	return nil
+}
+
+// Editor is a user of the management API.
+type Editor struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+// AdminOptions is a configuration of admin API.
+// It's served on a separate listener if Listen is set, otherwise on the main one with required token.
+// The management API is enabled if there are editors.
+type AdminOptions struct {
+	Listen    string   `json:"listen"` // separate listener address "host:port", "unix:<path>" or "systemd[:<name>]"
+	Prefix    string   `json:"prefix"`
+	Token     string   `json:"token"`
+	Editors   []Editor `json:"editors"`
+	AuditLog  string   `json:"audit_log"`  // file inside the root directory
+	PublicURL string   `json:"public_url"` // base URL of group endpoints on the dashboard
+}
+
+// Enabled returns true if the admin API is enabled.
+func (a *AdminOptions) Enabled() bool {
+	return a.Listen != "" || a.Token != "" || len(a.Editors) > 0
+}
+
+// Editor returns the editor name by the token.
+func (a *AdminOptions) Editor(token string) (string, bool) {
+	for _, editor := range a.Editors {
+		if token != "" && subtle.ConstantTimeCompare([]byte(editor.Token), []byte(token)) == 1 {
+			return editor.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// validateEditors checks editors' names and tokens, they must be unique.
+func (a *AdminOptions) validateEditors() error {
+	var (
+		names  = make(map[string]struct{}, len(a.Editors))
+		tokens = make(map[string]struct{}, len(a.Editors))
+	)
+
+	for i, editor := range a.Editors {
+		if editor.Name == "" {
+			return errors.Join(ErrRequiredField, fmt.Errorf("editor [%d] name is empty", i))
+		}
+
+		if err := validateTokens([]string{editor.Token}); err != nil {
+			return errors.Join(err, fmt.Errorf("editor %q", editor.Name))
+		}
+
+		if _, ok := names[editor.Name]; ok {
+			return errors.Join(ErrDuplicate, fmt.Errorf("editor [%d] %q is duplicated", i, editor.Name))
+		}
+
+		if _, ok := tokens[editor.Token]; ok || editor.Token == a.Token {
+			return errors.Join(ErrDuplicate, fmt.Errorf("editor [%d] %q token is duplicated", i, editor.Name))
+		}
+
+		names[editor.Name] = struct{}{}
+		tokens[editor.Token] = struct{}{}
+	}
+
+	if a.AuditLog == "" {
+		a.AuditLog = defaultAuditLog
+	}
+
+	if !filepath.IsLocal(a.AuditLog) {
+		return errors.Join(ErrParse, fmt.Errorf("audit log file %q is out of root", a.AuditLog))
+	}
+
+	return nil
+}
+
+// Validate checks the admin options for correctness and sets default values.
+func (a *AdminOptions) Validate() error {
+	if !a.Enabled() {
+		return nil
+	}
+
+	if a.Listen != "" {
+		if err := validateListen(a.Listen); err != nil {
+			return errors.Join(err, errors.New("admin listen address"))
+		}
+	} else if a.Token == "" {
+		return errors.Join(ErrRequiredField, errors.New("admin token is required on the main listener"))
+	}
+
+	if a.Token != "" {
+		if err := validateTokens([]string{a.Token}); err != nil {
+			return errors.Join(err, errors.New("admin token"))
+		}
+	}
+
+	if a.Prefix = strings.TrimRight(a.Prefix, "/"); a.Prefix == "" {
+		a.Prefix = defaultAdminPrefix
+	}
+
+	if !strings.HasPrefix(a.Prefix, "/") || strings.ContainsFunc(a.Prefix, unicode.IsSpace) {
+		return errors.Join(ErrParse, fmt.Errorf("admin prefix %q should be an absolute path", a.Prefix))
+	}
+
+	if a.PublicURL = strings.TrimRight(a.PublicURL, "/"); a.PublicURL != "" {
+		u, err := url.Parse(a.PublicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Join(ErrParse, fmt.Errorf("admin public URL %q should be an absolute HTTP URL", a.PublicURL))
+		}
+	}
+
+	return a.validateEditors()
+}
+
+// HealthOptions is a configuration of groups' freshness checks.
+type HealthOptions struct {
+	StaleFactor float64 `json:"stale_factor"` // multiple of a group period after which its result is stale
+}
+
+// Validate checks the health options for correctness and sets default values.
+func (h *HealthOptions) Validate() error {
+	if h.StaleFactor == 0 {
+		h.StaleFactor = defaultStaleFactor
+	}
+
+	if h.StaleFactor < 1 {
+		return errors.Join(ErrParse, fmt.Errorf("stale factor %v should be at least 1", h.StaleFactor))
+	}
+
+	return nil
+}
+
+// LogOptions is a configuration of logging.
+type LogOptions struct {
+	Format     string   `json:"format"`      // "text" or "json"
+	Level      string   `json:"level"`       // "debug", "info", "warn" or "error", the debug mode is used if it's empty
+	Output     string   `json:"output"`      // "stdout", "stderr" or a file path
+	MaxSize    uint     `json:"max_size"`    // maximum size of the log file in megabytes before rotation, 0 is no limit
+	MaxAge     Duration `json:"max_age"`     // maximum age of the log file before rotation, 0 is no limit
+	MaxBackups uint     `json:"max_backups"` // number of kept rotated files, 0 keeps all of them
+}
+
+// IsFile returns true if logs are written to a file.
+func (l *LogOptions) IsFile() bool {
+	return l.Output != LogStdout && l.Output != LogStderr
+}
+
+// SlogLevel returns the log level, the debug mode is used if the level is not set.
+func (l *LogOptions) SlogLevel(debug bool) slog.Level {
+	var level slog.Level
+
+	switch {
+	case l.Level != "":
+		// it's validated
+		_ = level.UnmarshalText([]byte(l.Level))
+	case debug:
+		level = slog.LevelDebug
+	default:
+		level = slog.LevelInfo
+	}
+
+	return level
+}
+
+// Validate checks the log options for correctness and sets default values.
+func (l *LogOptions) Validate() error {
+	switch l.Format {
+	case "":
+		l.Format = LogText
+	case LogText, LogJSON:
+	default:
+		return errors.Join(ErrParse, fmt.Errorf("unknown log format %q", l.Format))
+	}
+
+	switch strings.ToLower(l.Level) {
+	case "", "debug", "info", "warn", "error":
+		l.Level = strings.ToLower(l.Level)
+	default:
+		return errors.Join(ErrParse, fmt.Errorf("unknown log level %q", l.Level))
+	}
+
+	if l.Output == "" {
+		l.Output = LogStdout
+	}
+
+	return validateRotation(l.Output, l.IsFile(), l.MaxSize, l.MaxAge, l.MaxBackups)
+}
+
+// validateRotation checks rotation options of the log output, they are allowed only for files.
+func validateRotation(output string, isFile bool, maxSize uint, maxAge Duration, maxBackups uint) error {
+	if !isFile && (maxSize > 0 || maxAge > 0 || maxBackups > 0) {
+		return errors.Join(ErrParse, fmt.Errorf("log rotation is not supported for %q", output))
+	}
+
+	if maxAge < 0 {
+		return errors.Join(ErrParse, fmt.Errorf("log max age %v should not be negative", maxAge))
+	}
+
+	return nil
+}
+
+// AccessLogOptions is a configuration of HTTP access log, it's disabled if the output is empty.
+type AccessLogOptions struct {
+	Output        string   `json:"output"`         // "stdout", "stderr" or a file path
+	Format        string   `json:"format"`         // "combined" or "json"
+	MaxSize       uint     `json:"max_size"`       // maximum size of the log file in megabytes before rotation
+	MaxAge        Duration `json:"max_age"`        // maximum age of the log file before rotation
+	MaxBackups    uint     `json:"max_backups"`    // number of kept rotated files, 0 keeps all of them
+	DebugRequests bool     `json:"debug_requests"` // requests are logged by the application log with debug level
+}
+
+// Enabled returns true if the access log is enabled.
+func (a *AccessLogOptions) Enabled() bool {
+	return a.Output != ""
+}
+
+// IsFile returns true if the access log is written to a file.
+func (a *AccessLogOptions) IsFile() bool {
+	return a.Enabled() && a.Output != LogStdout && a.Output != LogStderr
+}
+
+// Validate checks the access log options for correctness and sets default values.
+func (a *AccessLogOptions) Validate() error {
+	if !a.Enabled() {
+		return nil
+	}
+
+	switch a.Format {
+	case "":
+		a.Format = AccessLogCombined
+	case AccessLogCombined, AccessLogJSON:
+	default:
+		return errors.Join(ErrParse, fmt.Errorf("unknown access log format %q", a.Format))
+	}
+
+	return validateRotation(a.Output, a.IsFile(), a.MaxSize, a.MaxAge, a.MaxBackups)
+}
+
+// MetricsOptions is a configuration of Prometheus metrics endpoint on the main listener.
+type MetricsOptions struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path"`
+	Token   string `json:"token"` // optional access token
+}
+
+// Validate checks the metrics options for correctness and sets default values.
+func (m *MetricsOptions) Validate() error {
+	if !m.Enabled {
+		return nil
+	}
+
+	if m.Token != "" {
+		if err := validateTokens([]string{m.Token}); err != nil {
+			return errors.Join(err, errors.New("metrics token"))
+		}
+	}
+
+	if m.Path = strings.TrimRight(m.Path, "/"); m.Path == "" {
+		m.Path = defaultMetricsPath
+	}
+
+	if !strings.HasPrefix(m.Path, "/") || strings.ContainsFunc(m.Path, unicode.IsSpace) {
+		return errors.Join(ErrParse, fmt.Errorf("metrics path %q should be an absolute path", m.Path))
+	}
+
+	return nil
+}
+
 // Subscription represents a subscription data.
 type Subscription struct {
-	Name        string   `json:"name"`
-	Path        SubPath  `json:"url"`
-	Encoded     bool     `json:"encoded"`
-	Timeout     Duration `json:"timeout"`
-	HasPrefixes Prefixes `json:"has_prefixes"`
-	Local       bool     `json:"local"`
+	Name        string        `json:"name"`
+	Path        SubPath       `json:"url"`
+	Encoded     bool          `json:"encoded"`
+	Timeout     Duration      `json:"timeout"`
+	HasPrefixes Prefixes      `json:"has_prefixes"`
+	Local       bool          `json:"local"`
+	Inline      []string      `json:"inline,omitempty"`
+	Retry       *RetryOptions `json:"retry,omitempty"`
+	Priority    int           `json:"priority,omitempty"`
+	FallbackFor string        `json:"fallback_for,omitempty"`
+	MaxURLs     uint32        `json:"max_urls,omitempty"`
+	MaxURLsMode SelectMode    `json:"max_urls_mode,omitempty"`
+	Disabled    bool          `json:"disabled,omitempty"`
+}
+
+// IsInline returns true if the subscription values are defined in the configuration.
+func (s *Subscription) IsInline() bool {
+	return len(s.Inline) > 0
 }
 
 // Validate checks the subscription for correctness.
@@ -150,6 +708,30 @@ func (s *Subscription) Validate(root string) error {
 		return errors.Join(ErrRequiredField, fmt.Errorf("subscription name is empty"))
 	}
 
+	if err := s.MaxURLsMode.Validate(); err != nil {
+		return errors.Join(err, fmt.Errorf("subscription %q", s.Name))
+	}
+
+	if s.MaxURLsMode == SelectRoundRobin {
+		return errors.Join(ErrParse, fmt.Errorf("subscription %q can't use %q mode", s.Name, s.MaxURLsMode))
+	}
+
+	if s.IsInline() {
+		if s.Local {
+			return errors.Join(ErrParse, fmt.Errorf("subscription %q can't be inline and local", s.Name))
+		}
+
+		if s.Path != "" || s.Retry != nil {
+			return errors.Join(ErrParse, fmt.Errorf("subscription %q can't be inline and have url or retry", s.Name))
+		}
+
+		if err := validateProxyURIs(s.Inline); err != nil {
+			return errors.Join(err, fmt.Errorf("subscription %q inline", s.Name))
+		}
+
+		return nil
+	}
+
 	if s.Path == "" {
 		return errors.Join(ErrRequiredField, fmt.Errorf("subscription path is empty"))
 	}
@@ -163,8 +745,17 @@ func (s *Subscription) Validate(root string) error {
 			return errors.Join(ErrRequiredField, fmt.Errorf("root is empty"))
 		}
 
-		fileName := string(s.Path)
-		err := validateFilePath(root, fileName)
+		var (
+			err      error
+			fileName = string(s.Path)
+		)
+
+		if dir, pattern, ok := s.Path.Pattern(); ok {
+			err = validatePattern(root, dir, pattern)
+		} else {
+			err = validateFilePath(root, fileName)
+		}
+
 		if err != nil {
 			return errors.Join(ErrParse, fmt.Errorf("file path is invalid: %w", err))
 		}
@@ -176,6 +767,12 @@ func (s *Subscription) Validate(root string) error {
 		}
 	}
 
+	if s.Retry != nil {
+		if err := s.Retry.Validate(); err != nil {
+			return errors.Join(err, fmt.Errorf("subscription %q retry", s.Name))
+		}
+	}
+
 	return nil
 }
 
@@ -200,14 +797,44 @@ func (s *Subscription) Filter(subURLs []string) []string {
 }
 
 // Group is a collection of subscriptions.
+// Static values are added to the group result as is.
 type Group struct {
 	Name          string         `json:"name"`
 	Endpoint      string         `json:"endpoint"`
 	Encoded       bool           `json:"encoded"`
 	Period        Duration       `json:"period"`
+	Static        []string       `json:"static,omitempty"`
+	Merge         MergeStrategy  `json:"merge,omitempty"`
+	MaxURLs       uint32         `json:"max_urls,omitempty"`
+	MaxURLsMode   SelectMode     `json:"max_urls_mode,omitempty"`
+	Tokens        []string       `json:"tokens,omitempty"`
+	TokenList     string         `json:"token_list,omitempty"`
+	Disabled      bool           `json:"disabled,omitempty"`
+	Limit         *RatePolicy    `json:"limit,omitempty"`       // rate limit of regular requests
+	ForceLimit    *RatePolicy    `json:"force_limit,omitempty"` // rate limit of forced refreshes
 	Subscriptions []Subscription `json:"subscriptions"`
 }
 
+// Validate checks the select mode, an empty value is a default first mode.
+func (m SelectMode) Validate() error {
+	switch m {
+	case "", SelectFirst, SelectRandom, SelectRoundRobin:
+		return nil
+	}
+
+	return errors.Join(ErrParse, fmt.Errorf("unknown max urls mode %q", m))
+}
+
+// Validate checks the merge strategy, an empty value is a default union strategy.
+func (m MergeStrategy) Validate() error {
+	switch m {
+	case "", MergeUnion, MergeFirstNonEmpty, MergePriorityTiers:
+		return nil
+	}
+
+	return errors.Join(ErrParse, fmt.Errorf("unknown merge strategy %q", m))
+}
+
 // Validate checks the group for correctness.
 func (g *Group) Validate(root string) error {
 	if g.Name == "" {
@@ -218,8 +845,32 @@ func (g *Group) Validate(root string) error {
 		return errors.Join(ErrDenyInterval, fmt.Errorf("period is too short, should be at least %v", minPeriod))
 	}
 
+	if err := validateProxyURIs(g.Static); err != nil {
+		return errors.Join(err, fmt.Errorf("group %q static", g.Name))
+	}
+
+	if err := g.Merge.Validate(); err != nil {
+		return errors.Join(err, fmt.Errorf("group %q", g.Name))
+	}
+
+	if err := g.MaxURLsMode.Validate(); err != nil {
+		return errors.Join(err, fmt.Errorf("group %q", g.Name))
+	}
+
+	if err := validateTokens(g.Tokens); err != nil {
+		return errors.Join(err, fmt.Errorf("group %q tokens", g.Name))
+	}
+
+	if err := g.Limit.Validate(); err != nil {
+		return errors.Join(err, fmt.Errorf("group %q limit", g.Name))
+	}
+
+	if err := g.ForceLimit.Validate(); err != nil {
+		return errors.Join(err, fmt.Errorf("group %q force limit", g.Name))
+	}
+
 	n := len(g.Subscriptions)
-	if n == 0 {
+	if n == 0 && len(g.Static) == 0 {
 		return errors.Join(ErrRequiredField, fmt.Errorf("group %q has no subscriptions", g.Name))
 	}
 
@@ -236,39 +887,116 @@ func (g *Group) Validate(root string) error {
 		subscriptions[sub.Name] = struct{}{}
 	}
 
-	return nil
+	return g.validateFallbacks()
 }
 
-// MaxSubscriptionTimeout returns the maximum timeout of all subscriptions in the group.
-func (g *Group) MaxSubscriptionTimeout() time.Duration {
-	var maxTimeout time.Duration
+// validateFallbacks checks that subscriptions' fallbacks refer to other subscriptions of the group without cycles.
+func (g *Group) validateFallbacks() error {
+	fallbacks := make(map[string]string, len(g.Subscriptions))
 
 	for _, sub := range g.Subscriptions {
-		maxTimeout = max(maxTimeout, sub.Timeout.Timed())
+		if sub.FallbackFor != "" {
+			fallbacks[sub.Name] = sub.FallbackFor
+		}
 	}
 
-	return maxTimeout
-}
+	for _, sub := range g.Subscriptions {
+		if sub.FallbackFor == "" {
+			continue
+		}
 
-// LimitOptions is a rate limiter configuration.
-type LimitOptions struct {
-	MaxConcurrent uint32   `json:"max_concurrent"`
-	Rate          float64  `json:"rate"`
-	Burst         float64  `json:"burst"`
-	Interval      Duration `json:"interval"`
-	CleanInterval Duration `json:"clean_interval"`
-	Exclude       []string `json:"exclude"`
-	excludeIPs    map[string]struct{}
-}
+		if _, ok := g.Subscription(sub.FallbackFor); !ok {
+			return errors.Join(
+				ErrRequiredField,
+				fmt.Errorf("subscription %q is fallback for unknown %q", sub.Name, sub.FallbackFor),
+			)
+		}
 
-// ExcludedIPS returns a map of excluded IPs.
-func (l *LimitOptions) ExcludedIPS() map[string]struct{} {
-	return l.excludeIPs
-}
+		// every step of a chain is a new subscription, so a longer chain has a cycle
+		name := sub.Name
+		for range len(fallbacks) + 1 {
+			if name = fallbacks[name]; name == "" {
+				break
+			}
+		}
 
-// Validate checks the rate limiter options for correctness.
-func (l *LimitOptions) Validate() error {
-	if l.MaxConcurrent < 1 {
+		if name != "" {
+			return errors.Join(ErrParse, fmt.Errorf("subscription %q has cyclic fallbacks", sub.Name))
+		}
+	}
+
+	return nil
+}
+
+// Subscription returns the group subscription by its name.
+func (g *Group) Subscription(name string) (*Subscription, bool) {
+	for i := range g.Subscriptions {
+		if g.Subscriptions[i].Name == name {
+			return &g.Subscriptions[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// MaxSubscriptionTimeout returns the maximum timeout of all subscriptions in the group.
+func (g *Group) MaxSubscriptionTimeout() time.Duration {
+	var maxTimeout time.Duration
+
+	for _, sub := range g.Subscriptions {
+		maxTimeout = max(maxTimeout, sub.Timeout.Timed())
+	}
+
+	return maxTimeout
+}
+
+// RatePolicy is a rate limit of requests per client IP, a zero rate or burst means no limit.
+type RatePolicy struct {
+	Rate     float64  `json:"rate"`
+	Burst    float64  `json:"burst"`
+	Interval Duration `json:"interval"`
+}
+
+// Validate checks the rate policy, a nil policy is valid.
+func (p *RatePolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+
+	if p.Rate < 0 || p.Burst < 0 {
+		return errors.Join(ErrParse, fmt.Errorf("rate %v and burst %v should not be negative", p.Rate, p.Burst))
+	}
+
+	if p.Interval <= 0 {
+		return errors.Join(ErrRequiredField, fmt.Errorf("interval should be greater than 0"))
+	}
+
+	return nil
+}
+
+// LimitOptions is a rate limiter configuration.
+type LimitOptions struct {
+	MaxConcurrent uint32      `json:"max_concurrent"`
+	Rate          float64     `json:"rate"`
+	Burst         float64     `json:"burst"`
+	Interval      Duration    `json:"interval"`
+	CleanInterval Duration    `json:"clean_interval"`
+	Exclude       []string    `json:"exclude"`         // IPs and CIDRs without rate limits
+	IPv4Prefix    uint8       `json:"ipv4_prefix"`     // prefix length of IPv4 networks sharing a bucket
+	IPv6Prefix    uint8       `json:"ipv6_prefix"`     // prefix length of IPv6 networks sharing a bucket
+	MaxBuckets    uint32      `json:"max_buckets"`     // the least recently used buckets are evicted above it
+	Force         *RatePolicy `json:"force,omitempty"` // rate limit of forced refreshes of all groups
+	excluded      []netip.Prefix
+}
+
+// Excluded returns parsed networks without rate limits.
+func (l *LimitOptions) Excluded() []netip.Prefix {
+	return l.excluded
+}
+
+// Validate checks the rate limiter options for correctness.
+func (l *LimitOptions) Validate() error {
+	if l.MaxConcurrent < 1 {
 		return errors.Join(ErrRequiredField, fmt.Errorf("max concurrent should be at least 1"))
 	}
 
@@ -288,9 +1016,72 @@ func (l *LimitOptions) Validate() error {
 		return errors.Join(ErrRequiredField, fmt.Errorf("burst should be greater than or equal to 0"))
 	}
 
-	l.excludeIPs = make(map[string]struct{}, len(l.Exclude))
-	for _, ip := range l.Exclude {
-		l.excludeIPs[ip] = struct{}{}
+	if l.IPv4Prefix == 0 {
+		l.IPv4Prefix = defaultIPv4Prefix
+	}
+
+	if l.IPv6Prefix == 0 {
+		l.IPv6Prefix = defaultIPv6Prefix
+	}
+
+	if l.MaxBuckets == 0 {
+		l.MaxBuckets = defaultMaxBuckets
+	}
+
+	if l.IPv4Prefix > 32 {
+		return errors.Join(ErrParse, fmt.Errorf("ipv4 prefix %d should be from 1 to 32", l.IPv4Prefix))
+	}
+
+	if l.IPv6Prefix > 128 {
+		return errors.Join(ErrParse, fmt.Errorf("ipv6 prefix %d should be from 1 to 128", l.IPv6Prefix))
+	}
+
+	if err := l.Force.Validate(); err != nil {
+		return errors.Join(err, errors.New("limiter force"))
+	}
+
+	excluded, err := parsePrefixes(l.Exclude)
+	if err != nil {
+		return errors.Join(err, errors.New("limiter exclude"))
+	}
+
+	l.excluded = excluded
+	return nil
+}
+
+// User is a subscriptions' user with a personal access token.
+type User struct {
+	Name     string    `json:"name"`
+	Token    string    `json:"token"`
+	Groups   []string  `json:"groups"`
+	Expires  time.Time `json:"expires,omitzero"`
+	Disabled bool      `json:"disabled"`
+}
+
+// Active returns true if the user is not disabled and not expired at the time.
+func (u *User) Active(now time.Time) bool {
+	return !u.Disabled && (u.Expires.IsZero() || now.Before(u.Expires))
+}
+
+// Allowed returns true if the user has access to the group.
+func (u *User) Allowed(groupName string) bool {
+	return slices.Contains(u.Groups, groupName)
+}
+
+// Validate checks the user for correctness, groups is a set of known groups' names.
+func (u *User) Validate(groups map[string]struct{}) error {
+	if u.Name == "" {
+		return errors.Join(ErrRequiredField, errors.New("user name is empty"))
+	}
+
+	if err := validateTokens([]string{u.Token}); err != nil {
+		return errors.Join(err, fmt.Errorf("user %q", u.Name))
+	}
+
+	for _, group := range u.Groups {
+		if _, ok := groups[group]; !ok {
+			return errors.Join(ErrRequiredField, fmt.Errorf("user %q group %q is unknown", u.Name, group))
+		}
 	}
 
 	return nil
@@ -298,25 +1089,57 @@ func (l *LimitOptions) Validate() error {
 
 // Config is a main configuration structure.
 type Config struct {
-	Host      string       `json:"host"`
-	Port      uint16       `json:"port"`
-	UserAgent string       `json:"user_agent"`
-	Timeout   Duration     `json:"timeout"`
-	Root      string       `json:"root"`
-	Retries   uint8        `json:"retries"`
-	Limiter   LimitOptions `json:"limiter"`
-	Debug     bool         `json:"debug"`
-	Groups    []Group      `json:"groups"`
+	Host           string              `json:"host"`
+	Port           uint16              `json:"port"`
+	Listen         []string            `json:"listen"`      // main listeners' addresses, host and port are used if it's empty
+	SocketMode     string              `json:"socket_mode"` // octal file mode of Unix sockets
+	TLSCert        string              `json:"tls_cert"`    // certificate file in PEM format
+	TLSKey         string              `json:"tls_key"`     // private key file in PEM format
+	TLSMinVersion  string              `json:"tls_min_version"`
+	TrustedProxies []string            `json:"trusted_proxies"` // IPs and CIDRs of proxies allowed to set client IP headers
+	UserAgent      string              `json:"user_agent"`
+	Timeout        Duration            `json:"timeout"`
+	Root           string              `json:"root"`
+	Retries        uint8               `json:"retries"`
+	Retry          RetryOptions        `json:"retry"`
+	Breaker        BreakerOptions      `json:"breaker"`
+	Watch          WatchOptions        `json:"watch"`
+	Limiter        LimitOptions        `json:"limiter"`
+	Debug          bool                `json:"debug"`
+	Log            LogOptions          `json:"log"`
+	AccessLog      AccessLogOptions    `json:"access_log"`
+	Admin          AdminOptions        `json:"admin"`
+	Metrics        MetricsOptions      `json:"metrics"`
+	Health         HealthOptions       `json:"health"`
+	Tokens         map[string][]string `json:"tokens"`
+	FormatRules    FormatRules         `json:"format_rules"` // the first matched rule is used
+	Users          []User              `json:"users"`
+	UsersStats     string              `json:"users_stats"`
+	Overlay        string              `json:"overlay"` // file of groups changed by the management API inside root
+	Groups         []Group             `json:"groups"`
+	file           string              // source file name
+	base           []Group             // groups of the configuration file without overlay
+	proxies        []netip.Prefix      // parsed trusted proxies
+	unixTrusted    bool                // peers of Unix socket listeners are trusted proxies
+	socketMode     os.FileMode         // parsed socket mode
+	overlay        Overlay
+}
+
+// File returns the configuration file name, it's empty if the configuration wasn't read from a file.
+func (c *Config) File() string {
+	return c.file
 }
 
 // Validate checks the configuration for correctness.
 func (c *Config) Validate() error {
-	if c.Host == "" {
-		return errors.Join(ErrRequiredField, errors.New("host is empty"))
-	}
+	if len(c.Listen) == 0 {
+		if c.Host == "" {
+			return errors.Join(ErrRequiredField, errors.New("host is empty"))
+		}
 
-	if c.Port == 0 {
-		return errors.Join(ErrRequiredField, errors.New("port is empty"))
+		if c.Port == 0 {
+			return errors.Join(ErrRequiredField, errors.New("port is empty"))
+		}
 	}
 
 	if c.Timeout == 0 {
@@ -335,10 +1158,70 @@ func (c *Config) Validate() error {
 		return errors.Join(ErrRequiredField, errors.New("root is empty"))
 	}
 
+	if err := c.Retry.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Breaker.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Watch.Validate(); err != nil {
+		return err
+	}
+
 	if err := c.Limiter.Validate(); err != nil {
 		return err
 	}
 
+	if err := c.Admin.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Metrics.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Log.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.AccessLog.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.validateLogOutputs(); err != nil {
+		return err
+	}
+
+	if err := c.Health.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.validateTLS(); err != nil {
+		return err
+	}
+
+	if err := c.validateListeners(); err != nil {
+		return err
+	}
+
+	for i := range c.FormatRules {
+		if err := c.FormatRules[i].Validate(); err != nil {
+			return errors.Join(err, fmt.Errorf("format rule [%d]", i))
+		}
+	}
+
+	if err := c.validateProxies(); err != nil {
+		return err
+	}
+
+	for name, tokens := range c.Tokens {
+		if err := validateTokens(tokens); err != nil {
+			return errors.Join(err, fmt.Errorf("token list %q", name))
+		}
+	}
+
 	n := len(c.Groups)
 	if n == 0 {
 		return errors.Join(ErrRequiredField, errors.New("no groups defined"))
@@ -360,10 +1243,67 @@ func (c *Config) Validate() error {
 			return errors.Join(ErrDuplicate, fmt.Errorf("group name [%d] %q is duplicated", i, group.Name))
 		}
 
+		if c.Admin.Enabled() && c.Admin.Listen == "" && strings.Trim(group.Endpoint, "/ ") == strings.Trim(c.Admin.Prefix, "/") {
+			return errors.Join(ErrDuplicate, fmt.Errorf("endpoint [%d] %q is used by admin API", i, group.Endpoint))
+		}
+
+		if c.Metrics.Enabled && strings.Trim(group.Endpoint, "/ ") == strings.Trim(c.Metrics.Path, "/") {
+			return errors.Join(ErrDuplicate, fmt.Errorf("endpoint [%d] %q is used by metrics", i, group.Endpoint))
+		}
+
+		if _, ok := c.Tokens[group.TokenList]; group.TokenList != "" && !ok {
+			return errors.Join(ErrRequiredField, fmt.Errorf("group %q token list %q is unknown", group.Name, group.TokenList))
+		}
+
 		endpoints[group.Endpoint] = struct{}{}
 		names[group.Name] = struct{}{}
 	}
 
+	return c.validateUsers(names)
+}
+
+// validateUsers checks users and their unique names and tokens, groups is a set of known groups' names.
+func (c *Config) validateUsers(groups map[string]struct{}) error {
+	var (
+		names  = make(map[string]struct{}, len(c.Users))
+		tokens = make(map[string]struct{}, len(c.Users))
+	)
+
+	for i := range c.Users {
+		user := &c.Users[i]
+
+		if err := user.Validate(groups); err != nil {
+			return err
+		}
+
+		if _, ok := names[user.Name]; ok {
+			return errors.Join(ErrDuplicate, fmt.Errorf("user name [%d] %q is duplicated", i, user.Name))
+		}
+
+		if _, ok := tokens[user.Token]; ok {
+			return errors.Join(ErrDuplicate, fmt.Errorf("user [%d] %q token is duplicated", i, user.Name))
+		}
+
+		names[user.Name] = struct{}{}
+		tokens[user.Token] = struct{}{}
+	}
+
+	if c.UsersStats == "" {
+		c.UsersStats = defaultUsersStats
+	}
+
+	if !filepath.IsLocal(c.UsersStats) {
+		return errors.Join(ErrParse, fmt.Errorf("users stats file %q is out of root", c.UsersStats))
+	}
+
+	if c.Overlay == "" {
+		c.Overlay = defaultOverlay
+	}
+
+	if !filepath.IsLocal(c.Overlay) {
+		return errors.Join(ErrParse, fmt.Errorf("overlay file %q is out of root", c.Overlay))
+	}
+
 	return nil
 }
 
@@ -372,11 +1312,194 @@ func (c *Config) Addr() string {
 	return net.JoinHostPort(c.Host, fmt.Sprint(c.Port))
 }
 
-// GroupsEndpoints returns a map of groups by their endpoints.
+// Proxies returns networks of trusted proxies.
+func (c *Config) Proxies() []netip.Prefix {
+	return c.proxies
+}
+
+// UnixTrusted returns true if peers of Unix socket listeners are trusted proxies.
+func (c *Config) UnixTrusted() bool {
+	return c.unixTrusted
+}
+
+// validateProxies parses trusted proxies, "unix" value trusts peers of Unix socket listeners.
+func (c *Config) validateProxies() error {
+	var (
+		values      = make([]string, 0, len(c.TrustedProxies))
+		unixTrusted bool
+	)
+
+	for _, value := range c.TrustedProxies {
+		if value == TrustedUnix {
+			unixTrusted = true
+			continue
+		}
+		values = append(values, value)
+	}
+
+	proxies, err := parsePrefixes(values)
+	if err != nil {
+		return errors.Join(err, errors.New("trusted proxies"))
+	}
+
+	c.proxies, c.unixTrusted = proxies, unixTrusted
+	return nil
+}
+
+// TLSEnabled returns true if the main listener serves HTTPS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCert != ""
+}
+
+// MinTLSVersion returns the minimum TLS version of the main listener.
+func (c *Config) MinTLSVersion() uint16 {
+	if version, ok := tlsVersions[c.TLSMinVersion]; ok {
+		return version
+	}
+	return tlsVersions[defaultTLSMinVersion]
+}
+
+// Listeners returns addresses of the main listeners, it's host and port if listen addresses are not set.
+func (c *Config) Listeners() []string {
+	if len(c.Listen) == 0 {
+		return []string{c.Addr()}
+	}
+
+	return c.Listen
+}
+
+// SocketFileMode returns the file mode of Unix sockets.
+func (c *Config) SocketFileMode() os.FileMode {
+	return c.socketMode
+}
+
+// validateListeners checks listeners' addresses of the main and admin servers and the socket mode.
+func (c *Config) validateListeners() error {
+	var (
+		addrs     = make(map[string]struct{}, len(c.Listen)+1)
+		systemd   bool // all activated sockets are used
+		fdNames   bool // activated sockets are selected by names
+		listeners = slices.Clone(c.Listen)
+	)
+
+	if c.Admin.Listen != "" {
+		listeners = append(listeners, c.Admin.Listen)
+	}
+
+	for i, addr := range listeners {
+		if err := validateListen(addr); err != nil {
+			return errors.Join(err, fmt.Errorf("listen address [%d]", i))
+		}
+
+		if _, ok := addrs[addr]; ok {
+			return errors.Join(ErrDuplicate, fmt.Errorf("listen address [%d] %q is duplicated", i, addr))
+		}
+
+		addrs[addr] = struct{}{}
+		systemd = systemd || addr == ListenSystemd
+		fdNames = fdNames || strings.HasPrefix(addr, ListenSystemd+":")
+	}
+
+	if systemd && fdNames {
+		return errors.Join(ErrParse, errors.New("systemd sockets should be selected by names for several listeners"))
+	}
+
+	if c.SocketMode == "" {
+		c.SocketMode = defaultSocketMode
+	}
+
+	mode, err := strconv.ParseUint(c.SocketMode, 8, 32)
+	if err != nil || mode > uint64(os.ModePerm) {
+		return errors.Join(ErrParse, fmt.Errorf("invalid socket mode %q", c.SocketMode))
+	}
+
+	c.socketMode = os.FileMode(mode)
+	return nil
+}
+
+// validateLogOutputs checks that the application and access logs are not written to the same file,
+// they would rotate it independently.
+func (c *Config) validateLogOutputs() error {
+	if !c.Log.IsFile() || !c.AccessLog.IsFile() {
+		return nil
+	}
+
+	if logFilePath(c.Log.Output) == logFilePath(c.AccessLog.Output) {
+		return errors.Join(ErrDuplicate, fmt.Errorf("access log output %q is the log output", c.AccessLog.Output))
+	}
+
+	return nil
+}
+
+// logFilePath returns an absolute path of the log file to compare outputs.
+func logFilePath(output string) string {
+	if path, err := filepath.Abs(output); err == nil {
+		return path
+	}
+	return filepath.Clean(output)
+}
+
+// validateListen checks a listener address "host:port", "unix:<path>", "systemd" or "systemd:<name>".
+func validateListen(addr string) error {
+	if name, ok := strings.CutPrefix(addr, ListenSystemd+":"); ok {
+		if name == "" {
+			return errors.Join(ErrParse, fmt.Errorf("empty systemd socket name %q", addr))
+		}
+		return nil
+	}
+
+	if path, ok := strings.CutPrefix(addr, ListenUnix); ok {
+		if path == "" {
+			return errors.Join(ErrParse, fmt.Errorf("empty unix socket path %q", addr))
+		}
+		return nil
+	}
+
+	if addr == ListenSystemd {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return errors.Join(ErrParse, fmt.Errorf("listen address %q: %w", addr, err))
+	}
+
+	return nil
+}
+
+// validateTLS checks that the certificate and the key are set together and can be loaded.
+func (c *Config) validateTLS() error {
+	if c.TLSCert == "" && c.TLSKey == "" {
+		return nil
+	}
+
+	if c.TLSCert == "" || c.TLSKey == "" {
+		return errors.Join(ErrRequiredField, errors.New("both tls_cert and tls_key should be set"))
+	}
+
+	if c.TLSMinVersion == "" {
+		c.TLSMinVersion = defaultTLSMinVersion
+	}
+
+	if _, ok := tlsVersions[c.TLSMinVersion]; !ok {
+		return errors.Join(ErrParse, fmt.Errorf("unknown minimum TLS version %q", c.TLSMinVersion))
+	}
+
+	if _, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey); err != nil {
+		return errors.Join(ErrParse, fmt.Errorf("load TLS certificate: %w", err))
+	}
+
+	return nil
+}
+
+// GroupsEndpoints returns a map of enabled groups by their endpoints.
 func (c *Config) GroupsEndpoints() map[string]*Group {
 	var groups = make(map[string]*Group, len(c.Groups))
 
 	for i := range c.Groups {
+		if c.Groups[i].Disabled {
+			continue
+		}
+
 		endpoint := url.QueryEscape(strings.Trim(c.Groups[i].Endpoint, "/ "))
 		groups[endpoint] = &c.Groups[i]
 	}
@@ -384,6 +1507,24 @@ func (c *Config) GroupsEndpoints() map[string]*Group {
 	return groups
 }
 
+// GroupsTokens returns a map of access tokens by groups' names.
+// Tokens of a group are its own ones and tokens of its named list,
+// groups without tokens are not protected and absent in the map.
+func (c *Config) GroupsTokens() map[string][]string {
+	var groups = make(map[string][]string, len(c.Groups))
+
+	for i := range c.Groups {
+		group := &c.Groups[i]
+		tokens := slices.Concat(group.Tokens, c.Tokens[group.TokenList])
+
+		if len(tokens) > 0 {
+			groups[group.Name] = tokens
+		}
+	}
+
+	return groups
+}
+
 // readConfig reads a configuration file from the filesystem.
 func readConfig(filename string) ([]byte, error) {
 	const dockerConfigDir = "/data"
@@ -421,33 +1562,140 @@ func New(filename string) (*Config, error) {
 		return nil, errors.Join(ErrParse, fmt.Errorf("unmarshal config: %w", err))
 	}
 
+	if err = config.loadOverlay(); err != nil {
+		return nil, err
+	}
+
 	if err = config.Validate(); err != nil {
 		return nil, err
 	}
 
+	config.file = filename
 	return config, nil
 }
 
+// validateProxyURIs checks that every value is a proxy URI like "scheme://..." without spaces.
+func validateProxyURIs(values []string) error {
+	for i, value := range values {
+		if value == "" || strings.ContainsFunc(value, unicode.IsSpace) {
+			return errors.Join(ErrParse, fmt.Errorf("value [%d] is empty or contains spaces", i))
+		}
+
+		u, err := url.Parse(value)
+		if err != nil {
+			return errors.Join(ErrParse, fmt.Errorf("value [%d] is invalid: %w", i, err))
+		}
+
+		if u.Scheme == "" || !strings.HasPrefix(value[len(u.Scheme):], "://") {
+			return errors.Join(ErrParse, fmt.Errorf("value [%d] has no scheme", i))
+		}
+	}
+
+	return nil
+}
+
+// parsePrefixes parses IP addresses and CIDRs, an address is a network of one address.
+// IPv4-mapped IPv6 addresses are converted to IPv4 ones.
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+
+	for i, value := range values {
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, errors.Join(ErrParse, fmt.Errorf("network [%d] %q: %w", i, value, err))
+			}
+
+			if addr := prefix.Addr(); addr.Is4In6() && prefix.Bits() >= 96 {
+				prefix = netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+			}
+
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, errors.Join(ErrParse, fmt.Errorf("address [%d] %q: %w", i, value, err))
+		}
+
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+// validateTokens checks that access tokens are long enough and can be used as a path segment.
+func validateTokens(tokens []string) error {
+	for i, token := range tokens {
+		if len(token) < minTokenLen {
+			return errors.Join(ErrParse, fmt.Errorf("token [%d] is too short, should be at least %d", i, minTokenLen))
+		}
+
+		if strings.ContainsFunc(token, func(r rune) bool { return r == '/' || !unicode.IsGraphic(r) || unicode.IsSpace(r) }) {
+			return errors.Join(ErrParse, fmt.Errorf("token [%d] contains slashes, spaces or not printable characters", i))
+		}
+	}
+
+	return nil
+}
+
+// fileModeInRoot returns a mode of the file opened inside the root.
+func fileModeInRoot(root string, fileName string) (os.FileMode, error) {
+	f, err := os.OpenInRoot(root, fileName)
+	if err != nil {
+		return 0, fmt.Errorf("open file %q: %w", fileName, err)
+	}
+
+	fileInfo, err := f.Stat()
+	if closeErr := f.Close(); closeErr != nil {
+		return 0, fmt.Errorf("close file %q: %w", fileName, closeErr)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("get file %q info: %w", fileName, err)
+	}
+
+	return fileInfo.Mode(), nil
+}
+
 // validateFilePath checks if the file path is valid and safe.
-// It returns the cleaned file path or an error.
+// The path should be a regular file or a directory inside the root.
 func validateFilePath(root string, fileName string) error {
 	if fileName == "" {
 		return errors.New("file name is empty")
 	}
 
-	f, err := os.OpenInRoot(root, fileName)
+	fileMode, err := fileModeInRoot(root, fileName)
 	if err != nil {
-		return fmt.Errorf("open file %q: %w", fileName, err)
+		return err
 	}
 
-	fileInfo, err := f.Stat()
+	if !fileMode.IsRegular() && !fileMode.IsDir() {
+		return fmt.Errorf("file %q is not a regular file or directory, mode=%v", fileName, fileMode)
+	}
+
+	return nil
+}
+
+// validatePattern checks if the glob pattern is valid and its directory is inside the root.
+func validatePattern(root, dir, pattern string) error {
+	if strings.ContainsAny(dir, globMeta) {
+		return fmt.Errorf("directory %q should not be a pattern", dir)
+	}
+
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("pattern %q: %w", pattern, err)
+	}
+
+	fileMode, err := fileModeInRoot(root, dir)
 	if err != nil {
-		return fmt.Errorf("get file %q info: %w", fileName, err)
+		return err
 	}
 
-	fileMode := fileInfo.Mode()
-	if !fileMode.IsRegular() {
-		return fmt.Errorf("file %q is not a regular file, mode=%v", fileName, fileMode)
+	if !fileMode.IsDir() {
+		return fmt.Errorf("pattern directory %q is not a directory, mode=%v", dir, fileMode)
 	}
 
 	return nil
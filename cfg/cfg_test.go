@@ -1,10 +1,21 @@
 package cfg
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
+	"log/slog"
 	"maps"
+	"math/big"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"reflect"
 	"slices"
 	"strings"
 	"testing"
@@ -90,6 +101,10 @@ func TestNew(t *testing.T) {
 	if cfg.Addr() != "localhost:43210" {
 		t.Error("unexpected address")
 	}
+
+	if cfg.File() != name {
+		t.Errorf("unexpected file %q", cfg.File())
+	}
 }
 
 func TestSubscriptionValidate(t *testing.T) {
@@ -104,6 +119,10 @@ func TestSubscriptionValidate(t *testing.T) {
 		t.Fatal(fileErr)
 	}
 
+	if fileErr = os.Mkdir(filepath.Join(tmpDir, "nodes"), 0o750); fileErr != nil {
+		t.Fatal(fileErr)
+	}
+
 	testCases := []struct {
 		name    string
 		sub     Subscription
@@ -180,6 +199,170 @@ func TestSubscriptionValidate(t *testing.T) {
 			},
 			rootDir: tmpDir,
 		},
+		{
+			name: "valid local directory",
+			sub: Subscription{
+				Name:    "subscription1",
+				Path:    SubPath("nodes"),
+				Timeout: Duration(time.Second),
+				Local:   true,
+			},
+			rootDir: tmpDir,
+		},
+		{
+			name: "valid local pattern",
+			sub: Subscription{
+				Name:    "subscription1",
+				Path:    SubPath("nodes/*.txt"),
+				Timeout: Duration(time.Second),
+				Local:   true,
+			},
+			rootDir: tmpDir,
+		},
+		{
+			name: "invalid local pattern",
+			sub: Subscription{
+				Name:    "subscription1",
+				Path:    SubPath("nodes/[.txt"),
+				Timeout: Duration(time.Second),
+				Local:   true,
+			},
+			rootDir: tmpDir,
+			err:     ErrParse,
+			errMsg:  "syntax error in pattern",
+		},
+		{
+			name: "local pattern directory is file",
+			sub: Subscription{
+				Name:    "subscription1",
+				Path:    SubPath(fileName + "/*.txt"),
+				Timeout: Duration(time.Second),
+				Local:   true,
+			},
+			rootDir: tmpDir,
+			err:     ErrParse,
+			errMsg:  "is not a directory",
+		},
+		{
+			name: "local pattern directory",
+			sub: Subscription{
+				Name:    "subscription1",
+				Path:    SubPath("*/a.txt"),
+				Timeout: Duration(time.Second),
+				Local:   true,
+			},
+			rootDir: tmpDir,
+			err:     ErrParse,
+			errMsg:  "should not be a pattern",
+		},
+		{
+			name: "local pattern out of root",
+			sub: Subscription{
+				Name:    "subscription1",
+				Path:    SubPath("../*.txt"),
+				Timeout: Duration(time.Second),
+				Local:   true,
+			},
+			rootDir: tmpDir,
+			err:     ErrParse,
+			errMsg:  "file path is invalid",
+		},
+		{
+			name: "invalid retry",
+			sub: Subscription{
+				Name:    "subscription1",
+				Path:    "http://localhost:43211/subscription1",
+				Timeout: Duration(time.Second),
+				Retry:   &RetryOptions{Statuses: []int{302}},
+			},
+			rootDir: tmpDir,
+			err:     ErrParse,
+			errMsg:  "retry status 302",
+		},
+		{
+			name: "inline",
+			sub: Subscription{
+				Name:   "subscription1",
+				Inline: []string{"vless://id@example.com:443", "ss://secret@1.2.3.4:8388#name"},
+			},
+			rootDir: tmpDir,
+		},
+		{
+			name: "unknown max urls mode",
+			sub: Subscription{
+				Name:        "subscription1",
+				Inline:      []string{"vless://id@example.com:443"},
+				MaxURLsMode: "last",
+			},
+			rootDir: tmpDir,
+			err:     ErrParse,
+			errMsg:  "unknown max urls mode \"last\"",
+		},
+		{
+			name: "round robin max urls mode",
+			sub: Subscription{
+				Name:        "subscription1",
+				Inline:      []string{"vless://id@example.com:443"},
+				MaxURLs:     1,
+				MaxURLsMode: SelectRoundRobin,
+			},
+			rootDir: tmpDir,
+			err:     ErrParse,
+			errMsg:  "can't use \"round_robin\" mode",
+		},
+		{
+			name: "inline and local",
+			sub: Subscription{
+				Name:   "subscription1",
+				Inline: []string{"vless://id@example.com:443"},
+				Local:  true,
+			},
+			rootDir: tmpDir,
+			err:     ErrParse,
+			errMsg:  "can't be inline and local",
+		},
+		{
+			name: "inline and url",
+			sub: Subscription{
+				Name:   "subscription1",
+				Path:   "https://example.com/sub",
+				Inline: []string{"vless://id@example.com:443"},
+			},
+			rootDir: tmpDir,
+			err:     ErrParse,
+			errMsg:  "can't be inline and have url or retry",
+		},
+		{
+			name: "inline and retry",
+			sub: Subscription{
+				Name:   "subscription1",
+				Inline: []string{"vless://id@example.com:443"},
+				Retry:  &RetryOptions{},
+			},
+			rootDir: tmpDir,
+			err:     ErrParse,
+			errMsg:  "can't be inline and have url or retry",
+		},
+		{
+			name: "inline without scheme",
+			sub: Subscription{
+				Name:   "subscription1",
+				Inline: []string{"vless://id@example.com:443", "example.com:443"},
+			},
+			rootDir: tmpDir,
+			err:     ErrParse,
+			errMsg:  "value [1] has no scheme",
+		},
+		{
+			name: "inline with spaces",
+			sub: Subscription{
+				Name:   "subscription1",
+				Inline: []string{"vless://id@example.com:443 ss://secret@1.2.3.4:8388"},
+			},
+			rootDir: tmpDir,
+			err:     ErrParse,
+			errMsg:  "value [0] is empty or contains spaces",
+		},
 		{
 			name: "valid",
 			sub: Subscription{
@@ -265,6 +448,111 @@ func TestGroupValidate(t *testing.T) {
 			err:    ErrRequiredField,
 			errMsg: "group \"group1\" has no subscriptions",
 		},
+		{
+			name: "only static",
+			group: Group{
+				Name:   "group1",
+				Period: Duration(time.Hour),
+				Static: []string{"trojan://password@example.com:443"},
+			},
+		},
+		{
+			name: "invalid static",
+			group: Group{
+				Name:   "group1",
+				Period: Duration(time.Hour),
+				Static: []string{""},
+			},
+			err:    ErrParse,
+			errMsg: "group \"group1\" static",
+		},
+		{
+			name: "unknown merge strategy",
+			group: Group{
+				Name:   "group1",
+				Period: Duration(time.Hour),
+				Merge:  "unknown",
+				Static: []string{"trojan://password@example.com:443"},
+			},
+			err:    ErrParse,
+			errMsg: "unknown merge strategy \"unknown\"",
+		},
+		{
+			name: "unknown max urls mode",
+			group: Group{
+				Name:        "group1",
+				Period:      Duration(time.Hour),
+				MaxURLsMode: "all",
+				Static:      []string{"trojan://password@example.com:443"},
+			},
+			err:    ErrParse,
+			errMsg: "unknown max urls mode \"all\"",
+		},
+		{
+			name: "invalid token",
+			group: Group{
+				Name:   "group1",
+				Period: Duration(time.Hour),
+				Tokens: []string{"token12345", "token/12345"},
+				Static: []string{"trojan://password@example.com:443"},
+			},
+			err:    ErrParse,
+			errMsg: "token [1] contains slashes",
+		},
+		{
+			name: "unknown fallback",
+			group: Group{
+				Name:   "group1",
+				Period: Duration(time.Hour),
+				Subscriptions: []Subscription{
+					{Name: "subscription1", Path: "http://localhost:43211/sub1", Timeout: sec, FallbackFor: "sub"},
+				},
+			},
+			err:    ErrRequiredField,
+			errMsg: "subscription \"subscription1\" is fallback for unknown \"sub\"",
+		},
+		{
+			name: "self fallback",
+			group: Group{
+				Name:   "group1",
+				Period: Duration(time.Hour),
+				Subscriptions: []Subscription{
+					{Name: "subscription1", Path: "http://localhost:43211/sub1", Timeout: sec, FallbackFor: "subscription1"},
+				},
+			},
+			err:    ErrParse,
+			errMsg: "subscription \"subscription1\" has cyclic fallbacks",
+		},
+		{
+			name: "cyclic fallbacks",
+			group: Group{
+				Name:   "group1",
+				Period: Duration(time.Hour),
+				Subscriptions: []Subscription{
+					{Name: "subscription1", Path: "http://localhost:43211/sub1", Timeout: sec},
+					{Name: "subscription2", Path: "http://localhost:43211/sub2", Timeout: sec, FallbackFor: "subscription3"},
+					{Name: "subscription3", Path: "http://localhost:43211/sub3", Timeout: sec, FallbackFor: "subscription2"},
+				},
+			},
+			err:    ErrParse,
+			errMsg: "has cyclic fallbacks",
+		},
+		{
+			name: "fallbacks chain",
+			group: Group{
+				Name:        "group1",
+				Period:      Duration(time.Hour),
+				Merge:       MergePriorityTiers,
+				MaxURLs:     10,
+				MaxURLsMode: SelectRoundRobin,
+				Subscriptions: []Subscription{
+					{Name: "subscription1", Path: "http://localhost:43211/sub1", Timeout: sec},
+					{Name: "subscription2", Path: "http://localhost:43211/sub2", Timeout: sec, FallbackFor: "subscription1"},
+					{Name: "subscription3", Path: "http://localhost:43211/sub3", Timeout: sec, FallbackFor: "subscription2"},
+					{Name: "subscription4", Path: "http://localhost:43211/sub4", Timeout: sec, Priority: 1},
+				},
+			},
+		},
 		{
 			name: "invalid subscription",
 			group: Group{
@@ -547,7 +835,46 @@ func TestConfigValidate(t *testing.T) {
 			errMsg: "endpoint [1] \"/group1\" is duplicated",
 		},
 		{
-			name: "valid",
+			name: "invalid token list",
+			config: Config{
+				Host:      "localhost",
+				Port:      43210,
+				Timeout:   timeout,
+				UserAgent: userAgent,
+				Retries:   3,
+				Root:      root,
+				Limiter:   limiter,
+				Tokens:    map[string][]string{"team": {"short"}},
+			},
+			err:    ErrParse,
+			errMsg: "token list \"team\"",
+		},
+		{
+			name: "unknown token list",
+			config: Config{
+				Host:      "localhost",
+				Port:      43210,
+				Timeout:   timeout,
+				UserAgent: userAgent,
+				Retries:   3,
+				Root:      root,
+				Limiter:   limiter,
+				Tokens:    map[string][]string{"team": {"token12345"}},
+				Groups: []Group{
+					{
+						Name:      "group1",
+						Endpoint:  "/group1",
+						Period:    Duration(time.Hour),
+						TokenList: "admins",
+						Static:    []string{"trojan://password@example.com:443"},
+					},
+				},
+			},
+			err:    ErrRequiredField,
+			errMsg: "group \"group1\" token list \"admins\" is unknown",
+		},
+		{
+			name: "unknown user group",
 			config: Config{
 				Host:      "localhost",
 				Port:      43210,
@@ -556,53 +883,177 @@ func TestConfigValidate(t *testing.T) {
 				Retries:   3,
 				Root:      root,
 				Limiter:   limiter,
+				Users:     []User{{Name: "alice", Token: "alice12345", Groups: []string{"group2"}}},
 				Groups: []Group{
 					{
 						Name:     "group1",
 						Endpoint: "/group1",
 						Period:   Duration(time.Hour),
-						Subscriptions: []Subscription{
-							{Name: "subscription1", Path: "http://localhost:43211/sub1", Timeout: Duration(time.Second)},
-						},
+						Static:   []string{"trojan://password@example.com:443"},
 					},
+				},
+			},
+			err:    ErrRequiredField,
+			errMsg: "user \"alice\" group \"group2\" is unknown",
+		},
+		{
+			name: "duplicate user token",
+			config: Config{
+				Host:      "localhost",
+				Port:      43210,
+				Timeout:   timeout,
+				UserAgent: userAgent,
+				Retries:   3,
+				Root:      root,
+				Limiter:   limiter,
+				Users: []User{
+					{Name: "alice", Token: "alice12345", Groups: []string{"group1"}},
+					{Name: "bob", Token: "alice12345"},
+				},
+				Groups: []Group{
 					{
-						Name:     "group2",
-						Endpoint: "/group2",
+						Name:     "group1",
+						Endpoint: "/group1",
 						Period:   Duration(time.Hour),
-						Subscriptions: []Subscription{
-							{Name: "subscription2", Path: "http://localhost:43211/sub2", Timeout: Duration(time.Second)},
-						},
+						Static:   []string{"trojan://password@example.com:443"},
 					},
 				},
 			},
+			err:    ErrDuplicate,
+			errMsg: "user [1] \"bob\" token is duplicated",
 		},
-	}
-
-	for _, tc := range testCases {
-
-		t.Run(tc.name, func(t *testing.T) {
-			err := tc.config.Validate()
-			if tc.err == nil {
-				if err != nil {
-					t.Errorf("unexpected error: %v", err)
-				}
-				return
-			}
-
-			if err == nil {
-				t.Errorf("error expected: %v", tc.err)
-				return
-			}
-
-			if !errors.Is(err, tc.err) {
-				t.Errorf("unexpected error type: %v", err)
-				return
-			}
-
-			if errMsg := err.Error(); !strings.Contains(errMsg, tc.errMsg) {
-				t.Errorf("unexpected error message: %q", errMsg)
-			}
-		})
+		{
+			name: "admin prefix endpoint",
+			config: Config{
+				Host:      "localhost",
+				Port:      43210,
+				Timeout:   timeout,
+				UserAgent: userAgent,
+				Retries:   3,
+				Root:      root,
+				Limiter:   limiter,
+				Admin:     AdminOptions{Token: "admin12345"},
+				Groups: []Group{
+					{
+						Name:     "group1",
+						Endpoint: "/admin",
+						Period:   Duration(time.Hour),
+						Static:   []string{"trojan://password@example.com:443"},
+					},
+				},
+			},
+			err:    ErrDuplicate,
+			errMsg: "endpoint [0] \"/admin\" is used by admin API",
+		},
+		{
+			name: "metrics path endpoint",
+			config: Config{
+				Host:      "localhost",
+				Port:      43210,
+				Timeout:   timeout,
+				UserAgent: userAgent,
+				Retries:   3,
+				Root:      root,
+				Limiter:   limiter,
+				Metrics:   MetricsOptions{Enabled: true},
+				Groups: []Group{
+					{
+						Name:     "group1",
+						Endpoint: "/metrics/",
+						Period:   Duration(time.Hour),
+						Static:   []string{"trojan://password@example.com:443"},
+					},
+				},
+			},
+			err:    ErrDuplicate,
+			errMsg: "endpoint [0] \"/metrics/\" is used by metrics",
+		},
+		{
+			name: "invalid users stats",
+			config: Config{
+				Host:       "localhost",
+				Port:       43210,
+				Timeout:    timeout,
+				UserAgent:  userAgent,
+				Retries:    3,
+				Root:       root,
+				Limiter:    limiter,
+				UsersStats: "../stats.json",
+				Groups: []Group{
+					{
+						Name:     "group1",
+						Endpoint: "/group1",
+						Period:   Duration(time.Hour),
+						Static:   []string{"trojan://password@example.com:443"},
+					},
+				},
+			},
+			err:    ErrParse,
+			errMsg: "users stats file \"../stats.json\" is out of root",
+		},
+		{
+			name: "valid",
+			config: Config{
+				Host:      "localhost",
+				Port:      43210,
+				Timeout:   timeout,
+				UserAgent: userAgent,
+				Retries:   3,
+				Root:      root,
+				Limiter:   limiter,
+				Tokens:    map[string][]string{"team": {"token12345"}},
+				Users: []User{
+					{Name: "alice", Token: "alice12345", Groups: []string{"group1", "group2"}},
+					{Name: "bob", Token: "bob1234567", Disabled: true},
+				},
+				Groups: []Group{
+					{
+						Name:     "group1",
+						Endpoint: "/group1",
+						Period:   Duration(time.Hour),
+						Subscriptions: []Subscription{
+							{Name: "subscription1", Path: "http://localhost:43211/sub1", Timeout: Duration(time.Second)},
+						},
+					},
+					{
+						Name:      "group2",
+						Endpoint:  "/group2",
+						Period:    Duration(time.Hour),
+						TokenList: "team",
+						Subscriptions: []Subscription{
+							{Name: "subscription2", Path: "http://localhost:43211/sub2", Timeout: Duration(time.Second)},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.err == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Errorf("error expected: %v", tc.err)
+				return
+			}
+
+			if !errors.Is(err, tc.err) {
+				t.Errorf("unexpected error type: %v", err)
+				return
+			}
+
+			if errMsg := err.Error(); !strings.Contains(errMsg, tc.errMsg) {
+				t.Errorf("unexpected error message: %q", errMsg)
+			}
+		})
 	}
 }
 
@@ -641,202 +1092,585 @@ func TestConfigGroupsEndpointsMap(t *testing.T) {
 	}
 }
 
-func TestDurationUnmarshalJSON(t *testing.T) {
-	testCases := []struct {
-		name     string
-		str      string
-		expected Duration
-		err      error
+func TestUserActive(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		user User
+		want bool
 	}{
-		{
-			name:     "1 hour",
-			str:      `"1h"`,
-			expected: Duration(time.Hour),
+		{name: "active", user: User{Name: "alice"}, want: true},
+		{name: "disabled", user: User{Name: "alice", Disabled: true}},
+		{name: "not expired", user: User{Name: "alice", Expires: now.Add(time.Second)}, want: true},
+		{name: "expired", user: User{Name: "alice", Expires: now}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.user.Active(now); got != tc.want {
+				t.Errorf("Active() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConfigGroupsTokens(t *testing.T) {
+	config := Config{
+		Tokens: map[string][]string{"team": {"team123456"}},
+		Groups: []Group{
+			{Name: "group1"},
+			{Name: "group2", Tokens: []string{"token12345"}},
+			{Name: "group3", Tokens: []string{"token12345"}, TokenList: "team"},
+			{Name: "group4", TokenList: "team"},
 		},
+	}
+	expected := map[string][]string{
+		"group2": {"token12345"},
+		"group3": {"token12345", "team123456"},
+		"group4": {"team123456"},
+	}
+
+	tokens := config.GroupsTokens()
+	if !maps.EqualFunc(tokens, expected, slices.Equal) {
+		t.Errorf("unexpected tokens map, got=%v, but expected=%v", tokens, expected)
+	}
+}
+
+func TestRetryOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		opts      RetryOptions
+		baseDelay Duration
+		maxDelay  Duration
+		err       error  // if nil - no error expected
+		errMsg    string // a part of error message if error expected
+	}{
 		{
-			name:     "1 second",
-			str:      `"1s"`,
-			expected: Duration(time.Second),
+			name:      "defaults",
+			baseDelay: defaultBaseDelay,
+			maxDelay:  defaultMaxDelay,
 		},
 		{
-			name: "invalid duration",
-			str:  `"1x"`,
-			err:  ErrParse,
+			name:      "custom",
+			opts:      RetryOptions{Statuses: []int{429, 503}, BaseDelay: Duration(time.Second), MaxDelay: Duration(time.Minute)},
+			baseDelay: Duration(time.Second),
+			maxDelay:  Duration(time.Minute),
 		},
 		{
-			name: "empty duration",
-			str:  `""`,
-			err:  ErrParse,
+			name:      "big base delay",
+			opts:      RetryOptions{BaseDelay: Duration(time.Minute)},
+			baseDelay: Duration(time.Minute),
+			maxDelay:  Duration(time.Minute),
 		},
 		{
-			name:     "1 hour and 10 second",
-			str:      `"1h10s"`,
-			expected: Duration(time.Hour + 10*time.Second),
+			name:   "invalid status",
+			opts:   RetryOptions{Statuses: []int{200}},
+			err:    ErrParse,
+			errMsg: "retry status 200 is not an error HTTP status",
 		},
 		{
-			name:     "1 hour 2 minutes 3 seconds",
-			str:      `"1h2m3s"`,
-			expected: Duration(time.Hour + 2*time.Minute + 3*time.Second),
+			name:   "negative delay",
+			opts:   RetryOptions{BaseDelay: Duration(-time.Second)},
+			err:    ErrDenyInterval,
+			errMsg: "retry delays should not be negative",
 		},
 		{
-			name: "bad json",
-			str:  `1h10s"`,
-			err:  ErrParse,
+			name:   "max less than base",
+			opts:   RetryOptions{BaseDelay: Duration(time.Minute), MaxDelay: Duration(time.Second)},
+			err:    ErrDenyInterval,
+			errMsg: "retry max delay 1s is less than base delay 1m0s",
 		},
 	}
 
 	for _, tc := range testCases {
-
 		t.Run(tc.name, func(t *testing.T) {
-			var d = new(Duration)
-			err := d.UnmarshalJSON([]byte(tc.str))
-
+			err := tc.opts.Validate()
 			if tc.err == nil {
 				if err != nil {
 					t.Errorf("unexpected error: %v", err)
 					return
 				}
 
-				if *d != tc.expected {
-					t.Errorf("unexpected duration, got=%v, but expected=%v", *d, tc.expected)
+				if tc.opts.BaseDelay != tc.baseDelay || tc.opts.MaxDelay != tc.maxDelay {
+					t.Errorf("delays = %v/%v, want %v/%v", tc.opts.BaseDelay, tc.opts.MaxDelay, tc.baseDelay, tc.maxDelay)
 				}
 				return
 			}
 
-			if err == nil {
-				t.Errorf("error expected: %v", tc.err)
-				return
-			}
-
 			if !errors.Is(err, tc.err) {
 				t.Errorf("unexpected error type: %v", err)
 				return
 			}
+
+			if errMsg := err.Error(); !strings.Contains(errMsg, tc.errMsg) {
+				t.Errorf("unexpected error message: %q", errMsg)
+			}
 		})
 	}
 }
 
-func TestDurationMarshalJSON(t *testing.T) {
+func TestBreakerOptionsValidate(t *testing.T) {
 	testCases := []struct {
 		name     string
-		duration Duration
-		expected string
+		opts     BreakerOptions
+		expected BreakerOptions
+		err      error
 	}{
+		{name: "disabled"},
 		{
-			name:     "1 hour",
-			duration: Duration(time.Hour),
-			expected: `"1h0m0s"`,
-		},
-		{
-			name:     "1 second",
-			duration: Duration(time.Second),
-			expected: `"1s"`,
+			name:     "defaults",
+			opts:     BreakerOptions{Failures: 3},
+			expected: BreakerOptions{Failures: 3, Successes: 1, CoolDown: defaultCoolDown},
 		},
 		{
-			name:     "1 hour and 10 second",
-			duration: Duration(time.Hour + 10*time.Second),
-			expected: `"1h0m10s"`,
+			name:     "custom",
+			opts:     BreakerOptions{Failures: 3, Successes: 2, CoolDown: Duration(time.Second)},
+			expected: BreakerOptions{Failures: 3, Successes: 2, CoolDown: Duration(time.Second)},
 		},
 		{
-			name:     "2 hours 3 minutes 4 seconds",
-			duration: Duration(2*time.Hour + 3*time.Minute + 4*time.Second),
-			expected: `"2h3m4s"`,
+			name: "negative cool down",
+			opts: BreakerOptions{Failures: 3, CoolDown: Duration(-time.Second)},
+			err:  ErrDenyInterval,
 		},
 	}
 
 	for _, tc := range testCases {
-
 		t.Run(tc.name, func(t *testing.T) {
-			b, err := tc.duration.MarshalJSON()
+			err := tc.opts.Validate()
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
 			if err != nil {
 				t.Errorf("unexpected error: %v", err)
 				return
 			}
 
-			if s := string(b); s != tc.expected {
-				t.Errorf("unexpected JSON, got=%s, but expected=%s", s, tc.expected)
+			if tc.opts != tc.expected {
+				t.Errorf("options = %+v, want %+v", tc.opts, tc.expected)
 			}
 		})
 	}
 }
 
-func TestPrefixes_LogValue(t *testing.T) {
+func TestWatchOptionsValidate(t *testing.T) {
 	testCases := []struct {
 		name     string
-		prefixes Prefixes
-		expected string
+		opts     WatchOptions
+		expected WatchOptions
+		err      error
 	}{
+		{name: "disabled", opts: WatchOptions{Debounce: Duration(-1)}, expected: WatchOptions{Debounce: Duration(-1)}},
 		{
-			name:     "empty",
-			prefixes: nil,
-			expected: "[]",
+			name:     "defaults",
+			opts:     WatchOptions{Enabled: true},
+			expected: WatchOptions{Enabled: true, Debounce: defaultDebounce, PollInterval: defaultPollInterval},
 		},
 		{
-			name:     "single",
-			prefixes: Prefixes{"prefix1"},
-			expected: "['prefix1']",
+			name:     "custom",
+			opts:     WatchOptions{Enabled: true, Poll: true, Debounce: Duration(time.Minute), PollInterval: Duration(time.Second)},
+			expected: WatchOptions{Enabled: true, Poll: true, Debounce: Duration(time.Minute), PollInterval: Duration(time.Second)},
 		},
 		{
-			name:     "multiple",
-			prefixes: Prefixes{"prefix1", "prefix2", "prefix3"},
-			expected: "['prefix1', 'prefix2', 'prefix3']",
+			name: "negative interval",
+			opts: WatchOptions{Enabled: true, PollInterval: Duration(-time.Second)},
+			err:  ErrDenyInterval,
 		},
 	}
 
 	for _, tc := range testCases {
-
 		t.Run(tc.name, func(t *testing.T) {
-			s := tc.prefixes.LogValue()
+			err := tc.opts.Validate()
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
 
-			if v := s.String(); v != tc.expected {
-				t.Errorf("unexpected value, got=%q, but expected=%q", v, tc.expected)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+
+			if tc.opts != tc.expected {
+				t.Errorf("options = %+v, want %+v", tc.opts, tc.expected)
 			}
 		})
 	}
 }
 
-func TestPrefixes_Match(t *testing.T) {
+func TestAdminOptionsValidate(t *testing.T) {
 	testCases := []struct {
 		name     string
-		prefixes Prefixes
-		value    string
-		expected bool
+		opts     AdminOptions
+		expected AdminOptions
+		err      error
 	}{
+		{name: "disabled", opts: AdminOptions{Prefix: "bad"}, expected: AdminOptions{Prefix: "bad"}},
 		{
-			name: "empty",
+			name:     "default prefix",
+			opts:     AdminOptions{Token: "admin12345"},
+			expected: AdminOptions{Token: "admin12345", Prefix: defaultAdminPrefix, AuditLog: defaultAuditLog},
 		},
 		{
-			name:     "no match",
-			prefixes: Prefixes{"ss://", "vless://"},
-			value:    "trojan://url1",
+			name:     "listener",
+			opts:     AdminOptions{Listen: "127.0.0.1:43211", Prefix: "/api/"},
+			expected: AdminOptions{Listen: "127.0.0.1:43211", Prefix: "/api", AuditLog: defaultAuditLog},
 		},
 		{
-			name:  "no prefixes",
-			value: "ss://url1",
+			name: "editors",
+			opts: AdminOptions{
+				Token:    "admin12345",
+				Editors:  []Editor{{Name: "alice", Token: "alice12345"}},
+				AuditLog: "logs/audit.log",
+			},
+			expected: AdminOptions{
+				Token:    "admin12345",
+				Prefix:   defaultAdminPrefix,
+				Editors:  []Editor{{Name: "alice", Token: "alice12345"}},
+				AuditLog: "logs/audit.log",
+			},
 		},
 		{
-			name:     "empty value",
-			prefixes: Prefixes{"ss://", "vless://"},
+			name: "public URL",
+			opts: AdminOptions{Listen: "127.0.0.1:43211", PublicURL: "https://example.com/smerge/"},
+			expected: AdminOptions{
+				Listen:    "127.0.0.1:43211",
+				Prefix:    defaultAdminPrefix,
+				AuditLog:  defaultAuditLog,
+				PublicURL: "https://example.com/smerge",
+			},
 		},
+		{name: "relative public URL", opts: AdminOptions{Token: "admin12345", PublicURL: "/smerge"}, err: ErrParse},
+		{name: "public URL scheme", opts: AdminOptions{Token: "admin12345", PublicURL: "ftp://example.com"}, err: ErrParse},
+		{name: "invalid listener", opts: AdminOptions{Listen: "localhost"}, err: ErrParse},
+		{name: "short token", opts: AdminOptions{Token: "admin"}, err: ErrParse},
+		{name: "relative prefix", opts: AdminOptions{Token: "admin12345", Prefix: "admin"}, err: ErrParse},
 		{
-			name:     "single match",
-			prefixes: Prefixes{"ss://", "vless://"},
-			value:    "ss://url1",
-			expected: true,
+			name: "editors without token",
+			opts: AdminOptions{Editors: []Editor{{Name: "alice", Token: "alice12345"}}},
+			err:  ErrRequiredField,
 		},
 		{
-			name:     "multiple matches",
-			prefixes: Prefixes{"v", "vl", "vle", "vless"},
-			value:    "vless://url1",
-			expected: true,
+			name: "editor without name",
+			opts: AdminOptions{Token: "admin12345", Editors: []Editor{{Token: "alice12345"}}},
+			err:  ErrRequiredField,
+		},
+		{
+			name: "duplicated editor",
+			opts: AdminOptions{
+				Token:   "admin12345",
+				Editors: []Editor{{Name: "alice", Token: "alice12345"}, {Name: "alice", Token: "alice67890"}},
+			},
+			err: ErrDuplicate,
+		},
+		{
+			name: "editor admin token",
+			opts: AdminOptions{Token: "admin12345", Editors: []Editor{{Name: "alice", Token: "admin12345"}}},
+			err:  ErrDuplicate,
+		},
+		{
+			name: "audit log out of root",
+			opts: AdminOptions{
+				Listen:   "127.0.0.1:43211",
+				Editors:  []Editor{{Name: "alice", Token: "alice12345"}},
+				AuditLog: "../audit.log",
+			},
+			err: ErrParse,
 		},
 	}
 
 	for _, tc := range testCases {
-
 		t.Run(tc.name, func(t *testing.T) {
-			if result := tc.prefixes.Match(tc.value); result != tc.expected {
-				t.Errorf("unexpected value, got=%v, but expected=%v", result, tc.expected)
+			err := tc.opts.Validate()
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(tc.opts, tc.expected) {
+				t.Errorf("options = %+v, want %+v", tc.opts, tc.expected)
+			}
+		})
+	}
+}
+
+func TestMetricsOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     MetricsOptions
+		expected MetricsOptions
+		err      error
+	}{
+		{name: "disabled", opts: MetricsOptions{Path: "bad"}, expected: MetricsOptions{Path: "bad"}},
+		{
+			name:     "default path",
+			opts:     MetricsOptions{Enabled: true},
+			expected: MetricsOptions{Enabled: true, Path: defaultMetricsPath},
+		},
+		{
+			name:     "custom path",
+			opts:     MetricsOptions{Enabled: true, Path: "/prom/", Token: "metrics123"},
+			expected: MetricsOptions{Enabled: true, Path: "/prom", Token: "metrics123"},
+		},
+		{name: "short token", opts: MetricsOptions{Enabled: true, Token: "short"}, err: ErrParse},
+		{name: "relative path", opts: MetricsOptions{Enabled: true, Path: "metrics"}, err: ErrParse},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.Validate()
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+
+			if tc.opts != tc.expected {
+				t.Errorf("options = %+v, want %+v", tc.opts, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSubPath_Pattern(t *testing.T) {
+	testCases := []struct {
+		path    SubPath
+		dir     string
+		pattern string
+		ok      bool
+	}{
+		{path: "a.txt"},
+		{path: "nodes/a.txt"},
+		{path: "nodes"},
+		{path: "*.txt", dir: ".", pattern: "*.txt", ok: true},
+		{path: "nodes/*.txt", dir: "nodes", pattern: "*.txt", ok: true},
+		{path: "nodes/sub/node?.txt", dir: "nodes/sub", pattern: "node?.txt", ok: true},
+		{path: "nodes/[ab].txt", dir: "nodes", pattern: "[ab].txt", ok: true},
+	}
+
+	for _, tc := range testCases {
+		dir, pattern, ok := tc.path.Pattern()
+		if dir != tc.dir || pattern != tc.pattern || ok != tc.ok {
+			t.Errorf("Pattern(%q) = %q, %q, %v, want %q, %q, %v", tc.path, dir, pattern, ok, tc.dir, tc.pattern, tc.ok)
+		}
+	}
+}
+
+func TestDurationUnmarshalJSON(t *testing.T) {
+	testCases := []struct {
+		name     string
+		str      string
+		expected Duration
+		err      error
+	}{
+		{
+			name:     "1 hour",
+			str:      `"1h"`,
+			expected: Duration(time.Hour),
+		},
+		{
+			name:     "1 second",
+			str:      `"1s"`,
+			expected: Duration(time.Second),
+		},
+		{
+			name: "invalid duration",
+			str:  `"1x"`,
+			err:  ErrParse,
+		},
+		{
+			name: "empty duration",
+			str:  `""`,
+			err:  ErrParse,
+		},
+		{
+			name:     "1 hour and 10 second",
+			str:      `"1h10s"`,
+			expected: Duration(time.Hour + 10*time.Second),
+		},
+		{
+			name:     "1 hour 2 minutes 3 seconds",
+			str:      `"1h2m3s"`,
+			expected: Duration(time.Hour + 2*time.Minute + 3*time.Second),
+		},
+		{
+			name: "bad json",
+			str:  `1h10s"`,
+			err:  ErrParse,
+		},
+	}
+
+	for _, tc := range testCases {
+
+		t.Run(tc.name, func(t *testing.T) {
+			var d = new(Duration)
+			err := d.UnmarshalJSON([]byte(tc.str))
+
+			if tc.err == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+
+				if *d != tc.expected {
+					t.Errorf("unexpected duration, got=%v, but expected=%v", *d, tc.expected)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Errorf("error expected: %v", tc.err)
+				return
+			}
+
+			if !errors.Is(err, tc.err) {
+				t.Errorf("unexpected error type: %v", err)
+				return
+			}
+		})
+	}
+}
+
+func TestDurationMarshalJSON(t *testing.T) {
+	testCases := []struct {
+		name     string
+		duration Duration
+		expected string
+	}{
+		{
+			name:     "1 hour",
+			duration: Duration(time.Hour),
+			expected: `"1h0m0s"`,
+		},
+		{
+			name:     "1 second",
+			duration: Duration(time.Second),
+			expected: `"1s"`,
+		},
+		{
+			name:     "1 hour and 10 second",
+			duration: Duration(time.Hour + 10*time.Second),
+			expected: `"1h0m10s"`,
+		},
+		{
+			name:     "2 hours 3 minutes 4 seconds",
+			duration: Duration(2*time.Hour + 3*time.Minute + 4*time.Second),
+			expected: `"2h3m4s"`,
+		},
+	}
+
+	for _, tc := range testCases {
+
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := tc.duration.MarshalJSON()
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+
+			if s := string(b); s != tc.expected {
+				t.Errorf("unexpected JSON, got=%s, but expected=%s", s, tc.expected)
+			}
+		})
+	}
+}
+
+func TestPrefixes_LogValue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		prefixes Prefixes
+		expected string
+	}{
+		{
+			name:     "empty",
+			prefixes: nil,
+			expected: "[]",
+		},
+		{
+			name:     "single",
+			prefixes: Prefixes{"prefix1"},
+			expected: "['prefix1']",
+		},
+		{
+			name:     "multiple",
+			prefixes: Prefixes{"prefix1", "prefix2", "prefix3"},
+			expected: "['prefix1', 'prefix2', 'prefix3']",
+		},
+	}
+
+	for _, tc := range testCases {
+
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.prefixes.LogValue()
+
+			if v := s.String(); v != tc.expected {
+				t.Errorf("unexpected value, got=%q, but expected=%q", v, tc.expected)
+			}
+		})
+	}
+}
+
+func TestPrefixes_Match(t *testing.T) {
+	testCases := []struct {
+		name     string
+		prefixes Prefixes
+		value    string
+		expected bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "no match",
+			prefixes: Prefixes{"ss://", "vless://"},
+			value:    "trojan://url1",
+		},
+		{
+			name:  "no prefixes",
+			value: "ss://url1",
+		},
+		{
+			name:     "empty value",
+			prefixes: Prefixes{"ss://", "vless://"},
+		},
+		{
+			name:     "single match",
+			prefixes: Prefixes{"ss://", "vless://"},
+			value:    "ss://url1",
+			expected: true,
+		},
+		{
+			name:     "multiple matches",
+			prefixes: Prefixes{"v", "vl", "vle", "vless"},
+			value:    "vless://url1",
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+
+		t.Run(tc.name, func(t *testing.T) {
+			if result := tc.prefixes.Match(tc.value); result != tc.expected {
+				t.Errorf("unexpected value, got=%v, but expected=%v", result, tc.expected)
 			}
 		})
 	}
@@ -934,3 +1768,645 @@ func TestURL_LogValue(t *testing.T) {
 		})
 	}
 }
+
+// writeTestCert writes a self-signed certificate and its key to the directory.
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestConfig_ValidateTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir)
+
+	testCases := []struct {
+		name     string
+		config   Config
+		enabled  bool
+		expected uint16
+		err      error
+	}{
+		{name: "disabled", expected: tls.VersionTLS12},
+		{
+			name:     "default version",
+			config:   Config{TLSCert: certFile, TLSKey: keyFile},
+			enabled:  true,
+			expected: tls.VersionTLS12,
+		},
+		{
+			name:     "version 1.3",
+			config:   Config{TLSCert: certFile, TLSKey: keyFile, TLSMinVersion: "1.3"},
+			enabled:  true,
+			expected: tls.VersionTLS13,
+		},
+		{name: "no key", config: Config{TLSCert: certFile}, err: ErrRequiredField},
+		{name: "no certificate", config: Config{TLSKey: keyFile}, err: ErrRequiredField},
+		{
+			name:   "unknown version",
+			config: Config{TLSCert: certFile, TLSKey: keyFile, TLSMinVersion: "1.4"},
+			err:    ErrParse,
+		},
+		{
+			name:   "missing files",
+			config: Config{TLSCert: filepath.Join(dir, "missing.pem"), TLSKey: keyFile},
+			err:    ErrParse,
+		},
+		{name: "mismatched files", config: Config{TLSCert: keyFile, TLSKey: certFile}, err: ErrParse},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.validateTLS()
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if enabled := tc.config.TLSEnabled(); enabled != tc.enabled {
+				t.Errorf("got enabled %v, want %v", enabled, tc.enabled)
+			}
+
+			if version := tc.config.MinTLSVersion(); version != tc.expected {
+				t.Errorf("got version %x, want %x", version, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		values   []string
+		expected []netip.Prefix
+		err      error
+	}{
+		{name: "empty", expected: []netip.Prefix{}},
+		{
+			name:   "addresses and networks",
+			values: []string{"10.0.0.1", "192.168.1.7/24", "::1", "2001:db8::1/64", "::ffff:172.16.0.1"},
+			expected: []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.1/32"),
+				netip.MustParsePrefix("192.168.1.0/24"),
+				netip.MustParsePrefix("::1/128"),
+				netip.MustParsePrefix("2001:db8::/64"),
+				netip.MustParsePrefix("172.16.0.1/32"),
+			},
+		},
+		{
+			name:     "mapped network",
+			values:   []string{"::ffff:172.16.0.0/108"},
+			expected: []netip.Prefix{netip.MustParsePrefix("172.16.0.0/12")},
+		},
+		{name: "invalid address", values: []string{"10.0.0.256"}, err: ErrParse},
+		{name: "invalid network", values: []string{"10.0.0.0/33"}, err: ErrParse},
+		{name: "hostname", values: []string{"localhost"}, err: ErrParse},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			prefixes, err := parsePrefixes(tc.values)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(prefixes, tc.expected) {
+				t.Errorf("got %v, want %v", prefixes, tc.expected)
+			}
+		})
+	}
+}
+
+func TestFormatRules(t *testing.T) {
+	rules := FormatRules{
+		{UserAgent: "(?i)clash", Format: FormatClash},
+		{UserAgent: "v2rayN|v2rayNG", Format: FormatBase64},
+		{UserAgent: ".*", Format: FormatPlain},
+	}
+
+	for i := range rules[:2] {
+		if err := rules[i].Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		userAgent string
+		expected  Format
+		ok        bool
+	}{
+		{userAgent: "ClashMeta/1.18", expected: FormatClash, ok: true},
+		{userAgent: "v2rayNG/1.8", expected: FormatBase64, ok: true},
+		{userAgent: "sing-box 1.9"}, // the last rule is not validated
+		{},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.userAgent, func(t *testing.T) {
+			format, ok := rules.Format(tc.userAgent)
+			if format != tc.expected || ok != tc.ok {
+				t.Errorf("got %q %v, want %q %v", format, ok, tc.expected, tc.ok)
+			}
+		})
+	}
+
+	errCases := []struct {
+		name string
+		rule FormatRule
+		err  error
+	}{
+		{name: "empty user agent", rule: FormatRule{Format: FormatPlain}, err: ErrRequiredField},
+		{name: "invalid expression", rule: FormatRule{UserAgent: "(clash", Format: FormatPlain}, err: ErrParse},
+		{name: "unknown format", rule: FormatRule{UserAgent: "clash", Format: "yaml"}, err: ErrParse},
+		{name: "empty format", rule: FormatRule{UserAgent: "clash"}, err: ErrParse},
+	}
+
+	for _, tc := range errCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.rule.Validate(); !errors.Is(err, tc.err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestHealthOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     HealthOptions
+		expected float64
+		err      error
+	}{
+		{name: "default", expected: defaultStaleFactor},
+		{name: "custom", opts: HealthOptions{StaleFactor: 1.5}, expected: 1.5},
+		{name: "too small", opts: HealthOptions{StaleFactor: 0.5}, err: ErrParse},
+		{name: "negative", opts: HealthOptions{StaleFactor: -2}, err: ErrParse},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.Validate()
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tc.opts.StaleFactor != tc.expected {
+				t.Errorf("got stale factor %v, want %v", tc.opts.StaleFactor, tc.expected)
+			}
+		})
+	}
+}
+
+func TestLogOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     LogOptions
+		expected LogOptions
+		err      error
+	}{
+		{name: "default", expected: LogOptions{Format: LogText, Output: LogStdout}},
+		{
+			name:     "json to stderr",
+			opts:     LogOptions{Format: LogJSON, Level: "WARN", Output: LogStderr},
+			expected: LogOptions{Format: LogJSON, Level: "warn", Output: LogStderr},
+		},
+		{
+			name:     "file with rotation",
+			opts:     LogOptions{Output: "/var/log/smerge.log", MaxSize: 10, MaxAge: Duration(time.Hour), MaxBackups: 3},
+			expected: LogOptions{Format: LogText, Output: "/var/log/smerge.log", MaxSize: 10, MaxAge: Duration(time.Hour), MaxBackups: 3},
+		},
+		{name: "unknown format", opts: LogOptions{Format: "xml"}, err: ErrParse},
+		{name: "unknown level", opts: LogOptions{Level: "trace"}, err: ErrParse},
+		{name: "rotation for stdout", opts: LogOptions{MaxSize: 10}, err: ErrParse},
+		{name: "negative max age", opts: LogOptions{Output: "smerge.log", MaxAge: Duration(-time.Hour)}, err: ErrParse},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.Validate()
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tc.opts != tc.expected {
+				t.Errorf("got %+v, want %+v", tc.opts, tc.expected)
+			}
+		})
+	}
+}
+
+func TestLogOptionsSlogLevel(t *testing.T) {
+	testCases := []struct {
+		level    string
+		debug    bool
+		expected slog.Level
+	}{
+		{expected: slog.LevelInfo},
+		{debug: true, expected: slog.LevelDebug},
+		{level: "error", debug: true, expected: slog.LevelError},
+		{level: "debug", expected: slog.LevelDebug},
+	}
+
+	for _, tc := range testCases {
+		opts := LogOptions{Level: tc.level}
+		if level := opts.SlogLevel(tc.debug); level != tc.expected {
+			t.Errorf("level %q debug %v: got %v, want %v", tc.level, tc.debug, level, tc.expected)
+		}
+	}
+}
+
+func TestConfig_ValidateLogOutputs(t *testing.T) {
+	testCases := []struct {
+		name      string
+		log       string
+		accessLog string
+		err       error
+	}{
+		{name: "disabled access log", log: "app.log"},
+		{name: "stdout", log: LogStdout, accessLog: LogStdout},
+		{name: "different files", log: "/var/log/smerge/app.log", accessLog: "/var/log/smerge/access.log"},
+		{name: "same file", log: "/var/log/smerge.log", accessLog: "/var/log/smerge.log", err: ErrDuplicate},
+		{name: "same cleaned file", log: "logs/smerge.log", accessLog: "./logs//smerge.log", err: ErrDuplicate},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{Log: LogOptions{Output: tc.log}, AccessLog: AccessLogOptions{Output: tc.accessLog}}
+
+			if err := c.validateLogOutputs(); !errors.Is(err, tc.err) {
+				t.Errorf("unexpected error: %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateProxies(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		proxies []netip.Prefix
+		unix    bool
+		err     error
+	}{
+		{name: "empty", proxies: []netip.Prefix{}},
+		{
+			name:    "networks",
+			values:  []string{"127.0.0.1", "10.0.0.0/8"},
+			proxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("10.0.0.0/8")},
+		},
+		{
+			name:    "unix",
+			values:  []string{TrustedUnix, "::1"},
+			proxies: []netip.Prefix{netip.MustParsePrefix("::1/128")},
+			unix:    true,
+		},
+		{name: "invalid", values: []string{TrustedUnix, "localhost"}, err: ErrParse},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{TrustedProxies: tc.values}
+
+			err := c.validateProxies()
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(c.Proxies(), tc.proxies) || c.UnixTrusted() != tc.unix {
+				t.Errorf("got proxies %v and unix %v, want %v and %v", c.Proxies(), c.UnixTrusted(), tc.proxies, tc.unix)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateListeners(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    Config
+		listeners []string
+		mode      os.FileMode
+		err       error
+	}{
+		{
+			name:      "host and port",
+			config:    Config{Host: "localhost", Port: 43210},
+			listeners: []string{"localhost:43210"},
+			mode:      0o660,
+		},
+		{
+			name: "several listeners",
+			config: Config{
+				Listen:     []string{"0.0.0.0:80", "unix:/run/smerge/main.sock"},
+				SocketMode: "0600",
+				Admin:      AdminOptions{Listen: "unix:/run/smerge/admin.sock"},
+			},
+			listeners: []string{"0.0.0.0:80", "unix:/run/smerge/main.sock"},
+			mode:      0o600,
+		},
+		{
+			name:      "systemd names",
+			config:    Config{Listen: []string{"systemd:web"}, Admin: AdminOptions{Listen: "systemd:admin"}},
+			listeners: []string{"systemd:web"},
+			mode:      0o660,
+		},
+		{name: "invalid address", config: Config{Listen: []string{"localhost"}}, err: ErrParse},
+		{name: "empty unix path", config: Config{Listen: []string{"unix:"}}, err: ErrParse},
+		{name: "empty systemd name", config: Config{Listen: []string{"systemd:"}}, err: ErrParse},
+		{
+			name:   "duplicated admin address",
+			config: Config{Listen: []string{"unix:/tmp/a.sock"}, Admin: AdminOptions{Listen: "unix:/tmp/a.sock"}},
+			err:    ErrDuplicate,
+		},
+		{
+			name:   "all and named systemd sockets",
+			config: Config{Listen: []string{"systemd"}, Admin: AdminOptions{Listen: "systemd:admin"}},
+			err:    ErrParse,
+		},
+		{name: "invalid socket mode", config: Config{Listen: []string{"unix:/a.sock"}, SocketMode: "0999"}, err: ErrParse},
+		{name: "too big socket mode", config: Config{Listen: []string{"unix:/a.sock"}, SocketMode: "01777"}, err: ErrParse},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.validateListeners()
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if listeners := tc.config.Listeners(); !slices.Equal(listeners, tc.listeners) {
+				t.Errorf("got listeners %q, want %q", listeners, tc.listeners)
+			}
+
+			if mode := tc.config.SocketFileMode(); mode != tc.mode {
+				t.Errorf("got socket mode %v, want %v", mode, tc.mode)
+			}
+		})
+	}
+}
+
+func TestAccessLogOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     AccessLogOptions
+		expected AccessLogOptions
+		err      error
+	}{
+		{name: "disabled"},
+		{name: "disabled with unknown format", opts: AccessLogOptions{Format: "xml"}, expected: AccessLogOptions{Format: "xml"}},
+		{
+			name:     "default format",
+			opts:     AccessLogOptions{Output: LogStdout, DebugRequests: true},
+			expected: AccessLogOptions{Output: LogStdout, Format: AccessLogCombined, DebugRequests: true},
+		},
+		{
+			name:     "json file",
+			opts:     AccessLogOptions{Output: "/var/log/access.log", Format: AccessLogJSON, MaxSize: 100, MaxBackups: 5},
+			expected: AccessLogOptions{Output: "/var/log/access.log", Format: AccessLogJSON, MaxSize: 100, MaxBackups: 5},
+		},
+		{name: "unknown format", opts: AccessLogOptions{Output: LogStdout, Format: "common"}, err: ErrParse},
+		{name: "rotation for stderr", opts: AccessLogOptions{Output: LogStderr, MaxBackups: 1}, err: ErrParse},
+		{name: "negative max age", opts: AccessLogOptions{Output: "access.log", MaxAge: Duration(-time.Hour)}, err: ErrParse},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.Validate()
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tc.opts != tc.expected {
+				t.Errorf("got %+v, want %+v", tc.opts, tc.expected)
+			}
+		})
+	}
+}
+
+func TestLimitOptionsValidate_Exclude(t *testing.T) {
+	testCases := []struct {
+		name     string
+		exclude  []string
+		expected []netip.Prefix
+		errMsg   string
+	}{
+		{name: "empty", expected: []netip.Prefix{}},
+		{
+			name:    "IPs and networks",
+			exclude: []string{"127.0.0.1", "10.1.2.3/24", "2001:db8::/64", "::ffff:192.168.1.1"},
+			expected: []netip.Prefix{
+				netip.MustParsePrefix("127.0.0.1/32"),
+				netip.MustParsePrefix("10.1.2.0/24"),
+				netip.MustParsePrefix("2001:db8::/64"),
+				netip.MustParsePrefix("192.168.1.1/32"),
+			},
+		},
+		{name: "invalid IP", exclude: []string{"127.0.0.1", "localhost"}, errMsg: `address [1] "localhost"`},
+		{name: "invalid network", exclude: []string{"10.0.0.0/33"}, errMsg: `network [0] "10.0.0.0/33"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := LimitOptions{
+				MaxConcurrent: 1,
+				Interval:      Duration(time.Second),
+				CleanInterval: Duration(time.Minute),
+				Exclude:       tc.exclude,
+			}
+
+			err := opts.Validate()
+			if tc.errMsg != "" {
+				if !errors.Is(err, ErrParse) || !strings.Contains(err.Error(), tc.errMsg) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if excluded := opts.Excluded(); !slices.Equal(excluded, tc.expected) {
+				t.Errorf("got %v, want %v", excluded, tc.expected)
+			}
+		})
+	}
+}
+
+func TestLimitOptionsValidate_Keys(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     LimitOptions
+		expected LimitOptions
+		errMsg   string
+	}{
+		{
+			name:     "defaults",
+			expected: LimitOptions{IPv4Prefix: 32, IPv6Prefix: 64, MaxBuckets: 100_000},
+		},
+		{
+			name:     "custom",
+			opts:     LimitOptions{IPv4Prefix: 24, IPv6Prefix: 48, MaxBuckets: 10},
+			expected: LimitOptions{IPv4Prefix: 24, IPv6Prefix: 48, MaxBuckets: 10},
+		},
+		{name: "invalid IPv4 prefix", opts: LimitOptions{IPv4Prefix: 33}, errMsg: "ipv4 prefix 33"},
+		{name: "invalid IPv6 prefix", opts: LimitOptions{IPv6Prefix: 129}, errMsg: "ipv6 prefix 129"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.MaxConcurrent = 1
+			opts.Interval = Duration(time.Second)
+			opts.CleanInterval = Duration(time.Minute)
+
+			err := opts.Validate()
+			if tc.errMsg != "" {
+				if !errors.Is(err, ErrParse) || !strings.Contains(err.Error(), tc.errMsg) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if opts.IPv4Prefix != tc.expected.IPv4Prefix || opts.IPv6Prefix != tc.expected.IPv6Prefix ||
+				opts.MaxBuckets != tc.expected.MaxBuckets {
+				t.Errorf("got %+v, want %+v", opts, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRatePolicyValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy *RatePolicy
+		err    error
+	}{
+		{name: "nil"},
+		{name: "valid", policy: &RatePolicy{Rate: 1, Burst: 1, Interval: Duration(10 * time.Minute)}},
+		{name: "no limit", policy: &RatePolicy{Interval: Duration(time.Minute)}},
+		{name: "negative rate", policy: &RatePolicy{Rate: -1, Burst: 1, Interval: Duration(time.Minute)}, err: ErrParse},
+		{name: "negative burst", policy: &RatePolicy{Rate: 1, Burst: -1, Interval: Duration(time.Minute)}, err: ErrParse},
+		{name: "no interval", policy: &RatePolicy{Rate: 1, Burst: 1}, err: ErrRequiredField},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.policy.Validate()
+
+			if tc.err == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected error %v, got %v", tc.err, err)
+			}
+		})
+	}
+
+	group := Group{
+		Name:       "test",
+		Static:     []string{"ss://a"},
+		Period:     Duration(time.Hour),
+		ForceLimit: &RatePolicy{Rate: 1},
+	}
+	err := group.Validate("")
+	if !errors.Is(err, ErrRequiredField) || !strings.Contains(err.Error(), `group "test" force limit`) {
+		t.Errorf("unexpected group error: %v", err)
+	}
+
+	limits := LimitOptions{
+		MaxConcurrent: 1,
+		Interval:      Duration(time.Second),
+		CleanInterval: Duration(time.Minute),
+		Force:         &RatePolicy{Rate: 1, Burst: 1},
+	}
+	if err := limits.Validate(); !errors.Is(err, ErrRequiredField) || !strings.Contains(err.Error(), "limiter force") {
+		t.Errorf("unexpected limiter error: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package cfg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ErrUnknownGroup is an error of a missing group.
+var ErrUnknownGroup = errors.New("unknown group")
+
+// Overlay is a set of groups changed by the management API, it's applied over the configuration file groups.
+type Overlay struct {
+	Groups  []Group  `json:"groups"`  // added or replaced groups
+	Removed []string `json:"removed"` // names of removed groups of the configuration file
+}
+
+// apply returns the base groups with the overlay changes.
+// Replaced groups keep their positions, added groups are appended.
+func (o *Overlay) apply(base []Group) []Group {
+	var (
+		groups = make([]Group, 0, len(base)+len(o.Groups))
+		known  = make(map[string]struct{}, len(base))
+	)
+
+	for _, group := range base {
+		known[group.Name] = struct{}{}
+
+		if slices.Contains(o.Removed, group.Name) {
+			continue
+		}
+
+		if i := slices.IndexFunc(o.Groups, func(g Group) bool { return g.Name == group.Name }); i >= 0 {
+			group = o.Groups[i]
+		}
+
+		groups = append(groups, group)
+	}
+
+	for _, group := range o.Groups {
+		if _, ok := known[group.Name]; !ok {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups
+}
+
+// clone returns a copy of the overlay, groups' subscriptions are not copied.
+func (o *Overlay) clone() Overlay {
+	return Overlay{Groups: slices.Clone(o.Groups), Removed: slices.Clone(o.Removed)}
+}
+
+// OverlayPath returns the full path of the overlay file.
+func (c *Config) OverlayPath() string {
+	return filepath.Join(c.Root, c.Overlay)
+}
+
+// CurrentOverlay returns a copy of the current overlay.
+func (c *Config) CurrentOverlay() Overlay {
+	return c.overlay.clone()
+}
+
+// loadOverlay reads the overlay file and applies it to the configuration groups.
+// A missing file is an empty overlay. It's called before validation, so the default file name is used here too.
+func (c *Config) loadOverlay() error {
+	c.base = c.Groups
+
+	if c.Root == "" {
+		return nil
+	}
+
+	if c.Overlay == "" {
+		c.Overlay = defaultOverlay
+	}
+
+	if !filepath.IsLocal(c.Overlay) {
+		return errors.Join(ErrParse, fmt.Errorf("overlay file %q is out of root", c.Overlay))
+	}
+
+	data, err := os.ReadFile(c.OverlayPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read overlay: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &c.overlay); err != nil {
+		return errors.Join(ErrParse, fmt.Errorf("unmarshal overlay: %w", err))
+	}
+
+	c.Groups = c.overlay.apply(c.base)
+	return nil
+}
+
+// withOverlay returns a validated copy of the configuration with the new overlay.
+// Validation sets default values and compiles format rules, so it changes only deep copies
+// and doesn't race with requests using the current configuration.
+func (c *Config) withOverlay(overlay Overlay) (*Config, error) {
+	config := c.clone()
+	config.overlay = overlay
+	config.Groups = cloneGroups(overlay.apply(c.base))
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// clone returns a copy of the configuration with copied slices, maps and pointers.
+func (c *Config) clone() Config {
+	config := *c
+
+	config.Listen = slices.Clone(c.Listen)
+	config.TrustedProxies = slices.Clone(c.TrustedProxies)
+	config.Retry.Statuses = slices.Clone(c.Retry.Statuses)
+	config.Limiter.Exclude = slices.Clone(c.Limiter.Exclude)
+	config.Limiter.Force = clonePointer(c.Limiter.Force)
+	config.Admin.Editors = slices.Clone(c.Admin.Editors)
+	config.Tokens = maps.Clone(c.Tokens)
+	config.FormatRules = slices.Clone(c.FormatRules)
+	config.Users = slices.Clone(c.Users)
+	config.base = cloneGroups(c.base)
+
+	for name, tokens := range config.Tokens {
+		config.Tokens[name] = slices.Clone(tokens)
+	}
+
+	for i := range config.Users {
+		config.Users[i].Groups = slices.Clone(config.Users[i].Groups)
+	}
+
+	return config
+}
+
+// cloneGroups returns copies of groups with their subscriptions.
+func cloneGroups(groups []Group) []Group {
+	groups = slices.Clone(groups)
+
+	for i := range groups {
+		group := &groups[i]
+		group.Static = slices.Clone(group.Static)
+		group.Tokens = slices.Clone(group.Tokens)
+		group.Limit = clonePointer(group.Limit)
+		group.ForceLimit = clonePointer(group.ForceLimit)
+		group.Subscriptions = slices.Clone(group.Subscriptions)
+
+		for j := range group.Subscriptions {
+			sub := &group.Subscriptions[j]
+			sub.HasPrefixes = slices.Clone(sub.HasPrefixes)
+			sub.Inline = slices.Clone(sub.Inline)
+
+			if sub.Retry = clonePointer(sub.Retry); sub.Retry != nil {
+				sub.Retry.Statuses = slices.Clone(sub.Retry.Statuses)
+			}
+		}
+	}
+
+	return groups
+}
+
+// clonePointer returns a pointer to a copy of the value, nil is kept.
+func clonePointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+
+	value := *p
+	return &value
+}
+
+// Group returns a copy of the group by its name, its subscriptions are copied too.
+func (c *Config) Group(name string) (Group, bool) {
+	i := slices.IndexFunc(c.Groups, func(g Group) bool { return g.Name == name })
+	if i < 0 {
+		return Group{}, false
+	}
+
+	group := c.Groups[i]
+	group.Subscriptions = slices.Clone(group.Subscriptions)
+
+	return group, true
+}
+
+// WithGroup returns a validated copy of the configuration with the added or replaced group.
+func (c *Config) WithGroup(group Group) (*Config, error) {
+	overlay := c.overlay.clone()
+	overlay.Removed = slices.DeleteFunc(overlay.Removed, func(name string) bool { return name == group.Name })
+
+	if i := slices.IndexFunc(overlay.Groups, func(g Group) bool { return g.Name == group.Name }); i >= 0 {
+		overlay.Groups[i] = group
+	} else {
+		overlay.Groups = append(overlay.Groups, group)
+	}
+
+	return c.withOverlay(overlay)
+}
+
+// WithoutGroup returns a validated copy of the configuration without the group.
+func (c *Config) WithoutGroup(name string) (*Config, error) {
+	if _, ok := c.Group(name); !ok {
+		return nil, errors.Join(ErrUnknownGroup, fmt.Errorf("group %q", name))
+	}
+
+	overlay := c.overlay.clone()
+	overlay.Groups = slices.DeleteFunc(overlay.Groups, func(g Group) bool { return g.Name == name })
+
+	if slices.ContainsFunc(c.base, func(g Group) bool { return g.Name == name }) {
+		overlay.Removed = append(overlay.Removed, name)
+	}
+
+	return c.withOverlay(overlay)
+}
+
+// ActiveGroups returns copies of enabled groups without their disabled subscriptions.
+// A fallback of a disabled subscription becomes a main one.
+func (c *Config) ActiveGroups() []Group {
+	groups := make([]Group, 0, len(c.Groups))
+
+	for _, group := range c.Groups {
+		if group.Disabled {
+			continue
+		}
+
+		disabled := make(map[string]struct{})
+		for _, sub := range group.Subscriptions {
+			if sub.Disabled {
+				disabled[sub.Name] = struct{}{}
+			}
+		}
+
+		subscriptions := make([]Subscription, 0, len(group.Subscriptions)-len(disabled))
+		for _, sub := range group.Subscriptions {
+			if sub.Disabled {
+				continue
+			}
+
+			if _, ok := disabled[sub.FallbackFor]; ok {
+				sub.FallbackFor = ""
+			}
+			subscriptions = append(subscriptions, sub)
+		}
+
+		group.Subscriptions = subscriptions
+		groups = append(groups, group)
+	}
+
+	return groups
+}
@@ -0,0 +1,199 @@
+package cfg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const overlayConfigContent = `{
+  "host": "localhost",
+  "port": 43210,
+  "timeout": "10s",
+  "user_agent": "SMerge/1.0",
+  "retries": 3,
+  "root": %q,
+  "limiter": {"max_concurrent": 10, "interval": "1s", "clean_interval": "1m"},
+  "users": [{"name": "alice", "token": "alice12345", "groups": ["group2"]}],
+  "groups": [
+    {"name": "group1", "endpoint": "/group1", "period": "1h", "static": ["ss://a"]},
+    {"name": "group2", "endpoint": "/group2", "period": "1h", "static": ["ss://b"]},
+    {"name": "group3", "endpoint": "/group3", "period": "1h", "static": ["ss://c"]}
+  ]
+}`
+
+// groupNames returns names of groups.
+func groupNames(groups []Group) []string {
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	return names
+}
+
+func TestNew_Overlay(t *testing.T) {
+	var (
+		root        = t.TempDir()
+		configFile  = filepath.Join(root, "config.json")
+		overlayFile = filepath.Join(root, defaultOverlay)
+		overlay     = `{
+  "groups": [
+    {"name": "group2", "endpoint": "/group2", "period": "2h", "static": ["ss://d"]},
+    {"name": "group4", "endpoint": "/group4", "period": "1h", "static": ["ss://e"]}
+  ],
+  "removed": ["group1"]
+}`
+	)
+
+	if err := os.WriteFile(configFile, fmt.Appendf(nil, overlayConfigContent, root), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(overlayFile, []byte(overlay), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := groupNames(config.Groups); !slices.Equal(names, []string{"group2", "group3", "group4"}) {
+		t.Errorf("unexpected groups %v", names)
+	}
+
+	if group, _ := config.Group("group2"); group.Period != Duration(2*3600e9) {
+		t.Errorf("group2 is not replaced: %+v", group)
+	}
+
+	if config.OverlayPath() != overlayFile {
+		t.Errorf("unexpected overlay path %q", config.OverlayPath())
+	}
+
+	// invalid overlay group
+	if err = os.WriteFile(overlayFile, []byte(`{"groups": [{"name": "group5", "period": "1h"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = New(configFile); !errors.Is(err, ErrRequiredField) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if err = os.WriteFile(overlayFile, []byte(`{"groups": `), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = New(configFile); !errors.Is(err, ErrParse) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestConfig_WithGroup(t *testing.T) {
+	root := t.TempDir()
+	configFile := filepath.Join(root, "config.json")
+
+	if err := os.WriteFile(configFile, fmt.Appendf(nil, overlayConfigContent, root), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := config.WithoutGroup("group1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := groupNames(removed.Groups); !slices.Equal(names, []string{"group2", "group3"}) {
+		t.Errorf("unexpected groups %v", names)
+	}
+
+	if names := groupNames(config.Groups); len(names) != 3 {
+		t.Errorf("source configuration is changed: %v", names)
+	}
+
+	group := Group{Name: "group1", Endpoint: "/new1", Period: Duration(3600e9), Static: []string{"ss://f"}}
+	added, err := removed.WithGroup(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := groupNames(added.Groups); !slices.Equal(names, []string{"group1", "group2", "group3"}) {
+		t.Errorf("unexpected groups %v", names)
+	}
+
+	overlay := added.CurrentOverlay()
+	if len(overlay.Removed) != 0 || len(overlay.Groups) != 1 || overlay.Groups[0].Endpoint != "/new1" {
+		t.Errorf("unexpected overlay %+v", overlay)
+	}
+
+	errCases := []struct {
+		name string
+		fn   func() (*Config, error)
+		err  error
+	}{
+		{name: "unknown group", fn: func() (*Config, error) { return config.WithoutGroup("group5") }, err: ErrUnknownGroup},
+		{name: "user group", fn: func() (*Config, error) { return config.WithoutGroup("group2") }, err: ErrRequiredField},
+		{
+			name: "invalid group",
+			fn:   func() (*Config, error) { return config.WithGroup(Group{Name: "group5", Period: Duration(3600e9)}) },
+			err:  ErrRequiredField,
+		},
+		{
+			name: "duplicated endpoint",
+			fn: func() (*Config, error) {
+				return config.WithGroup(Group{Name: "group5", Endpoint: "/group1", Period: Duration(3600e9), Static: []string{"ss://a"}})
+			},
+			err: ErrDuplicate,
+		},
+	}
+
+	for _, tc := range errCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.fn(); !errors.Is(err, tc.err) {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestConfig_ActiveGroups(t *testing.T) {
+	config := &Config{
+		Groups: []Group{
+			{Name: "group1", Disabled: true},
+			{
+				Name: "group2",
+				Subscriptions: []Subscription{
+					{Name: "sub1", Disabled: true},
+					{Name: "sub2", FallbackFor: "sub1"},
+					{Name: "sub3", FallbackFor: "sub2"},
+				},
+			},
+		},
+	}
+
+	groups := config.ActiveGroups()
+	if names := groupNames(groups); !slices.Equal(names, []string{"group2"}) {
+		t.Fatalf("unexpected groups %v", names)
+	}
+
+	expected := []Subscription{{Name: "sub2"}, {Name: "sub3", FallbackFor: "sub2"}}
+	if !slices.EqualFunc(groups[0].Subscriptions, expected, func(a, b Subscription) bool {
+		return a.Name == b.Name && a.FallbackFor == b.FallbackFor
+	}) {
+		t.Errorf("unexpected subscriptions %+v", groups[0].Subscriptions)
+	}
+
+	if config.Groups[1].Subscriptions[1].FallbackFor != "sub1" {
+		t.Error("source configuration is changed")
+	}
+
+	if endpoints := config.GroupsEndpoints(); len(endpoints) != 1 {
+		t.Errorf("unexpected endpoints %v", endpoints)
+	}
+}
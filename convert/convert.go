@@ -0,0 +1,403 @@
+// Package convert converts proxy URIs to Clash Meta and sing-box client configurations
+// without external dependencies.
+package convert
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Proxy types.
+const (
+	TypeShadowsocks = "shadowsocks"
+	TypeVMess       = "vmess"
+	TypeVLESS       = "vless"
+	TypeTrojan      = "trojan"
+	TypeHysteria2   = "hysteria2"
+)
+
+// Transport networks, an empty one is a raw TCP connection.
+const (
+	NetworkWS   = "ws"
+	NetworkGRPC = "grpc"
+	NetworkH2   = "h2"
+)
+
+var (
+	// ErrUnsupported is an error of an unknown URI scheme or proxy option.
+	ErrUnsupported = errors.New("unsupported proxy")
+	// ErrInvalid is an error of a malformed proxy URI.
+	ErrInvalid = errors.New("invalid proxy")
+)
+
+// reservedNames are names of outbounds and groups added to configurations, proxies can't use them.
+var reservedNames = []string{"DIRECT", "REJECT", "PROXY", "direct", "proxy"}
+
+// Proxy is a proxy server parsed from its URI.
+type Proxy struct {
+	Name         string
+	Type         string
+	Server       string
+	Port         int
+	UUID         string // vmess and vless user ID
+	Password     string // shadowsocks, trojan and hysteria2 password
+	Cipher       string // shadowsocks method or vmess security
+	AlterID      int
+	Flow         string
+	Network      string // transport network
+	Path         string // ws and h2 path or grpc service name
+	Host         string // ws and h2 host
+	TLS          bool
+	SNI          string
+	Insecure     bool
+	Fingerprint  string
+	ALPN         []string
+	PublicKey    string // reality public key
+	ShortID      string // reality short ID
+	Obfs         string // hysteria2 obfuscation type
+	ObfsPassword string
+}
+
+// Parse returns a proxy of the URI, supported schemes are
+// ss, vmess, vless, trojan and hysteria2 (hy2). Errors don't contain URIs, because they have credentials.
+func Parse(uri string) (*Proxy, error) {
+	scheme, _, ok := strings.Cut(uri, "://")
+	if !ok {
+		return nil, errors.Join(ErrInvalid, errors.New("no scheme"))
+	}
+
+	switch strings.ToLower(scheme) {
+	case "ss":
+		return parseShadowsocks(uri)
+	case "vmess":
+		return parseVMess(uri)
+	case "vless":
+		return parseURL(uri, TypeVLESS)
+	case "trojan":
+		return parseURL(uri, TypeTrojan)
+	case "hysteria2", "hy2":
+		return parseURL(uri, TypeHysteria2)
+	default:
+		return nil, errors.Join(ErrUnsupported, fmt.Errorf("scheme %q", scheme))
+	}
+}
+
+// ParseList returns proxies of URIs separated by new lines and a number of skipped invalid or unsupported ones.
+// Proxies get unique names, a missing name is made of the type and the address.
+func ParseList(data []byte) ([]*Proxy, int) {
+	var (
+		proxies []*Proxy
+		skipped int
+		names   = make(map[string]struct{}, len(reservedNames))
+	)
+
+	for _, name := range reservedNames {
+		names[name] = struct{}{}
+	}
+
+	for line := range bytes.Lines(data) {
+		uri := string(bytes.TrimSpace(line))
+		if uri == "" {
+			continue
+		}
+
+		proxy, err := Parse(uri)
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		proxy.Name = uniqueName(names, proxy)
+		proxies = append(proxies, proxy)
+	}
+
+	return proxies, skipped
+}
+
+// uniqueName returns a name of the proxy which is not in names and adds it there.
+func uniqueName(names map[string]struct{}, proxy *Proxy) string {
+	name := strings.TrimSpace(proxy.Name)
+	if name == "" {
+		name = proxy.Type + " " + net.JoinHostPort(proxy.Server, strconv.Itoa(proxy.Port))
+	}
+
+	unique := name
+	for i := 2; ; i++ {
+		if _, ok := names[unique]; !ok {
+			break
+		}
+		unique = name + " " + strconv.Itoa(i)
+	}
+
+	names[unique] = struct{}{}
+	return unique
+}
+
+// parseShadowsocks parses SIP002 URIs "ss://userinfo@host:port#name", where userinfo is
+// base64 encoded or percent-encoded "method:password", and legacy ones "ss://base64(method:password@host:port)#name".
+func parseShadowsocks(uri string) (*Proxy, error) {
+	rest := uri[len("ss://"):]
+	rest, fragment, _ := strings.Cut(rest, "#")
+	rest, rawQuery, _ := strings.Cut(rest, "?")
+
+	if query, err := url.ParseQuery(rawQuery); err != nil || query.Has("plugin") {
+		return nil, errors.Join(ErrUnsupported, errors.New("shadowsocks plugin"))
+	}
+
+	var userinfo, hostport string
+	if i := strings.LastIndexByte(rest, '@'); i >= 0 {
+		userinfo, hostport = rest[:i], rest[i+1:]
+
+		if decoded, err := decodeBase64(userinfo); err == nil && bytes.IndexByte(decoded, ':') > 0 {
+			userinfo = string(decoded)
+		} else if userinfo, err = url.PathUnescape(userinfo); err != nil {
+			return nil, errors.Join(ErrInvalid, errors.New("shadowsocks user info"))
+		}
+	} else {
+		decoded, err := decodeBase64(rest)
+		if err != nil {
+			return nil, errors.Join(ErrInvalid, errors.New("shadowsocks encoding"))
+		}
+
+		i := bytes.LastIndexByte(decoded, '@')
+		if i < 0 {
+			return nil, errors.Join(ErrInvalid, errors.New("shadowsocks address"))
+		}
+		userinfo, hostport = string(decoded[:i]), string(decoded[i+1:])
+	}
+
+	method, password, ok := strings.Cut(userinfo, ":")
+	if !ok || method == "" {
+		return nil, errors.Join(ErrInvalid, errors.New("shadowsocks method"))
+	}
+
+	server, port, err := splitHostPort(strings.TrimSuffix(hostport, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := url.PathUnescape(fragment)
+	if err != nil {
+		name = fragment
+	}
+
+	return &Proxy{Name: name, Type: TypeShadowsocks, Server: server, Port: port, Cipher: method, Password: password}, nil
+}
+
+// flexInt is an integer which can be a JSON number or a string, an empty string is zero.
+type flexInt int
+
+// UnmarshalJSON decodes a number or a string with a number.
+func (f *flexInt) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*f = 0
+		return nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+
+	*f = flexInt(n)
+	return nil
+}
+
+// vmessLink is a base64 encoded JSON of vmess URIs.
+type vmessLink struct {
+	Name        string  `json:"ps"`
+	Server      string  `json:"add"`
+	Port        flexInt `json:"port"`
+	UUID        string  `json:"id"`
+	AlterID     flexInt `json:"aid"`
+	Security    string  `json:"scy"`
+	Network     string  `json:"net"`
+	Type        string  `json:"type"`
+	Host        string  `json:"host"`
+	Path        string  `json:"path"`
+	TLS         string  `json:"tls"`
+	SNI         string  `json:"sni"`
+	ALPN        string  `json:"alpn"`
+	Fingerprint string  `json:"fp"`
+}
+
+// parseVMess parses URIs "vmess://base64(json)".
+func parseVMess(uri string) (*Proxy, error) {
+	data, err := decodeBase64(uri[len("vmess://"):])
+	if err != nil {
+		return nil, errors.Join(ErrInvalid, errors.New("vmess encoding"))
+	}
+
+	var link vmessLink
+	if err = json.Unmarshal(data, &link); err != nil {
+		return nil, errors.Join(ErrInvalid, fmt.Errorf("vmess data: %w", err))
+	}
+
+	if link.Server == "" || link.UUID == "" || link.Port <= 0 || link.Port > 65535 {
+		return nil, errors.Join(ErrInvalid, errors.New("vmess address or user ID"))
+	}
+
+	proxy := &Proxy{
+		Name:        link.Name,
+		Type:        TypeVMess,
+		Server:      link.Server,
+		Port:        int(link.Port),
+		UUID:        link.UUID,
+		AlterID:     int(link.AlterID),
+		Cipher:      link.Security,
+		TLS:         link.TLS == "tls",
+		SNI:         link.SNI,
+		Fingerprint: link.Fingerprint,
+		ALPN:        splitList(link.ALPN),
+	}
+
+	if link.Network == "tcp" && link.Type != "" && link.Type != "none" {
+		return nil, errors.Join(ErrUnsupported, fmt.Errorf("vmess header type %q", link.Type))
+	}
+
+	if err = proxy.setTransport(link.Network, link.Path, link.Host, link.Path); err != nil {
+		return nil, err
+	}
+
+	return proxy, nil
+}
+
+// parseURL parses URIs "scheme://credentials@host:port?params#name" of vless, trojan and hysteria2 proxies.
+func parseURL(uri, proxyType string) (*Proxy, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, errors.Join(ErrInvalid, fmt.Errorf("%s URI", proxyType))
+	}
+
+	server, port, err := splitHostPort(u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := u.User.Username()
+	if password, ok := u.User.Password(); ok {
+		credentials += ":" + password
+	}
+
+	if credentials == "" {
+		return nil, errors.Join(ErrInvalid, fmt.Errorf("%s credentials", proxyType))
+	}
+
+	var (
+		query = u.Query()
+		proxy = &Proxy{
+			Name:        u.Fragment,
+			Type:        proxyType,
+			Server:      server,
+			Port:        port,
+			SNI:         query.Get("sni"),
+			Insecure:    parseBool(query.Get("allowInsecure")) || parseBool(query.Get("insecure")),
+			Fingerprint: query.Get("fp"),
+			ALPN:        splitList(query.Get("alpn")),
+		}
+	)
+
+	if proxy.SNI == "" {
+		proxy.SNI = query.Get("peer")
+	}
+
+	switch proxyType {
+	case TypeVLESS:
+		if encryption := query.Get("encryption"); encryption != "" && encryption != "none" {
+			return nil, errors.Join(ErrUnsupported, fmt.Errorf("vless encryption %q", encryption))
+		}
+		proxy.UUID, proxy.Flow = credentials, query.Get("flow")
+	case TypeHysteria2:
+		// hysteria2 always uses TLS and has no transports
+		proxy.Password, proxy.TLS = credentials, true
+		proxy.Obfs, proxy.ObfsPassword = query.Get("obfs"), query.Get("obfs-password")
+		return proxy, nil
+	default:
+		proxy.Password, proxy.TLS = credentials, true
+	}
+
+	switch security := query.Get("security"); security {
+	case "", "none":
+	case "tls":
+		proxy.TLS = true
+	case "reality":
+		proxy.TLS, proxy.PublicKey, proxy.ShortID = true, query.Get("pbk"), query.Get("sid")
+	default:
+		return nil, errors.Join(ErrUnsupported, fmt.Errorf("%s security %q", proxyType, security))
+	}
+
+	err = proxy.setTransport(query.Get("type"), query.Get("path"), query.Get("host"), query.Get("serviceName"))
+	if err != nil {
+		return nil, err
+	}
+
+	return proxy, nil
+}
+
+// setTransport sets the transport network with its path and host, gRPC uses the service name as a path.
+func (p *Proxy) setTransport(network, path, host, serviceName string) error {
+	switch network {
+	case "", "tcp":
+	case NetworkWS:
+		p.Network, p.Path, p.Host = NetworkWS, path, host
+	case NetworkGRPC:
+		p.Network, p.Path = NetworkGRPC, serviceName
+	case NetworkH2, "http":
+		p.Network, p.Path, p.Host = NetworkH2, path, host
+	default:
+		return errors.Join(ErrUnsupported, fmt.Errorf("%s network %q", p.Type, network))
+	}
+
+	return nil
+}
+
+// splitHostPort returns the host and the port of the address, the port is required.
+func splitHostPort(hostport string) (string, int, error) {
+	host, rawPort, err := net.SplitHostPort(hostport)
+	if err != nil || host == "" {
+		return "", 0, errors.Join(ErrInvalid, errors.New("address"))
+	}
+
+	port, err := strconv.Atoi(rawPort)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, errors.Join(ErrInvalid, fmt.Errorf("port %q", rawPort))
+	}
+
+	return host, port, nil
+}
+
+// decodeBase64 decodes a standard or URL base64 string with or without padding.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+
+	if strings.ContainsAny(s, "-_") {
+		return base64.RawURLEncoding.DecodeString(s)
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// splitList returns non-empty comma separated values.
+func splitList(s string) []string {
+	var values []string
+
+	for value := range strings.SplitSeq(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// parseBool returns true for "1" and "true" values.
+func parseBool(s string) bool {
+	return s == "1" || strings.EqualFold(s, "true")
+}
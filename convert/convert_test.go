@@ -0,0 +1,128 @@
+package convert
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	vmess := base64.StdEncoding.EncodeToString([]byte(
+		`{"v":"2","ps":"vm","add":"v.example.com","port":"443","id":"uuid-1","aid":"","scy":"aes-128-gcm",` +
+			`"net":"ws","path":"/ws","host":"h.example.com","tls":"tls","sni":"s.example.com","alpn":"h2, http/1.1"}`,
+	))
+
+	tests := []struct {
+		name     string
+		uri      string
+		expected *Proxy
+		err      error
+	}{
+		{
+			name: "shadowsocks SIP002",
+			uri:  "ss://" + base64.RawURLEncoding.EncodeToString([]byte("aes-256-gcm:pass")) + "@1.2.3.4:8388/#ss%20one",
+			expected: &Proxy{
+				Name: "ss one", Type: TypeShadowsocks, Server: "1.2.3.4", Port: 8388, Cipher: "aes-256-gcm", Password: "pass",
+			},
+		},
+		{
+			name: "shadowsocks percent-encoded",
+			uri:  "ss://2022-blake3-aes-128-gcm:a2V5%3D@[2001:db8::1]:443",
+			expected: &Proxy{
+				Type: TypeShadowsocks, Server: "2001:db8::1", Port: 443, Cipher: "2022-blake3-aes-128-gcm", Password: "a2V5=",
+			},
+		},
+		{
+			name: "shadowsocks legacy",
+			uri:  "ss://" + base64.StdEncoding.EncodeToString([]byte("chacha20-ietf-poly1305:p@ss@example.com:80")) + "#legacy",
+			expected: &Proxy{
+				Name: "legacy", Type: TypeShadowsocks, Server: "example.com", Port: 80,
+				Cipher: "chacha20-ietf-poly1305", Password: "p@ss",
+			},
+		},
+		{name: "shadowsocks plugin", uri: "ss://YWVzLTI1Ni1nY206cGFzcw@1.2.3.4:8388/?plugin=obfs-local", err: ErrUnsupported},
+		{name: "shadowsocks without port", uri: "ss://YWVzLTI1Ni1nY206cGFzcw@1.2.3.4", err: ErrInvalid},
+		{
+			name: "vmess",
+			uri:  "vmess://" + vmess,
+			expected: &Proxy{
+				Name: "vm", Type: TypeVMess, Server: "v.example.com", Port: 443, UUID: "uuid-1", Cipher: "aes-128-gcm",
+				Network: NetworkWS, Path: "/ws", Host: "h.example.com", TLS: true, SNI: "s.example.com",
+				ALPN: []string{"h2", "http/1.1"},
+			},
+		},
+		{name: "vmess invalid", uri: "vmess://e30", err: ErrInvalid},
+		{
+			name: "vless reality",
+			uri:  "vless://uuid-2@example.com:443?security=reality&pbk=key&sid=ab&fp=firefox&type=grpc&serviceName=svc#vl",
+			expected: &Proxy{
+				Name: "vl", Type: TypeVLESS, Server: "example.com", Port: 443, UUID: "uuid-2", TLS: true,
+				Fingerprint: "firefox", PublicKey: "key", ShortID: "ab", Network: NetworkGRPC, Path: "svc",
+			},
+		},
+		{name: "vless unknown network", uri: "vless://uuid-2@example.com:443?type=kcp", err: ErrUnsupported},
+		{
+			name: "trojan",
+			uri:  "trojan://pw@example.com:443?peer=sni.example.com&allowInsecure=1&type=ws&path=%2Fws",
+			expected: &Proxy{
+				Type: TypeTrojan, Server: "example.com", Port: 443, Password: "pw", TLS: true,
+				SNI: "sni.example.com", Insecure: true, Network: NetworkWS, Path: "/ws",
+			},
+		},
+		{name: "trojan without password", uri: "trojan://example.com:443", err: ErrInvalid},
+		{
+			name: "hysteria2",
+			uri:  "hy2://user:pw@example.com:443?obfs=salamander&obfs-password=op&insecure=1#hy",
+			expected: &Proxy{
+				Name: "hy", Type: TypeHysteria2, Server: "example.com", Port: 443, Password: "user:pw", TLS: true,
+				Insecure: true, Obfs: "salamander", ObfsPassword: "op",
+			},
+		},
+		{name: "unknown scheme", uri: "tuic://uuid:pw@example.com:443", err: ErrUnsupported},
+		{name: "no scheme", uri: "example.com:443", err: ErrInvalid},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			proxy, err := Parse(tc.uri)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("expected error %v, got %v", tc.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(proxy, tc.expected) {
+				t.Errorf("got %+v, want %+v", proxy, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	data := []byte("trojan://pw@example.com:443#same\r\n\n" +
+		"tuic://uuid:pw@example.com:443\n" +
+		"trojan://pw@example.com:8443#same\n" +
+		"trojan://pw@example.com:443#PROXY\n" +
+		"trojan://pw@example.com:443\n")
+
+	proxies, skipped := ParseList(data)
+	if skipped != 1 {
+		t.Errorf("skipped %d URIs, want 1", skipped)
+	}
+
+	names := make([]string, 0, len(proxies))
+	for _, proxy := range proxies {
+		names = append(names, proxy.Name)
+	}
+
+	expected := []string{"same", "same 2", "PROXY 2", "trojan example.com:443"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("got names %q, want %q", names, expected)
+	}
+}
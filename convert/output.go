@@ -0,0 +1,326 @@
+package convert
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+const (
+	// clashGroup is a name of Clash selector group of all proxies.
+	clashGroup = "PROXY"
+	// singBoxSelector is a tag of sing-box selector outbound of all proxies.
+	singBoxSelector = "proxy"
+	// singBoxDirect is a tag of sing-box direct outbound.
+	singBoxDirect = "direct"
+	// defaultFingerprint is a uTLS fingerprint of sing-box reality outbounds without it.
+	defaultFingerprint = "chrome"
+)
+
+// clashTypes are Clash names of proxy types.
+var clashTypes = map[string]string{
+	TypeShadowsocks: "ss",
+	TypeVMess:       "vmess",
+	TypeVLESS:       "vless",
+	TypeTrojan:      "trojan",
+	TypeHysteria2:   "hysteria2",
+}
+
+// field is a key and a value of an ordered mapping.
+type field struct {
+	key   string
+	value any // string, int, bool, []string, mapping or []mapping
+}
+
+// mapping is an ordered mapping of configurations.
+type mapping []field
+
+// with returns the mapping with a new field, zero values are skipped.
+func (m mapping) with(key string, value any) mapping {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return m
+		}
+	case int:
+		if v == 0 {
+			return m
+		}
+	case bool:
+		if !v {
+			return m
+		}
+	case []string:
+		if len(v) == 0 {
+			return m
+		}
+	case mapping:
+		if len(v) == 0 {
+			return m
+		}
+	}
+
+	return append(m, field{key: key, value: value})
+}
+
+// MarshalJSON writes the mapping as a JSON object keeping the order of fields.
+func (m mapping) MarshalJSON() ([]byte, error) {
+	b := []byte{'{'}
+
+	for i, f := range m {
+		if i > 0 {
+			b = append(b, ',')
+		}
+
+		b = strconv.AppendQuote(b, f.key)
+		b = append(b, ':')
+
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, value...)
+	}
+
+	return append(b, '}'), nil
+}
+
+// appendYAML appends the mapping in YAML block style, the first field follows the prefix,
+// others follow the indent. Strings are double-quoted, Go escapes are valid in YAML.
+func appendYAML(b []byte, m mapping, prefix, indent string) []byte {
+	for i, f := range m {
+		if i == 0 {
+			b = append(b, prefix...)
+		} else {
+			b = append(b, indent...)
+		}
+		b = append(b, f.key+":"...)
+
+		switch v := f.value.(type) {
+		case string:
+			b = strconv.AppendQuote(append(b, ' '), v)
+		case int:
+			b = strconv.AppendInt(append(b, ' '), int64(v), 10)
+		case bool:
+			b = strconv.AppendBool(append(b, ' '), v)
+		case []string:
+			if len(v) == 0 {
+				b = append(b, " []"...)
+			}
+			for _, item := range v {
+				b = strconv.AppendQuote(append(b, "\n"+indent+"  - "...), item)
+			}
+		case mapping:
+			b = appendYAML(append(b, '\n'), v, indent+"  ", indent+"  ")
+			continue
+		case []mapping:
+			if len(v) == 0 {
+				b = append(b, " []"...)
+				break
+			}
+
+			b = append(b, '\n')
+			for _, item := range v {
+				b = appendYAML(b, item, indent+"  - ", indent+"    ")
+			}
+			continue
+		}
+
+		b = append(b, '\n')
+	}
+
+	return b
+}
+
+// Clash returns a Clash Meta configuration with proxies, a selector group "PROXY" of them
+// and a final rule using this group.
+func Clash(proxies []*Proxy) []byte {
+	var (
+		items = make([]mapping, 0, len(proxies))
+		names = make([]string, 0, len(proxies)+1)
+	)
+
+	for _, p := range proxies {
+		items = append(items, p.clash())
+		names = append(names, p.Name)
+	}
+
+	config := mapping{
+		{key: "proxies", value: items},
+		{key: "proxy-groups", value: []mapping{{
+			{key: "name", value: clashGroup},
+			{key: "type", value: "select"},
+			{key: "proxies", value: append(names, "DIRECT")},
+		}}},
+		{key: "rules", value: []string{"MATCH," + clashGroup}},
+	}
+
+	return appendYAML(nil, config, "", "")
+}
+
+// clash returns Clash fields of the proxy.
+func (p *Proxy) clash() mapping {
+	m := mapping{
+		{key: "name", value: p.Name},
+		{key: "type", value: clashTypes[p.Type]},
+		{key: "server", value: p.Server},
+		{key: "port", value: p.Port},
+	}
+
+	switch p.Type {
+	case TypeShadowsocks:
+		m = append(m, field{key: "cipher", value: p.Cipher}, field{key: "password", value: p.Password})
+		return m.with("udp", true)
+	case TypeVMess:
+		m = append(m,
+			field{key: "uuid", value: p.UUID},
+			field{key: "alterId", value: p.AlterID},
+			field{key: "cipher", value: valueOr(p.Cipher, "auto")},
+		)
+	case TypeVLESS:
+		m = m.with("uuid", p.UUID).with("flow", p.Flow)
+	case TypeTrojan:
+		m = m.with("password", p.Password)
+	case TypeHysteria2:
+		m = m.with("password", p.Password).with("obfs", p.Obfs).with("obfs-password", p.ObfsPassword)
+	}
+
+	if p.TLS {
+		sni := "servername"
+		if p.Type == TypeTrojan || p.Type == TypeHysteria2 {
+			sni = "sni"
+		} else {
+			m = m.with("tls", true)
+		}
+
+		reality := mapping{}.with("public-key", p.PublicKey).with("short-id", p.ShortID)
+		m = m.with(sni, p.SNI).
+			with("skip-cert-verify", p.Insecure).
+			with("alpn", p.ALPN).
+			with("client-fingerprint", p.Fingerprint).
+			with("reality-opts", reality)
+	}
+
+	switch p.Network {
+	case NetworkWS:
+		headers := mapping{}.with("Host", p.Host)
+		m = m.with("network", p.Network).with("ws-opts", mapping{}.with("path", p.Path).with("headers", headers))
+	case NetworkGRPC:
+		m = m.with("network", p.Network).with("grpc-opts", mapping{}.with("grpc-service-name", p.Path))
+	case NetworkH2:
+		m = m.with("network", p.Network).with("h2-opts", mapping{}.with("host", listOf(p.Host)).with("path", p.Path))
+	}
+
+	return m
+}
+
+// SingBox returns a sing-box configuration with outbounds of proxies, a selector "proxy" of them,
+// a direct outbound and a final route using the selector.
+func SingBox(proxies []*Proxy) []byte {
+	var (
+		outbounds = make([]mapping, 0, len(proxies)+2)
+		tags      = make([]string, 0, len(proxies)+1)
+	)
+
+	for _, p := range proxies {
+		tags = append(tags, p.Name)
+	}
+
+	outbounds = append(outbounds, mapping{
+		{key: "type", value: "selector"},
+		{key: "tag", value: singBoxSelector},
+		{key: "outbounds", value: append(tags, singBoxDirect)},
+	})
+
+	for _, p := range proxies {
+		outbounds = append(outbounds, p.singBox())
+	}
+
+	outbounds = append(outbounds, mapping{{key: "type", value: "direct"}, {key: "tag", value: singBoxDirect}})
+	config := mapping{
+		{key: "outbounds", value: outbounds},
+		{key: "route", value: mapping{{key: "final", value: singBoxSelector}}},
+	}
+
+	// values are only strings, numbers and booleans, so there are no errors
+	data, _ := json.MarshalIndent(config, "", "  ")
+	return append(data, '\n')
+}
+
+// singBox returns sing-box outbound fields of the proxy.
+func (p *Proxy) singBox() mapping {
+	m := mapping{
+		{key: "type", value: p.Type},
+		{key: "tag", value: p.Name},
+		{key: "server", value: p.Server},
+		{key: "server_port", value: p.Port},
+	}
+
+	switch p.Type {
+	case TypeShadowsocks:
+		m = append(m, field{key: "method", value: p.Cipher}, field{key: "password", value: p.Password})
+	case TypeVMess:
+		m = m.with("uuid", p.UUID).with("security", valueOr(p.Cipher, "auto")).with("alter_id", p.AlterID)
+	case TypeVLESS:
+		m = m.with("uuid", p.UUID).with("flow", p.Flow)
+	case TypeTrojan:
+		m = m.with("password", p.Password)
+	case TypeHysteria2:
+		obfs := mapping{}
+		if p.Obfs != "" {
+			obfs = obfs.with("type", p.Obfs).with("password", p.ObfsPassword)
+		}
+		m = m.with("password", p.Password).with("obfs", obfs)
+	}
+
+	if p.TLS {
+		var reality, utls mapping
+		fingerprint := p.Fingerprint
+
+		if p.PublicKey != "" {
+			// reality requires uTLS
+			fingerprint = valueOr(fingerprint, defaultFingerprint)
+			reality = mapping{}.with("enabled", true).with("public_key", p.PublicKey).with("short_id", p.ShortID)
+		}
+
+		if fingerprint != "" {
+			utls = mapping{}.with("enabled", true).with("fingerprint", fingerprint)
+		}
+
+		m = m.with("tls", mapping{}.
+			with("enabled", true).
+			with("server_name", p.SNI).
+			with("insecure", p.Insecure).
+			with("alpn", p.ALPN).
+			with("utls", utls).
+			with("reality", reality),
+		)
+	}
+
+	switch p.Network {
+	case NetworkWS:
+		headers := mapping{}.with("Host", p.Host)
+		m = m.with("transport", mapping{}.with("type", p.Network).with("path", p.Path).with("headers", headers))
+	case NetworkGRPC:
+		m = m.with("transport", mapping{}.with("type", p.Network).with("service_name", p.Path))
+	case NetworkH2:
+		m = m.with("transport", mapping{}.with("type", "http").with("host", listOf(p.Host)).with("path", p.Path))
+	}
+
+	return m
+}
+
+// valueOr returns the value or the default one if it's empty.
+func valueOr(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// listOf returns a list of the non-empty value.
+func listOf(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
@@ -0,0 +1,121 @@
+package convert
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// testProxies returns proxies with different types and transports.
+func testProxies() []*Proxy {
+	return []*Proxy{
+		{Name: "ss \"one\"", Type: TypeShadowsocks, Server: "1.2.3.4", Port: 8388, Cipher: "aes-256-gcm", Password: "pass"},
+		{
+			Name: "vl", Type: TypeVLESS, Server: "example.com", Port: 443, UUID: "uuid-2", Flow: "xtls-rprx-vision",
+			TLS: true, PublicKey: "key", ShortID: "ab", Network: NetworkGRPC, Path: "svc",
+		},
+		{
+			Name: "vm", Type: TypeVMess, Server: "example.com", Port: 80, UUID: "uuid-1",
+			Network: NetworkWS, Path: "/ws", Host: "h.example.com",
+		},
+	}
+}
+
+func TestClash(t *testing.T) {
+	expected := `proxies:
+  - name: "ss \"one\""
+    type: "ss"
+    server: "1.2.3.4"
+    port: 8388
+    cipher: "aes-256-gcm"
+    password: "pass"
+    udp: true
+  - name: "vl"
+    type: "vless"
+    server: "example.com"
+    port: 443
+    uuid: "uuid-2"
+    flow: "xtls-rprx-vision"
+    tls: true
+    reality-opts:
+      public-key: "key"
+      short-id: "ab"
+    network: "grpc"
+    grpc-opts:
+      grpc-service-name: "svc"
+  - name: "vm"
+    type: "vmess"
+    server: "example.com"
+    port: 80
+    uuid: "uuid-1"
+    alterId: 0
+    cipher: "auto"
+    network: "ws"
+    ws-opts:
+      path: "/ws"
+      headers:
+        Host: "h.example.com"
+proxy-groups:
+  - name: "PROXY"
+    type: "select"
+    proxies:
+      - "ss \"one\""
+      - "vl"
+      - "vm"
+      - "DIRECT"
+rules:
+  - "MATCH,PROXY"
+`
+	if got := string(Clash(testProxies())); got != expected {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, expected)
+	}
+
+	expected = `proxies: []
+proxy-groups:
+  - name: "PROXY"
+    type: "select"
+    proxies:
+      - "DIRECT"
+rules:
+  - "MATCH,PROXY"
+`
+	if got := string(Clash(nil)); got != expected {
+		t.Errorf("unexpected empty output:\n%s\nwant:\n%s", got, expected)
+	}
+}
+
+func TestSingBox(t *testing.T) {
+	var config struct {
+		Outbounds []map[string]any `json:"outbounds"`
+		Route     struct {
+			Final string `json:"final"`
+		} `json:"route"`
+	}
+
+	if err := json.Unmarshal(SingBox(testProxies()), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(config.Outbounds); n != 5 || config.Route.Final != "proxy" {
+		t.Fatalf("got %d outbounds, final route %q", n, config.Route.Final)
+	}
+
+	selector, _ := json.Marshal(config.Outbounds[0])
+	expected := `{"outbounds":["ss \"one\"","vl","vm","direct"],"tag":"proxy","type":"selector"}`
+	if string(selector) != expected {
+		t.Errorf("got selector %s, want %s", selector, expected)
+	}
+
+	vless, _ := json.Marshal(config.Outbounds[2])
+	expected = `{"flow":"xtls-rprx-vision","server":"example.com","server_port":443,"tag":"vl",` +
+		`"tls":{"enabled":true,"reality":{"enabled":true,"public_key":"key","short_id":"ab"},` +
+		`"utls":{"enabled":true,"fingerprint":"chrome"}},` +
+		`"transport":{"service_name":"svc","type":"grpc"},"type":"vless","uuid":"uuid-2"}`
+
+	if string(vless) != expected {
+		t.Errorf("got vless outbound %s, want %s", vless, expected)
+	}
+
+	if direct := config.Outbounds[4]; direct["type"] != "direct" || direct["tag"] != "direct" {
+		t.Errorf("unexpected direct outbound %v", direct)
+	}
+}
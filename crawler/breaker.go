@@ -0,0 +1,249 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is an error if a request was skipped by an open circuit breaker.
+var ErrCircuitOpen = fmt.Errorf("circuit breaker is open")
+
+// BreakerState is a state of a host circuit breaker.
+type BreakerState uint8
+
+const (
+	// BreakerClosed is a normal state, all requests are allowed.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen is a state after failures, all requests are skipped until cool-down ends.
+	BreakerOpen
+	// BreakerHalfOpen is a state after cool-down, only one probe request is allowed at a time.
+	BreakerHalfOpen
+)
+
+// String returns a string representation of the breaker state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("unknown(%d)", s)
+	}
+}
+
+// MarshalText returns a text representation of the breaker state.
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// BreakerStatus is a snapshot of a host circuit breaker.
+type BreakerStatus struct {
+	Host     string       `json:"host"`
+	State    BreakerState `json:"state"`
+	Failures uint32       `json:"failures"`
+	OpenedAt time.Time    `json:"opened_at,omitzero"`
+}
+
+// circuitBreaker is a circuit breaker of one upstream host.
+type circuitBreaker struct {
+	sync.Mutex
+	host      string
+	state     BreakerState
+	failures  uint32 // consecutive failures in closed state
+	successes uint32 // successful probes in half-open state
+	probing   bool   // a probe request is in progress in half-open state
+	openedAt  time.Time
+}
+
+// setState changes the breaker state and logs the transition.
+// A caller should hold the lock.
+func (cb *circuitBreaker) setState(state BreakerState, now time.Time) {
+	if cb.state == state {
+		return
+	}
+
+	level := slog.LevelInfo
+	if state == BreakerOpen {
+		level = slog.LevelWarn
+	}
+
+	slog.Log(context.Background(), level, "circuit breaker", "host", cb.host, "from", cb.state, "to", state, "failures", cb.failures)
+	cb.state = state
+	cb.successes = 0
+	cb.probing = false
+
+	switch state {
+	case BreakerOpen:
+		cb.openedAt = now
+	case BreakerClosed:
+		cb.failures = 0
+		cb.openedAt = time.Time{}
+	default:
+		// half-open state keeps the open time
+	}
+}
+
+// allow checks if a request to the host can be done.
+func (cb *circuitBreaker) allow(coolDown time.Duration, now time.Time) bool {
+	cb.Lock()
+	defer cb.Unlock()
+
+	if cb.state == BreakerOpen && now.Sub(cb.openedAt) >= coolDown {
+		cb.setState(BreakerHalfOpen, now)
+	}
+
+	switch cb.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// success registers a successful request.
+func (cb *circuitBreaker) success(successes uint32, now time.Time) {
+	cb.Lock()
+	defer cb.Unlock()
+
+	switch cb.state {
+	case BreakerHalfOpen:
+		cb.probing = false
+		if cb.successes++; cb.successes >= successes {
+			cb.setState(BreakerClosed, now)
+		}
+	default:
+		cb.failures = 0
+	}
+}
+
+// failure registers a failed request.
+func (cb *circuitBreaker) failure(failures uint32, now time.Time) {
+	cb.Lock()
+	defer cb.Unlock()
+
+	cb.failures++
+	switch cb.state {
+	case BreakerHalfOpen:
+		cb.setState(BreakerOpen, now)
+	case BreakerClosed:
+		if cb.failures >= failures {
+			cb.setState(BreakerOpen, now)
+		}
+	default:
+		// already open
+	}
+}
+
+// cancel releases a probe request without changing the state.
+func (cb *circuitBreaker) cancel() {
+	cb.Lock()
+	cb.probing = false
+	cb.Unlock()
+}
+
+// status returns a snapshot of the breaker.
+func (cb *circuitBreaker) status() BreakerStatus {
+	cb.Lock()
+	defer cb.Unlock()
+
+	return BreakerStatus{
+		Host:     cb.host,
+		State:    cb.state,
+		Failures: cb.failures,
+		OpenedAt: cb.openedAt,
+	}
+}
+
+// BreakerRoundTripper skips requests to failing hosts using per-host circuit breakers.
+type BreakerRoundTripper struct {
+	sync.Mutex
+	next      http.RoundTripper
+	breakers  map[string]*circuitBreaker
+	failures  uint32 // consecutive failures to open a breaker
+	successes uint32 // successful probes to close a half-open breaker
+	coolDown  time.Duration
+}
+
+// NewBreakerRoundTripper creates a new round tripper with circuit breakers.
+func NewBreakerRoundTripper(next http.RoundTripper, failures, successes uint32, coolDown time.Duration) *BreakerRoundTripper {
+	return &BreakerRoundTripper{
+		next:      next,
+		breakers:  make(map[string]*circuitBreaker),
+		failures:  max(failures, 1),
+		successes: max(successes, 1),
+		coolDown:  coolDown,
+	}
+}
+
+// breaker returns the circuit breaker of the host, it creates a new one if needed.
+func (brt *BreakerRoundTripper) breaker(host string) *circuitBreaker {
+	brt.Lock()
+	defer brt.Unlock()
+
+	cb, ok := brt.breakers[host]
+	if !ok {
+		cb = &circuitBreaker{host: host}
+		brt.breakers[host] = cb
+	}
+
+	return cb
+}
+
+// RoundTrip does HTTP request if the host circuit breaker allows it.
+// Transport errors and 5xx statuses are failures, a canceled request doesn't change the breaker.
+func (brt *BreakerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	cb := brt.breaker(host)
+
+	if !cb.allow(brt.coolDown, time.Now()) {
+		return nil, errors.Join(ErrCircuitOpen, fmt.Errorf("host %q", host))
+	}
+
+	resp, err := brt.next.RoundTrip(req)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		cb.cancel()
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		cb.failure(brt.failures, time.Now())
+	default:
+		cb.success(brt.successes, time.Now())
+	}
+
+	return resp, err
+}
+
+// Status returns snapshots of all known host circuit breakers sorted by host.
+func (brt *BreakerRoundTripper) Status() []BreakerStatus {
+	brt.Lock()
+	hosts := slices.Sorted(maps.Keys(brt.breakers))
+	breakers := make([]*circuitBreaker, len(hosts))
+
+	for i, host := range hosts {
+		breakers[i] = brt.breakers[host]
+	}
+	brt.Unlock()
+
+	result := make([]BreakerStatus, len(breakers))
+	for i, cb := range breakers {
+		result[i] = cb.status()
+	}
+
+	return result
+}
@@ -0,0 +1,213 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+func TestBreakerState_String(t *testing.T) {
+	tests := []struct {
+		state BreakerState
+		want  string
+	}{
+		{BreakerClosed, "closed"},
+		{BreakerOpen, "open"},
+		{BreakerHalfOpen, "half-open"},
+		{BreakerState(10), "unknown(10)"},
+	}
+
+	for _, tc := range tests {
+		if got := tc.state.String(); got != tc.want {
+			t.Errorf("String() = %q, want %q", got, tc.want)
+		}
+	}
+
+	data, err := json.Marshal(BreakerStatus{Host: "example.com", State: BreakerOpen})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `{"host":"example.com","state":"open","failures":0}`; string(data) != want {
+		t.Errorf("json = %s, want %s", data, want)
+	}
+}
+
+func TestBreakerRoundTripper_RoundTrip(t *testing.T) {
+	const coolDown = 30 * time.Millisecond
+	var connErr = errors.New("connection error")
+
+	mock := &mockRoundTripper{
+		responses: []*http.Response{
+			nil,
+			{StatusCode: http.StatusBadGateway},
+			{StatusCode: http.StatusInternalServerError}, // half-open probe failed
+			{StatusCode: http.StatusOK},                  // half-open probe succeeded
+			{StatusCode: http.StatusOK},
+		},
+		errors: []error{connErr, nil, nil, nil, nil},
+	}
+	brt := NewBreakerRoundTripper(mock, 2, 1, coolDown)
+
+	steps := []struct {
+		name      string
+		sleep     time.Duration
+		wantErr   error
+		wantState BreakerState
+	}{
+		{name: "first failure", wantErr: connErr, wantState: BreakerClosed},
+		{name: "second failure opens", wantState: BreakerOpen},
+		{name: "open skips request", wantErr: ErrCircuitOpen, wantState: BreakerOpen},
+		{name: "failed probe", sleep: coolDown, wantState: BreakerOpen},
+		{name: "successful probe", sleep: coolDown, wantState: BreakerClosed},
+		{name: "closed", wantState: BreakerClosed},
+	}
+
+	for _, step := range steps {
+		time.Sleep(step.sleep)
+		req, _ := http.NewRequest("GET", "https://example.com", nil)
+		_, err := brt.RoundTrip(req)
+
+		if step.wantErr == nil && err != nil {
+			t.Errorf("%s: unexpected error: %v", step.name, err)
+		}
+
+		if step.wantErr != nil && !errors.Is(err, step.wantErr) {
+			t.Errorf("%s: error = %v, want %v", step.name, err, step.wantErr)
+		}
+
+		status := brt.Status()
+		if n := len(status); n != 1 {
+			t.Fatalf("%s: status length = %d, want 1", step.name, n)
+		}
+
+		if state := status[0].State; state != step.wantState {
+			t.Errorf("%s: state = %v, want %v", step.name, state, step.wantState)
+		}
+	}
+
+	if mock.calls != len(mock.responses) {
+		t.Errorf("calls = %d, want %d", mock.calls, len(mock.responses))
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	var (
+		cb  = &circuitBreaker{host: "example.com"}
+		now = time.Now()
+	)
+
+	cb.failure(1, now)
+	if cb.allow(time.Minute, now) {
+		t.Error("open breaker allowed a request")
+	}
+
+	now = now.Add(time.Minute)
+	if !cb.allow(time.Minute, now) {
+		t.Error("half-open breaker didn't allow a probe")
+	}
+
+	if cb.allow(time.Minute, now) {
+		t.Error("half-open breaker allowed a second probe")
+	}
+
+	cb.cancel()
+	if !cb.allow(time.Minute, now) {
+		t.Error("half-open breaker didn't allow a probe after cancel")
+	}
+
+	cb.success(2, now)
+	if s := cb.status(); s.State != BreakerHalfOpen {
+		t.Errorf("state = %v, want %v", s.State, BreakerHalfOpen)
+	}
+}
+
+func TestCrawler_BreakerCache(t *testing.T) {
+	var failed atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failed.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if _, err := w.Write([]byte("line1\nline2")); err != nil {
+			t.Errorf("failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	group := cfg.Group{
+		Name: "breaker",
+		Subscriptions: []cfg.Subscription{
+			{
+				Name:    "sub1",
+				Path:    cfg.SubPath(server.URL),
+				Timeout: cfg.Duration(time.Second),
+				Retry:   &cfg.RetryOptions{Retries: 1},
+			},
+		},
+		Period: cfg.Duration(time.Hour),
+	}
+	opts := cfg.BreakerOptions{Failures: 1, CoolDown: cfg.Duration(time.Hour)}
+
+	c := New([]cfg.Group{group}, userAgentDefault, retriesDefault, maxConcurrentDefault, "", WithBreakerOptions(opts))
+	if status := c.BreakerStatus(); len(status) != 0 {
+		t.Error("unexpected breaker status before requests")
+	}
+
+	expected := []byte("line1\nline2")
+	steps := []struct {
+		name   string
+		failed bool
+		want   []byte
+		state  BreakerState
+	}{
+		{name: "success", want: expected, state: BreakerClosed},
+		{name: "failure opens breaker", failed: true, state: BreakerOpen},
+		{name: "cached data", failed: true, want: expected, state: BreakerOpen},
+	}
+
+	for _, step := range steps {
+		failed.Store(step.failed)
+
+		got, err := c.Get(context.Background(), group.Name, true, false)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+
+		if !slices.Equal(got, step.want) {
+			t.Errorf("%s: got = %q, want %q", step.name, got, step.want)
+		}
+
+		if status := c.BreakerStatus(); len(status) != 1 || status[0].State != step.state {
+			t.Errorf("%s: breaker status = %+v, want %v", step.name, status, step.state)
+		}
+	}
+
+	c.Shutdown()
+}
+
+func TestBreakerRoundTripper_Canceled(t *testing.T) {
+	mock := &mockRoundTripper{
+		responses: []*http.Response{nil},
+		errors:    []error{context.Canceled},
+	}
+	brt := NewBreakerRoundTripper(mock, 1, 1, time.Minute)
+
+	req, _ := http.NewRequest("GET", "https://example.com", nil)
+	if _, err := brt.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want %v", err, context.Canceled)
+	}
+
+	if status := brt.Status(); status[0].State != BreakerClosed || status[0].Failures != 0 {
+		t.Errorf("status = %+v, want closed without failures", status[0])
+	}
+}
@@ -5,8 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/z0rr0/smerge/cfg"
 )
 
 var (
@@ -23,6 +27,108 @@ type retryCheckFunc func(resp *http.Response) error
 // delayFunc is a function that returns delay for the next retry attempt.
 type delayFunc func(attempt uint8) time.Duration
 
+// policyKey is a context key for a request retry policy.
+type policyKey struct{}
+
+// RetryPolicy describes which requests are retried and how long to wait between attempts.
+// It can be attached to a request context by WithRetryPolicy to override RetryRoundTripper defaults.
+type RetryPolicy struct {
+	MaxRetries  uint8
+	Statuses    map[int]struct{} // if empty, 429 and all 5xx statuses are retried
+	RetryErrors bool             // retry transport errors
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      bool // use full jitter for delays
+	RetryAfter  bool // honor Retry-After response header
+}
+
+// NewRetryPolicy creates a new retry policy from the configuration options.
+// If options don't define retries, the maxRetries value is used.
+func NewRetryPolicy(opts *cfg.RetryOptions, maxRetries uint8) *RetryPolicy {
+	p := &RetryPolicy{
+		MaxRetries:  maxRetries,
+		Statuses:    make(map[int]struct{}, len(opts.Statuses)),
+		RetryErrors: !opts.SkipErrors,
+		BaseDelay:   opts.BaseDelay.Timed(),
+		MaxDelay:    opts.MaxDelay.Timed(),
+		Jitter:      opts.Jitter,
+		RetryAfter:  opts.RetryAfter,
+	}
+
+	if opts.Retries > 0 {
+		p.MaxRetries = opts.Retries
+	}
+
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = calcDelay(1)
+	}
+
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = p.BaseDelay
+	}
+
+	for _, status := range opts.Statuses {
+		p.Statuses[status] = struct{}{}
+	}
+
+	return p
+}
+
+// retryStatus checks if the response status code should be retried.
+func (p *RetryPolicy) retryStatus(code int) bool {
+	if len(p.Statuses) == 0 {
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+
+	_, ok := p.Statuses[code]
+	return ok
+}
+
+// check is a retryCheckFunc implementation of the policy.
+func (p *RetryPolicy) check(resp *http.Response) error {
+	if !p.retryStatus(resp.StatusCode) {
+		return nil
+	}
+
+	return fmt.Errorf("status code: %d", resp.StatusCode)
+}
+
+// delay is a delayFunc implementation of the policy, exponential backoff limited by MaxDelay.
+// With jitter the delay is a random value from 0 to the backoff value.
+func (p *RetryPolicy) delay(attempt uint8) time.Duration {
+	const maxShift = 32
+	if attempt == 0 {
+		return 0
+	}
+
+	d := p.MaxDelay
+	if shift := attempt - 1; shift < maxShift {
+		if backoff := p.BaseDelay << shift; backoff > 0 && backoff < d {
+			d = backoff
+		}
+	}
+
+	if p.Jitter && d > 0 {
+		d = rand.N(d + 1) // #nosec G404 -- jitter doesn't need a secure random generator
+	}
+
+	return d
+}
+
+// WithRetryPolicy returns a copy of the context with the retry policy for RetryRoundTripper.
+func WithRetryPolicy(ctx context.Context, p *RetryPolicy) context.Context {
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+// retrySettings is a set of retry parameters for one RoundTrip call.
+type retrySettings struct {
+	maxRetries    uint8
+	delayStrategy delayFunc
+	retryCheck    retryCheckFunc
+	retryErrors   bool
+	retryAfter    bool
+}
+
 // RetryRoundTripper does HTTP request with retries support.
 type RetryRoundTripper struct {
 	next          http.RoundTripper
@@ -31,9 +137,29 @@ type RetryRoundTripper struct {
 	retryCheck    retryCheckFunc
 }
 
-func (rrt *RetryRoundTripper) do(req *http.Request, i uint8) (*http.Response, error) {
+// settings returns retry parameters for the request context,
+// a context retry policy has priority over the round tripper's defaults.
+func (rrt *RetryRoundTripper) settings(ctx context.Context) retrySettings {
+	if p, ok := ctx.Value(policyKey{}).(*RetryPolicy); ok && p != nil {
+		return retrySettings{
+			maxRetries:    p.MaxRetries,
+			delayStrategy: p.delay,
+			retryCheck:    p.check,
+			retryErrors:   p.RetryErrors,
+			retryAfter:    p.RetryAfter,
+		}
+	}
+
+	return retrySettings{
+		maxRetries:    rrt.maxRetries,
+		delayStrategy: rrt.delayStrategy,
+		retryCheck:    rrt.retryCheck,
+		retryErrors:   true,
+	}
+}
+
+func (rrt *RetryRoundTripper) do(req *http.Request, i uint8, delay time.Duration) (*http.Response, error) {
 	ctx := req.Context()
-	delay := rrt.delayStrategy(i)
 
 	select {
 	case <-ctx.Done():
@@ -57,14 +183,31 @@ func (rrt *RetryRoundTripper) RoundTrip(req *http.Request) (*http.Response, erro
 		resp *http.Response
 		stop bool
 		err  error
+		wait time.Duration // delay requested by Retry-After header
+		ctx  = req.Context()
+		rs   = rrt.settings(ctx)
 	)
 
 	// do retries from 0 to maxRetries-1
-	for i := range rrt.maxRetries {
+	for i := range rs.maxRetries {
 		reqCopy := cloneRequest(req)
-		resp, err = rrt.do(reqCopy, i)
+		resp, err = rrt.do(reqCopy, i, max(rs.delayStrategy(i), wait))
+
+		if err != nil && !rs.retryErrors {
+			return nil, err
+		}
 
-		if stop, err = stopRetry(err, resp, rrt.retryCheck); stop {
+		if rs.retryAfter && err == nil && rs.retryCheck(resp) != nil {
+			wait = retryAfterDelay(resp.Header.Get("Retry-After"), time.Now())
+
+			if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+				// the server asks to wait longer than the request can last, return its response as is
+				slog.Warn("retry after exceeds deadline", "status", resp.StatusCode, "wait", wait)
+				return resp, nil
+			}
+		}
+
+		if stop, err = stopRetry(err, resp, rs.retryCheck); stop {
 			return resp, err
 		}
 		slog.Warn("attempt", "number", i, "error", err)
@@ -139,6 +282,24 @@ func stopRetry(err error, resp *http.Response, retryCheck retryCheckFunc) (bool,
 	return true, nil
 }
 
+// retryAfterDelay parses Retry-After header value as delay-seconds or HTTP-date.
+// It returns 0 if the value is empty or invalid.
+func retryAfterDelay(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+
+	return 0
+}
+
 // retryInternalServerError checks if we need to retry on internal server error.
 // It returns nil then we need to stop retries.
 // It is a custom variant of retryCheckFunc.
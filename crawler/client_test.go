@@ -6,8 +6,11 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/z0rr0/smerge/cfg"
 )
 
 // mockRoundTripper is used to mock HTTP responses for testing
@@ -355,3 +358,237 @@ func TestRetryRoundTripper_Integration(t *testing.T) {
 		t.Errorf("expected %d server calls, got %d", expectedCalls, serverCallCount)
 	}
 }
+
+func TestNewRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       cfg.RetryOptions
+		maxRetries uint8
+		want       RetryPolicy
+	}{
+		{
+			name:       "defaults",
+			maxRetries: 3,
+			want: RetryPolicy{
+				MaxRetries:  3,
+				Statuses:    map[int]struct{}{},
+				RetryErrors: true,
+				BaseDelay:   20 * time.Millisecond,
+				MaxDelay:    20 * time.Millisecond,
+			},
+		},
+		{
+			name: "custom",
+			opts: cfg.RetryOptions{
+				Retries:    5,
+				Statuses:   []int{http.StatusTooManyRequests},
+				SkipErrors: true,
+				BaseDelay:  cfg.Duration(time.Second),
+				MaxDelay:   cfg.Duration(time.Minute),
+				Jitter:     true,
+				RetryAfter: true,
+			},
+			maxRetries: 3,
+			want: RetryPolicy{
+				MaxRetries: 5,
+				Statuses:   map[int]struct{}{http.StatusTooManyRequests: {}},
+				BaseDelay:  time.Second,
+				MaxDelay:   time.Minute,
+				Jitter:     true,
+				RetryAfter: true,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewRetryPolicy(&tc.opts, tc.maxRetries)
+
+			if !reflect.DeepEqual(*p, tc.want) {
+				t.Errorf("policy = %+v, want %+v", *p, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Check(t *testing.T) {
+	defaultPolicy := NewRetryPolicy(&cfg.RetryOptions{}, 1)
+	customPolicy := NewRetryPolicy(&cfg.RetryOptions{Statuses: []int{http.StatusServiceUnavailable}}, 1)
+
+	tests := []struct {
+		name   string
+		policy *RetryPolicy
+		status int
+		retry  bool
+	}{
+		{name: "default ok", policy: defaultPolicy, status: http.StatusOK},
+		{name: "default not found", policy: defaultPolicy, status: http.StatusNotFound},
+		{name: "default too many requests", policy: defaultPolicy, status: http.StatusTooManyRequests, retry: true},
+		{name: "default internal error", policy: defaultPolicy, status: http.StatusInternalServerError, retry: true},
+		{name: "custom unavailable", policy: customPolicy, status: http.StatusServiceUnavailable, retry: true},
+		{name: "custom internal error", policy: customPolicy, status: http.StatusInternalServerError},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.policy.check(&http.Response{StatusCode: tc.status})
+
+			if retry := err != nil; retry != tc.retry {
+				t.Errorf("check(%d) retry = %v, want %v", tc.status, retry, tc.retry)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	tests := []struct {
+		attempt uint8
+		want    time.Duration
+	}{
+		{0, 0},
+		{1, 10 * time.Millisecond},
+		{2, 20 * time.Millisecond},
+		{3, 40 * time.Millisecond},
+		{4, 50 * time.Millisecond},
+		{255, 50 * time.Millisecond},
+	}
+
+	for _, tc := range tests {
+		if got := p.delay(tc.attempt); got != tc.want {
+			t.Errorf("delay(%d) = %v, want %v", tc.attempt, got, tc.want)
+		}
+	}
+
+	p.Jitter = true
+	for attempt := range uint8(10) {
+		if got, limit := p.delay(attempt), min(p.BaseDelay<<max(attempt, 1), p.MaxDelay); got < 0 || got > limit {
+			t.Errorf("jitter delay(%d) = %v, want in [0, %v]", attempt, got, limit)
+		}
+	}
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "empty"},
+		{name: "seconds", value: "3", want: 3 * time.Second},
+		{name: "date", value: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute},
+		{name: "past date", value: now.Add(-time.Minute).Format(http.TimeFormat)},
+		{name: "invalid", value: "soon"},
+		{name: "negative", value: "-1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := retryAfterDelay(tc.value, now); got != tc.want {
+				t.Errorf("retryAfterDelay(%q) = %v, want %v", tc.value, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetryRoundTripper_Policy(t *testing.T) {
+	var connErr = errors.New("connection error")
+	tests := []struct {
+		name        string
+		opts        cfg.RetryOptions
+		responses   []*http.Response
+		errors      []error
+		timeout     time.Duration
+		expectCode  int
+		expectError bool
+		expectCalls int
+	}{
+		{
+			name: "retry too many requests",
+			responses: []*http.Response{
+				{StatusCode: http.StatusTooManyRequests, Body: &mockReadCloser{}},
+				{StatusCode: http.StatusOK},
+			},
+			errors:      []error{nil, nil},
+			expectCode:  http.StatusOK,
+			expectCalls: 2,
+		},
+		{
+			name:        "skip errors",
+			opts:        cfg.RetryOptions{SkipErrors: true},
+			responses:   []*http.Response{nil, {StatusCode: http.StatusOK}},
+			errors:      []error{connErr, nil},
+			expectError: true,
+			expectCalls: 1,
+		},
+		{
+			name: "retry after",
+			opts: cfg.RetryOptions{RetryAfter: true},
+			responses: []*http.Response{
+				{
+					StatusCode: http.StatusServiceUnavailable,
+					Header:     http.Header{"Retry-After": []string{"0"}},
+					Body:       &mockReadCloser{},
+				},
+				{StatusCode: http.StatusOK},
+			},
+			errors:      []error{nil, nil},
+			timeout:     time.Second,
+			expectCode:  http.StatusOK,
+			expectCalls: 2,
+		},
+		{
+			name: "retry after exceeds deadline",
+			opts: cfg.RetryOptions{RetryAfter: true},
+			responses: []*http.Response{
+				{
+					StatusCode: http.StatusTooManyRequests,
+					Header:     http.Header{"Retry-After": []string{"60"}},
+					Body:       &mockReadCloser{},
+				},
+				{StatusCode: http.StatusOK},
+			},
+			errors:      []error{nil, nil},
+			timeout:     time.Second,
+			expectCode:  http.StatusTooManyRequests,
+			expectCalls: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := &mockRoundTripper{responses: tc.responses, errors: tc.errors}
+			rrt := &RetryRoundTripper{next: mock, maxRetries: 1, delayStrategy: calcDelay, retryCheck: retryInternalServerError}
+
+			ctx := WithRetryPolicy(context.Background(), NewRetryPolicy(&tc.opts, 3))
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			req, _ := http.NewRequestWithContext(ctx, "GET", "https://example.com", nil)
+			resp, err := rrt.RoundTrip(req)
+
+			if mock.calls != tc.expectCalls {
+				t.Errorf("expected %d calls, got %d", tc.expectCalls, mock.calls)
+			}
+
+			if tc.expectError {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if resp.StatusCode != tc.expectCode {
+				t.Errorf("expected status code %d, got %d", tc.expectCode, resp.StatusCode)
+			}
+		})
+	}
+}
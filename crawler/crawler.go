@@ -8,19 +8,29 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"math/rand/v2"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/z0rr0/smerge/cfg"
 )
 
-// bufferSize is a size of buffer for reading subscription data.
-const bufferSize = 3072
+const (
+	// bufferSize is a size of buffer for reading subscription data.
+	bufferSize = 3072
+
+	// requestIDHeader is an HTTP header of the request ID forwarded to upstreams.
+	requestIDHeader = "X-Request-ID"
+)
 
 var (
 	// bufferPool is a pool for bytes.Buffer for subscription data reading.
@@ -40,22 +50,96 @@ var (
 // Getter is an interface for getting data by group name.
 // If force is true, the data will be fetched from the source.
 // If decode is true, the data will be decoded from base64 if request group has Encoded flag.
+// The context can carry a request ID by WithRequestID, it's used only for a forced fetch.
 type Getter interface {
-	Get(groupName string, force bool, decode bool) ([]byte, error)
+	Get(ctx context.Context, groupName string, force bool, decode bool) ([]byte, error)
+}
+
+// requestIDKey is a context key of the request ID.
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of the context with the request ID,
+// which is forwarded to upstreams and logged by fetches.
+func WithRequestID(ctx context.Context, reqID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, reqID)
+}
+
+// RequestID returns the request ID from the context or an empty string if it's not set.
+func RequestID(ctx context.Context) string {
+	reqID, _ := ctx.Value(requestIDKey{}).(string)
+	return reqID
+}
+
+// requestLogger returns the default logger with the request ID attribute if it's set.
+func requestLogger(reqID string) *slog.Logger {
+	if reqID == "" {
+		return slog.Default()
+	}
+
+	return slog.With("id", reqID)
 }
 
 // Crawler is a main crawler structure.
 type Crawler struct {
 	sync.RWMutex
-	groups     map[string]*cfg.Group
-	result     map[string][]byte
-	userAgent  string
-	client     *http.Client
-	ctx        context.Context
-	cancelFunc context.CancelFunc
-	wg         sync.WaitGroup
-	rootDir    string
-	semaphore  chan struct{} // to limit the number of concurrent goroutines for fetchSubscription
+	groupsMu    sync.RWMutex // for groups, refresh and handlers
+	reloadMu    sync.Mutex   // to prevent concurrent reloads
+	groups      map[string]*cfg.Group
+	handlers    map[string]*groupHandler
+	watchCancel context.CancelFunc // stops the local files watcher, nil if it's not started
+	result      map[string][]byte
+	userAgent   string
+	client      atomic.Pointer[http.Client]
+	transport   reloadableTransport
+	timeout     time.Duration // maximum subscription timeout of the client and the transport
+	ctx         context.Context
+	cancelFunc  context.CancelFunc
+	wg          sync.WaitGroup
+	rootDir     string
+	semaphore   chan struct{} // to limit the number of concurrent goroutines for fetchSubscription
+	retries     uint8
+	retry       cfg.RetryOptions
+	breakerOpts cfg.BreakerOptions
+	breaker     *BreakerRoundTripper // nil if circuit breaker is disabled
+	cacheMu     sync.RWMutex
+	cache       map[subKey][]string // last successful subscriptions' results
+	watchOpts   cfg.WatchOptions
+	refresh     map[string]chan struct{} // signals to refresh groups out of their schedule
+	statusMu    sync.RWMutex
+	groupStatus map[string]GroupStatus // last groups' fetches, without subscriptions
+	subStatus   map[subKey]SubscriptionStatus
+}
+
+// groupHandler is a running group goroutine.
+type groupHandler struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed after the goroutine is stopped
+}
+
+// reloadableTransport is an HTTP transport which can be replaced without a restart.
+type reloadableTransport struct {
+	transport atomic.Pointer[http.Transport]
+}
+
+// RoundTrip passes the request to the current transport.
+func (rt *reloadableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt.transport.Load().RoundTrip(req)
+}
+
+// subKey is a key of a subscription in a group.
+type subKey struct {
+	group        string
+	subscription string
+}
+
+// Option is a functional option for the crawler.
+type Option func(*Crawler)
+
+// WithRetryOptions sets a default retry policy for remote subscriptions.
+func WithRetryOptions(opts cfg.RetryOptions) Option {
+	return func(c *Crawler) {
+		c.retry = opts
+	}
 }
 
 type fetchResult struct {
@@ -64,29 +148,99 @@ type fetchResult struct {
 	error        error
 }
 
+// WithBreakerOptions enables per-host circuit breakers for remote subscriptions.
+func WithBreakerOptions(opts cfg.BreakerOptions) Option {
+	return func(c *Crawler) {
+		c.breakerOpts = opts
+	}
+}
+
+// WithWatchOptions enables refreshing of groups after changes of their local subscription files.
+func WithWatchOptions(opts cfg.WatchOptions) Option {
+	return func(c *Crawler) {
+		c.watchOpts = opts
+	}
+}
+
 // New creates a new crawler instance.
-func New(groups []cfg.Group, userAgent string, retries uint8, maxConcurrent int, rootDir string) *Crawler {
-	const (
-		maxConnectionsPerHost = 100
-		maxIdleConnections    = 1000
-		minHandshakeTimeout   = 500 * time.Millisecond
-	)
+func New(groups []cfg.Group, userAgent string, retries uint8, maxConcurrent int, rootDir string, opts ...Option) *Crawler {
 	var (
-		timeout   time.Duration
 		groupLen  = len(groups)
 		groupsMap = make(map[string]*cfg.Group, groupLen)
+		refresh   = make(map[string]chan struct{}, groupLen)
 	)
 
 	for i, group := range groups {
 		groupsMap[group.Name] = &groups[i]
-		timeout = max(timeout, group.MaxSubscriptionTimeout())
+		refresh[group.Name] = make(chan struct{}, 1)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Crawler{
+		groups:      groupsMap,
+		handlers:    make(map[string]*groupHandler, groupLen),
+		result:      make(map[string][]byte, groupLen),
+		cache:       make(map[subKey][]string),
+		groupStatus: make(map[string]GroupStatus, groupLen),
+		subStatus:   make(map[subKey]SubscriptionStatus),
+		userAgent:   userAgent,
+		ctx:         ctx,
+		cancelFunc:  cancel,
+		rootDir:     rootDir,
+		semaphore:   make(chan struct{}, maxConcurrent),
+		retries:     retries,
+		refresh:     refresh,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.observeSemaphore()
+
+	timeout := maxSubscriptionTimeout(groups)
+	c.transport.transport.Store(newTransport(timeout))
+	client := NewRetryClient(retries, &c.transport, timeout*2, retryInternalServerError, calcDelay)
+
+	if c.breakerOpts.Enabled() {
+		// the breaker wraps retries, so one failed request with all its attempts is one breaker failure
+		c.breaker = NewBreakerRoundTripper(
+			client.Transport,
+			c.breakerOpts.Failures,
+			c.breakerOpts.Successes,
+			c.breakerOpts.CoolDown.Timed(),
+		)
+		client.Transport = c.breaker
+		slog.Info("circuit breaker enabled", "failures", c.breakerOpts.Failures, "cool_down", c.breakerOpts.CoolDown.Timed())
+	}
+
+	c.client.Store(client)
+	c.timeout = timeout
+	return c
+}
+
+// maxSubscriptionTimeout returns the maximum timeout of all groups' subscriptions.
+func maxSubscriptionTimeout(groups []cfg.Group) time.Duration {
+	var timeout time.Duration
+
+	for i := range groups {
+		timeout = max(timeout, groups[i].MaxSubscriptionTimeout())
+	}
+
+	return timeout
+}
+
+// newTransport creates a new HTTP transport with timeouts derived from the maximum subscription timeout.
+func newTransport(timeout time.Duration) *http.Transport {
+	const (
+		maxConnectionsPerHost = 100
+		maxIdleConnections    = 1000
+		minHandshakeTimeout   = 500 * time.Millisecond
+	)
+
 	handshakeTimeout := max(timeout/2, minHandshakeTimeout)
 	slog.Info("timeouts", "timeout", timeout, "handshake", handshakeTimeout)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	transport := &http.Transport{
+	return &http.Transport{
 		Proxy:             http.ProxyFromEnvironment,
 		MaxIdleConns:      maxIdleConnections,
 		MaxConnsPerHost:   maxConnectionsPerHost,
@@ -99,49 +253,179 @@ func New(groups []cfg.Group, userAgent string, retries uint8, maxConcurrent int,
 		TLSHandshakeTimeout:   handshakeTimeout,
 		ResponseHeaderTimeout: timeout,
 	}
-	client := NewRetryClient(retries, transport, timeout*2, retryInternalServerError, calcDelay)
+}
 
-	return &Crawler{
-		groups:     groupsMap,
-		result:     make(map[string][]byte, groupLen),
-		userAgent:  userAgent,
-		client:     client,
-		ctx:        ctx,
-		cancelFunc: cancel,
-		rootDir:    rootDir,
-		semaphore:  make(chan struct{}, maxConcurrent),
-	}
+// setTimeout replaces the transport and the client by new ones with the maximum subscription timeout,
+// retries and circuit breakers' states are kept. A caller should hold the reload lock.
+func (c *Crawler) setTimeout(timeout time.Duration) {
+	old := c.transport.transport.Swap(newTransport(timeout))
+
+	client := *c.client.Load()
+	client.Timeout = timeout * 2
+	c.client.Store(&client)
+
+	c.timeout = timeout
+	old.CloseIdleConnections()
 }
 
 // Run starts the crawler for all groups.
 func (c *Crawler) Run() {
-	for name := range c.groups {
-		c.wg.Add(1)
+	c.groupsMu.Lock()
+	for _, group := range c.groups {
+		c.startGroup(group)
+	}
+	c.groupsMu.Unlock()
+
+	if c.watchOpts.Enabled {
+		c.watchLocal()
+	}
+}
 
-		go func(group *cfg.Group) {
-			period := group.Period.Timed()
-			slog.Info("starting group handler", "group", name, "period", period)
-			c.fetchGroup(group) // 1st init fetch after start
+// startGroup starts the group handler, which fetches the group immediately and then by its period.
+// A caller should hold the groups lock.
+func (c *Crawler) startGroup(group *cfg.Group) {
+	var (
+		ctx, cancel = context.WithCancel(c.ctx)
+		handler     = &groupHandler{cancel: cancel, done: make(chan struct{})}
+		refresh     = c.refresh[group.Name]
+	)
 
-			ticker := time.NewTicker(period)
-			defer func() {
-				ticker.Stop()
-				c.wg.Done()
-			}()
+	c.handlers[group.Name] = handler
+	c.wg.Add(1)
 
-			for {
-				select {
-				case <-c.ctx.Done():
-					slog.Info("group handler stopped", "group", group.Name)
-					return
-				case <-ticker.C:
-					slog.Info("group handler tick", "group", group.Name, "period", period)
-					c.fetchGroup(group)
-				}
+	go func() {
+		period := group.Period.Timed()
+		slog.Info("starting group handler", "group", group.Name, "period", period)
+		c.fetchGroup(group, "") // 1st init fetch after start
+
+		ticker := time.NewTicker(period)
+		c.setNextRun(group.Name, time.Now().Add(period))
+		defer func() {
+			ticker.Stop()
+			close(handler.done)
+			c.wg.Done()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				slog.Info("group handler stopped", "group", group.Name)
+				return
+			case tick := <-ticker.C:
+				slog.Info("group handler tick", "group", group.Name, "period", period)
+				c.setNextRun(group.Name, tick.Add(period))
+				c.fetchGroup(group, "")
+			case <-refresh:
+				slog.Info("group handler refresh", "group", group.Name)
+				c.fetchGroup(group, "")
+			}
+		}
+	}()
+}
+
+// Refresh asks the group handler to fetch the group out of its schedule.
+// It doesn't wait the fetch, and it's ignored if the group refresh is already pending.
+func (c *Crawler) Refresh(groupName string) bool {
+	c.groupsMu.RLock()
+	refresh, ok := c.refresh[groupName]
+	c.groupsMu.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	select {
+	case refresh <- struct{}{}:
+	default:
+		// a refresh is already pending
+	}
+
+	return true
+}
+
+// group returns the group by its name.
+func (c *Crawler) group(groupName string) (*cfg.Group, bool) {
+	c.groupsMu.RLock()
+	defer c.groupsMu.RUnlock()
+
+	group, ok := c.groups[groupName]
+	return group, ok
+}
+
+// localFiles returns a map of local subscriptions' files to names of groups using them.
+func (c *Crawler) localFiles() map[string][]string {
+	files := make(map[string][]string)
+
+	c.groupsMu.RLock()
+	defer c.groupsMu.RUnlock()
+
+	for name, group := range c.groups {
+		for _, sub := range group.Subscriptions {
+			if !sub.Local {
+				continue
 			}
 
-		}(c.groups[name])
+			fileName := filepath.Clean(sub.Path.String())
+			if !slices.Contains(files[fileName], name) {
+				files[fileName] = append(files[fileName], name)
+			}
+		}
 	}
+
+	return files
+}
+
+// watchLocal starts watching of local subscriptions' files.
+// Changes are debounced, after that only groups using changed files are refreshed.
+func (c *Crawler) watchLocal() {
+	files := c.localFiles()
+	if len(files) == 0 {
+		slog.Info("no local subscriptions to watch")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.watchCancel = cancel
+
+	var (
+		debounce = c.watchOpts.Debounce.Timed()
+		events   = watchFiles(ctx, c.rootDir, slices.Collect(maps.Keys(files)), c.watchOpts.Poll, c.watchOpts.PollInterval.Timed())
+	)
+
+	c.wg.Add(1)
+	go func() {
+		var (
+			pending = make(map[string]struct{})
+			timer   = time.NewTimer(debounce)
+		)
+		timer.Stop()
+
+		defer func() {
+			timer.Stop()
+			c.wg.Done()
+		}()
+
+		for {
+			select {
+			case name, ok := <-events:
+				if !ok {
+					slog.Info("local files watcher stopped")
+					return
+				}
+
+				slog.Debug("local file changed", "file", name, "groups", files[name])
+				for _, groupName := range files[name] {
+					pending[groupName] = struct{}{}
+				}
+				timer.Reset(debounce)
+			case <-timer.C:
+				for groupName := range pending {
+					c.Refresh(groupName)
+				}
+				clear(pending)
+			}
+		}
+	}()
 }
 
 // Shutdown stops the crawler and waits for all goroutines to finish.
@@ -151,26 +435,46 @@ func (c *Crawler) Shutdown() {
 	close(c.semaphore)
 }
 
-// needDecode checks if the group data needs to be decoded.
-// A caller should hold the read lock.
-func (c *Crawler) needDecode(groupName string, decode bool, resultSize int) bool {
-	if !decode || resultSize == 0 {
-		return false
+// BreakerStatus returns states of upstream hosts' circuit breakers.
+// It returns nil if circuit breakers are disabled.
+func (c *Crawler) BreakerStatus() []BreakerStatus {
+	if c.breaker == nil {
+		return nil
 	}
 
-	group, ok := c.groups[groupName]
-	return ok && group.Encoded
+	return c.breaker.Status()
+}
+
+// cached returns the last successful result of the subscription.
+func (c *Crawler) cached(key subKey) ([]string, bool) {
+	c.cacheMu.RLock()
+	defer c.cacheMu.RUnlock()
+
+	urls, ok := c.cache[key]
+	return urls, ok
+}
+
+// setCached stores the successful result of the subscription.
+func (c *Crawler) setCached(key subKey, urls []string) {
+	c.cacheMu.Lock()
+	c.cache[key] = urls
+	c.cacheMu.Unlock()
+}
+
+// needDecode checks if the group data needs to be decoded.
+func (c *Crawler) needDecode(group *cfg.Group, decode bool, resultSize int) bool {
+	return decode && resultSize > 0 && group.Encoded
 }
 
 // Get returns the group data.
-func (c *Crawler) Get(groupName string, force bool, decode bool) ([]byte, error) {
-	group, ok := c.groups[groupName]
+func (c *Crawler) Get(ctx context.Context, groupName string, force bool, decode bool) ([]byte, error) {
+	group, ok := c.group(groupName)
 	if !ok {
 		return nil, errors.Join(ErrNotFoundGroup, fmt.Errorf("group name %q", groupName))
 	}
 
 	if force {
-		c.fetchGroup(group)
+		c.fetchGroup(group, RequestID(ctx))
 	}
 
 	c.RLock()
@@ -183,7 +487,7 @@ func (c *Crawler) Get(groupName string, force bool, decode bool) ([]byte, error)
 
 	resultSize := len(groupResult)
 
-	if c.needDecode(groupName, decode, resultSize) {
+	if c.needDecode(group, decode, resultSize) {
 		return decodeGroup(groupResult, resultSize, groupName)
 	}
 
@@ -191,25 +495,25 @@ func (c *Crawler) Get(groupName string, force bool, decode bool) ([]byte, error)
 }
 
 // fetchGroup fetches all subscriptions for the group.
-func (c *Crawler) fetchGroup(group *cfg.Group) {
-	const avgSubURLs = 10
+// The request ID is not empty if the fetch is forced by a request.
+func (c *Crawler) fetchGroup(group *cfg.Group, reqID string) {
 	var (
+		logger           = requestLogger(reqID)
 		start            = time.Now()
 		subResult        = make(chan fetchResult, 1) // to collect results from subscriptions
 		ready            = make(chan struct{})       // to signal that all subscriptions are fetched
 		subscriptionsLen = len(group.Subscriptions)
-		avgURLsLen       = subscriptionsLen * avgSubURLs
 	)
 	defer close(subResult)
-	slog.Info("fetchGroup", "group", group.Name, "subscriptions", subscriptionsLen)
+	logger.Info("fetchGroup", "group", group.Name, "subscriptions", subscriptionsLen, "static", len(group.Static))
 
-	urls := make([]string, 0, avgURLsLen)
+	results := make(map[string][]string, subscriptionsLen)
 	go func() {
 		for range subscriptionsLen {
 			if res := <-subResult; res.error != nil {
-				slog.Error("fetchError", "group", group.Name, "subscription", res.subscription, "error", res.error)
+				logger.Error("fetchError", "group", group.Name, "subscription", res.subscription, "error", res.error)
 			} else {
-				urls = append(urls, res.urls...)
+				results[res.subscription] = res.urls
 			}
 		}
 		close(ready) // all subscriptions are fetched
@@ -222,32 +526,92 @@ func (c *Crawler) fetchGroup(group *cfg.Group) {
 			defer func() {
 				<-c.semaphore
 				if r := recover(); r != nil {
-					slog.Error("fetch subscription panic", "group", name, "subscription", sub.Name, "recover", r)
+					logger.Error("fetch subscription panic", "group", name, "subscription", sub.Name, "recover", r)
 					subResult <- fetchResult{subscription: sub.Name, error: fmt.Errorf("fetch sub panic: %v", r)}
 				}
 			}()
-			c.fetchSubscription(name, sub, subResult)
+			c.fetchSubscription(name, sub, reqID, subResult)
 		}(group.Name, &group.Subscriptions[i])
 	}
 
 	<-ready
-	result := prepareGroupResult(urls, group.Encoded)
+	var (
+		seed     = rand.Uint64() // #nosec G404 -- sampling doesn't need a secure random generator
+		rnd      = rand.New(rand.NewPCG(seed, seed))
+		selected = mergeSubscriptions(group, results)
+		lists    = make([][]string, 0, len(selected)+1)
+	)
+
+	lists = append(lists, group.Static)
+	for _, res := range selected {
+		if sub, ok := group.Subscription(res.subscription); ok {
+			lists = append(lists, limitURLs(res.urls, sub.MaxURLs, sub.MaxURLsMode, rnd))
+		}
+	}
+
+	var (
+		urls   = limitGroup(lists, group.MaxURLs, group.MaxURLsMode, rnd)
+		result = prepareGroupResult(urls, group.Encoded)
+		// a group without subscriptions has only static values, so it can't fail
+		succeeded = subscriptionsLen == 0 || len(results) > 0
+	)
 
 	c.Lock()
 	c.result[group.Name] = result
 	c.Unlock()
 
-	slog.Info("fetched", "group", group.Name, "urls", len(urls), "bytes", len(result), "duration", time.Since(start))
+	end := time.Now()
+	status := GroupStatus{
+		Name:      group.Name,
+		LastStart: start,
+		LastEnd:   end,
+		Duration:  cfg.Duration(end.Sub(start)),
+		URLs:      len(urls),
+		Bytes:     len(result),
+	}
+
+	groupURLs.Set(float64(len(urls)), group.Name)
+	if succeeded {
+		status.LastSuccess = end
+	} else {
+		logger.Warn("all subscriptions failed", "group", group.Name, "subscriptions", subscriptionsLen)
+	}
+	c.setGroupStatus(status)
+
+	logger.Info(
+		"fetched",
+		"group", group.Name,
+		"merge", group.Merge,
+		"selected", len(selected),
+		"seed", seed,
+		"urls", len(urls),
+		"bytes", len(result),
+		"duration", end.Sub(start),
+	)
+}
+
+// retryPolicy returns a retry policy of the subscription, its own options have priority over the crawler's ones.
+func (c *Crawler) retryPolicy(sub *cfg.Subscription) *RetryPolicy {
+	if sub.Retry != nil {
+		return NewRetryPolicy(sub.Retry, c.retries)
+	}
+
+	return NewRetryPolicy(&c.retry, c.retries)
 }
 
+// fetchURLSubscription fetches the subscription if sub.Path is a remote URL.
 func (c *Crawler) fetchURLSubscription(ctx context.Context, sub *cfg.Subscription) (io.ReadCloser, int, error) {
+	ctx = WithRetryPolicy(ctx, c.retryPolicy(sub))
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sub.Path.String(), nil)
 	if err != nil {
 		return nil, 0, fmt.Errorf("new request error: %w", err)
 	}
 
 	req.Header.Set("User-Agent", c.userAgent)
-	resp, err := c.client.Do(req)
+	if reqID := RequestID(ctx); reqID != "" {
+		req.Header.Set(requestIDHeader, reqID)
+	}
+	resp, err := c.client.Load().Do(req)
 
 	if err != nil {
 		return nil, 0, fmt.Errorf("client do error: %w", err)
@@ -256,13 +620,12 @@ func (c *Crawler) fetchURLSubscription(ctx context.Context, sub *cfg.Subscriptio
 	return resp.Body, resp.StatusCode, nil
 }
 
-// fetchLocalSubscription fetches the subscription if sub.Path is a local file.
-func (c *Crawler) fetchLocalSubscription(ctx context.Context, sub *cfg.Subscription) (io.ReadCloser, int, error) {
+// fetchLocalSubscription fetches the subscription if its source is a local file.
+func (c *Crawler) fetchLocalSubscription(ctx context.Context, fileName string) (io.ReadCloser, int, error) {
 	var (
-		fd       *os.File
-		err      error
-		done     = make(chan struct{})
-		fileName = sub.Path.String()
+		fd   *os.File
+		err  error
+		done = make(chan struct{})
 	)
 
 	go func() {
@@ -293,63 +656,198 @@ func (c *Crawler) fetchLocalSubscription(ctx context.Context, sub *cfg.Subscript
 	}
 }
 
+// localSources returns local files of the subscription relative to the root directory.
+// A subscription path can be a file, a directory or a glob pattern of files in a directory,
+// for two last cases every regular file is a separate source, nested directories are ignored.
+// Files are listed by os.Root, so symbolic links can't lead out of the root directory.
+func (c *Crawler) localSources(sub *cfg.Subscription) ([]string, bool, error) {
+	fileName := sub.Path.String()
+	dir, pattern, isPattern := sub.Path.Pattern()
+
+	root, err := os.OpenRoot(c.rootDir)
+	if err != nil {
+		return nil, false, fmt.Errorf("open root=%q error: %w", c.rootDir, err)
+	}
+	defer func() {
+		if closeErr := root.Close(); closeErr != nil {
+			slog.Error("root close error", "root", c.rootDir, "error", closeErr)
+		}
+	}()
+
+	if !isPattern {
+		info, statErr := root.Stat(fileName)
+		if statErr != nil || !info.IsDir() {
+			// a single file, open errors are handled by fetchLocalSubscription
+			return []string{fileName}, false, nil
+		}
+		dir = fileName
+	}
+
+	d, err := root.Open(dir)
+	if err != nil {
+		return nil, true, fmt.Errorf("open directory=%q error: %w", dir, err)
+	}
+
+	entries, err := d.ReadDir(-1)
+	if closeErr := d.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if err != nil {
+		return nil, true, fmt.Errorf("read directory=%q error: %w", dir, err)
+	}
+
+	sources := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if isPattern {
+			if ok, _ := filepath.Match(pattern, entry.Name()); !ok {
+				continue
+			}
+		}
+
+		name := filepath.Join(dir, entry.Name())
+		if info, statErr := root.Stat(name); statErr != nil || !info.Mode().IsRegular() {
+			slog.Debug("skip local source", "file", name, "error", statErr)
+			continue
+		}
+
+		sources = append(sources, name)
+	}
+
+	slices.Sort(sources) // stable order of sources
+	return sources, true, nil
+}
+
+// readSource fetches and reads one source of the subscription, a remote URL or a local file.
+// It also returns the response status code, it's http.StatusOK for local files and 0 for inline values.
+func (c *Crawler) readSource(ctx context.Context, sub *cfg.Subscription, source string) ([]string, int64, int, error) {
+	var (
+		statusCode int
+		reader     io.ReadCloser
+		err        error
+	)
+
+	switch {
+	case sub.IsInline():
+		urls, n, inlineErr := inlineSubscription(sub.Inline)
+		return urls, n, 0, inlineErr
+	case sub.Local:
+		reader, statusCode, err = c.fetchLocalSubscription(ctx, source)
+	default:
+		reader, statusCode, err = c.fetchURLSubscription(ctx, sub)
+	}
+
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("fetch error: %w", err)
+	}
+
+	defer func() {
+		if e := reader.Close(); e != nil {
+			slog.Error("reader close error", "subscription", sub.Name, "source", source, "error", e)
+		}
+	}()
+
+	if statusCode != http.StatusOK {
+		return nil, 0, statusCode, fmt.Errorf("response status error: %d", statusCode)
+	}
+
+	urls, n, err := readSubscription(reader, sub.Encoded)
+	if err != nil {
+		return nil, 0, statusCode, fmt.Errorf("read subscription error: %w", err)
+	}
+
+	return urls, n, statusCode, nil
+}
+
 // fetchSubscription fetches the subscription urls.
-func (c *Crawler) fetchSubscription(groupName string, sub *cfg.Subscription, result chan<- fetchResult) {
+// The request ID is forwarded to upstreams if it's not empty.
+func (c *Crawler) fetchSubscription(groupName string, sub *cfg.Subscription, reqID string, result chan<- fetchResult) {
 	var (
+		logger      = requestLogger(reqID)
 		fetchRes    = fetchResult{subscription: sub.Name}
-		ctx, cancel = context.WithTimeout(c.ctx, sub.Timeout.Timed())
-		statusCode  int
-		reader      io.ReadCloser
+		key         = subKey{group: groupName, subscription: sub.Name}
+		ctx, cancel = context.WithTimeout(WithRequestID(c.ctx, reqID), sub.Timeout.Timed())
+		sources     = []string{sub.Path.String()}
+		start       = time.Now()
+		status      = SubscriptionStatus{Name: sub.Name, FetchedAt: start}
+		multiSource bool
+		urls        []string
+		sourceErrs  []error
+		n           int64
 		err         error
 	)
 	defer func() {
+		status = status.done(fetchRes, start)
+		c.setSubscriptionStatus(key, status)
+		observeFetch(groupName, &status)
 		result <- fetchRes
 		cancel()
 	}()
 
-	slog.Debug(
+	logger.Debug(
 		"fetchSubscription",
 		"group", groupName,
 		"subscription", sub.Name,
 		"local", sub.Local,
+		"inline", sub.IsInline(),
 		"has_prefixes", sub.HasPrefixes,
 		"url", sub.Path,
 	)
-	start := time.Now()
 
 	if sub.Local {
-		reader, statusCode, err = c.fetchLocalSubscription(ctx, sub)
-	} else {
-		reader, statusCode, err = c.fetchURLSubscription(ctx, sub)
+		if sources, multiSource, err = c.localSources(sub); err != nil {
+			fetchRes.error = fmt.Errorf("local sources error: %w", err)
+			return
+		}
 	}
 
-	if err != nil {
-		fetchRes.error = fmt.Errorf("fetch error: %w", err)
-		return
-	}
+	for _, source := range sources {
+		sourceURLs, sourceBytes, statusCode, sourceErr := c.readSource(ctx, sub, source)
+		status.StatusCode = statusCode
 
-	defer func() {
-		if e := reader.Close(); e != nil {
-			slog.Error("reader close error", "group", groupName, "subscription", sub.Name, "error", e)
+		if sourceErr != nil {
+			if multiSource {
+				// a failed file doesn't break other sources of the subscription
+				logger.Error("source error", "group", groupName, "subscription", sub.Name, "source", source, "error", sourceErr)
+				sourceErrs = append(sourceErrs, sourceErr)
+				continue
+			}
+			err = sourceErr
+			break
 		}
-	}()
 
-	if statusCode != http.StatusOK {
-		fetchRes.error = fmt.Errorf("response status error: %d", statusCode)
-		return
+		urls = append(urls, sourceURLs...)
+		n += sourceBytes
+	}
+	status.Bytes, status.Lines = n, len(urls)
+
+	if len(sources) > 0 && len(sourceErrs) == len(sources) {
+		// the subscription is failed if all its sources are failed, so its cached result is kept
+		err = fmt.Errorf("all %d sources failed: %w", len(sources), errors.Join(sourceErrs...))
 	}
 
-	urls, n, err := readSubscription(reader, sub.Encoded)
 	if err != nil {
-		fetchRes.error = fmt.Errorf("read subscription error: %w", err)
+		if errors.Is(err, ErrCircuitOpen) {
+			if cachedURLs, ok := c.cached(key); ok {
+				logger.Warn("use cached subscription", "group", groupName, "subscription", sub.Name, "urls", len(cachedURLs), "error", err)
+				fetchRes.urls = cachedURLs
+				status.Cached, status.Error = true, err.Error()
+				return
+			}
+		}
+
+		fetchRes.error = err
 		return
 	}
 
 	fetchRes.urls = sub.Filter(urls)
-	slog.Info("fetched",
+	c.setCached(key, fetchRes.urls)
+
+	logger.Info("fetched",
 		"group", groupName,
 		"subscription", sub.Name,
 		"encoded", sub.Encoded,
+		"sources", len(sources),
 		"size", len(urls),
 		"filtered", len(fetchRes.urls),
 		"prefixes", len(sub.HasPrefixes),
@@ -358,6 +856,17 @@ func (c *Crawler) fetchSubscription(groupName string, sub *cfg.Subscription, res
 	)
 }
 
+// inlineSubscription returns a copy of inline values and their total size.
+func inlineSubscription(values []string) ([]string, int64, error) {
+	var n int64
+
+	for _, value := range values {
+		n += int64(len(value))
+	}
+
+	return slices.Clone(values), n, nil
+}
+
 // readSubscription reads the subscription data from the reader (HTTP response body).
 func readSubscription(r io.Reader, encoded bool) ([]string, int64, error) {
 	var (
@@ -1,6 +1,7 @@
 package crawler
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -125,6 +126,60 @@ func TestCrawler_Get(t *testing.T) {
 			expected: []byte("line1\nline2"),
 			decode:   true,
 		},
+		{
+			name: "static and inline",
+			group: cfg.Group{
+				Name:   "test5",
+				Static: []string{"line5"},
+				Subscriptions: []cfg.Subscription{
+					{
+						Name:    "sub1",
+						Path:    cfg.SubPath(server.URL),
+						Timeout: cfg.Duration(time.Second),
+					},
+					{
+						Name:   "sub2",
+						Inline: []string{"line3", "line4"},
+					},
+				},
+				Period: cfg.Duration(time.Second),
+			},
+			force:    true,
+			expected: []byte("line1\nline2\nline3\nline4\nline5"),
+		},
+		{
+			name: "limited urls",
+			group: cfg.Group{
+				Name:        "test7",
+				Static:      []string{"line1"},
+				MaxURLs:     3,
+				MaxURLsMode: cfg.SelectRoundRobin,
+				Subscriptions: []cfg.Subscription{
+					{
+						Name:    "sub1",
+						Inline:  []string{"line2", "line3", "line4"},
+						MaxURLs: 2,
+					},
+					{
+						Name:   "sub2",
+						Inline: []string{"line5", "line6"},
+					},
+				},
+				Period: cfg.Duration(time.Second),
+			},
+			force:    true,
+			expected: []byte("line1\nline2\nline5"),
+		},
+		{
+			name: "only static",
+			group: cfg.Group{
+				Name:   "test6",
+				Static: []string{"line2", "line1"},
+				Period: cfg.Duration(time.Second),
+			},
+			force:    true,
+			expected: []byte("line1\nline2"),
+		},
 		{
 			name: "get error",
 			group: cfg.Group{
@@ -157,7 +212,7 @@ func TestCrawler_Get(t *testing.T) {
 				c.Unlock()
 			}
 
-			got, err := c.Get(tc.group.Name, tc.force, tc.decode)
+			got, err := c.Get(context.Background(), tc.group.Name, tc.force, tc.decode)
 			if err != nil {
 				if !tc.errExpected {
 					t.Errorf("unexpected error: %v", err)
@@ -367,6 +422,15 @@ func TestCrawler_fetchSubscription(t *testing.T) {
 			},
 			expected: []string{"line10", "line20"},
 		},
+		{
+			name: "inline values",
+			subscription: cfg.Subscription{
+				Name:        "inline",
+				Inline:      []string{"vless://a", "ss://b", "vless://c"},
+				HasPrefixes: cfg.Prefixes{"vless://"},
+			},
+			expected: []string{"vless://a", "vless://c"},
+		},
 		{
 			name: "encoded response",
 			handler: func(w http.ResponseWriter, r *http.Request) {
@@ -436,7 +500,7 @@ func TestCrawler_fetchSubscription(t *testing.T) {
 			c := New([]cfg.Group{}, userAgentDefault, retriesDefault, maxConcurrentDefault, tmpDir)
 			result := make(chan fetchResult)
 
-			go c.fetchSubscription("test-group", &tc.subscription, result)
+			go c.fetchSubscription("test-group", &tc.subscription, "", result)
 
 			select {
 			case res := <-result:
@@ -627,7 +691,7 @@ func BenchmarkCrawler_fetchGroup(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		c.fetchGroup(&group)
+		c.fetchGroup(&group, "")
 	}
 }
 
@@ -701,3 +765,201 @@ func TestDecodeGroup(t *testing.T) {
 		})
 	}
 }
+
+func TestCrawler_fetchLocalSources(t *testing.T) {
+	var (
+		tmpDir  = t.TempDir()
+		rootDir = filepath.Join(tmpDir, "root")
+		encoded = base64.StdEncoding.EncodeToString([]byte("line30\nline40"))
+	)
+
+	writeFile(t, filepath.Join(rootDir, "nodes", "a.txt"), "line10\nline20")
+	writeFile(t, filepath.Join(rootDir, "nodes", "b.txt"), "line30")
+	writeFile(t, filepath.Join(rootDir, "nodes", "c.csv"), "line50")
+	writeFile(t, filepath.Join(rootDir, "nodes", "nested", "d.txt"), "line60")
+	writeFile(t, filepath.Join(rootDir, "encoded", "a.txt"), encoded)
+	writeFile(t, filepath.Join(rootDir, "encoded", "b.txt"), encoded)
+	writeFile(t, filepath.Join(tmpDir, "out.txt"), "line70")
+
+	if err := os.Symlink(filepath.Join(tmpDir, "out.txt"), filepath.Join(rootDir, "nodes", "out.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		encoded  bool
+		sources  []string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "file",
+			path:     "nodes/a.txt",
+			sources:  []string{"nodes/a.txt"},
+			expected: []string{"line10", "line20"},
+		},
+		{
+			name:     "directory",
+			path:     "nodes",
+			sources:  []string{"nodes/a.txt", "nodes/b.txt", "nodes/c.csv"},
+			expected: []string{"line10", "line20", "line30", "line50"},
+		},
+		{
+			name:     "pattern",
+			path:     "nodes/*.txt",
+			sources:  []string{"nodes/a.txt", "nodes/b.txt"},
+			expected: []string{"line10", "line20", "line30"},
+		},
+		{
+			name:     "encoded files",
+			path:     "encoded",
+			encoded:  true,
+			sources:  []string{"encoded/a.txt", "encoded/b.txt"},
+			expected: []string{"line30", "line40", "line30", "line40"},
+		},
+		{
+			name:    "empty pattern",
+			path:    "nodes/*.json",
+			sources: []string{},
+		},
+		{
+			name:    "unknown pattern directory",
+			path:    "unknown/*.txt",
+			wantErr: true,
+		},
+	}
+
+	c := New([]cfg.Group{}, userAgentDefault, retriesDefault, maxConcurrentDefault, rootDir)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sub := &cfg.Subscription{
+				Name:    "local",
+				Path:    cfg.SubPath(tc.path),
+				Encoded: tc.encoded,
+				Timeout: cfg.Duration(time.Second),
+				Local:   true,
+			}
+
+			sources, _, err := c.localSources(sub)
+			if err != nil {
+				if !tc.wantErr {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if tc.wantErr {
+				t.Fatal("expected error")
+			}
+
+			if !slices.Equal(sources, tc.sources) {
+				t.Errorf("sources = %q, want %q", sources, tc.sources)
+			}
+
+			result := make(chan fetchResult, 1)
+			c.fetchSubscription("test-group", sub, "", result)
+
+			if res := <-result; res.error != nil || !slices.Equal(res.urls, tc.expected) {
+				t.Errorf("fetchSubscription() = %q, %v, want %q", res.urls, res.error, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCrawler_fetchLocalSourcesFailed(t *testing.T) {
+	var (
+		rootDir = t.TempDir()
+		encoded = base64.StdEncoding.EncodeToString([]byte("line10"))
+		key     = subKey{group: "test-group", subscription: "local"}
+		sub     = &cfg.Subscription{
+			Name:    key.subscription,
+			Path:    "nodes",
+			Encoded: true,
+			Timeout: cfg.Duration(time.Second),
+			Local:   true,
+		}
+		c      = New([]cfg.Group{}, userAgentDefault, retriesDefault, maxConcurrentDefault, rootDir)
+		result = make(chan fetchResult, 1)
+	)
+
+	writeFile(t, filepath.Join(rootDir, "nodes", "a.txt"), encoded)
+	writeFile(t, filepath.Join(rootDir, "nodes", "b.txt"), "not base64 data")
+
+	// a failed file doesn't break the subscription
+	c.fetchSubscription(key.group, sub, "", result)
+	if res := <-result; res.error != nil || !slices.Equal(res.urls, []string{"line10"}) {
+		t.Fatalf("fetchSubscription() = %q, %v", res.urls, res.error)
+	}
+
+	writeFile(t, filepath.Join(rootDir, "nodes", "a.txt"), "not base64 data")
+	c.fetchSubscription(key.group, sub, "", result)
+
+	if res := <-result; res.error == nil || len(res.urls) != 0 {
+		t.Errorf("fetchSubscription() = %q, %v, want error", res.urls, res.error)
+	}
+
+	if cached, ok := c.cached(key); !ok || !slices.Equal(cached, []string{"line10"}) {
+		t.Errorf("cached result = %q, %v", cached, ok)
+	}
+
+	c.statusMu.RLock()
+	status := c.subStatus[key]
+	c.statusMu.RUnlock()
+
+	if status.Error == "" || status.Cached {
+		t.Errorf("unexpected failed status: %+v", status)
+	}
+}
+
+func TestCrawler_GetRequestID(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		requestIDs []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requestIDs = append(requestIDs, r.Header.Get(requestIDHeader))
+		mu.Unlock()
+
+		if _, err := w.Write([]byte("ss://a")); err != nil {
+			t.Errorf("failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	group := cfg.Group{
+		Name:          "test",
+		Period:        cfg.Duration(time.Hour),
+		Subscriptions: []cfg.Subscription{{Name: "sub", Path: cfg.SubPath(server.URL), Timeout: cfg.Duration(time.Second)}},
+	}
+
+	c := New([]cfg.Group{group}, userAgentDefault, 1, maxConcurrentDefault, "")
+	defer c.Shutdown()
+
+	ctx := WithRequestID(context.Background(), "req-123")
+	if reqID := RequestID(ctx); reqID != "req-123" {
+		t.Errorf("got request ID %q, want req-123", reqID)
+	}
+
+	// not forced request doesn't fetch
+	if _, err := c.Get(ctx, group.Name, false, false); !errors.Is(err, ErrNotFoundGroup) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := c.Get(ctx, group.Name, true, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get(context.Background(), group.Name, true, false); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !slices.Equal(requestIDs, []string{"req-123", ""}) {
+		t.Errorf("got request IDs %q", requestIDs)
+	}
+}
@@ -0,0 +1,90 @@
+package crawler
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+// GroupHealth is a freshness state of the group result.
+type GroupHealth struct {
+	Name        string       `json:"name"`
+	Ready       bool         `json:"ready"` // the group had a fetch with a successful subscription
+	LastEnd     time.Time    `json:"last_end,omitzero"`
+	LastSuccess time.Time    `json:"last_success,omitzero"`
+	Age         cfg.Duration `json:"age"` // time since the last successful fetch, zero if there were no ones
+	Period      cfg.Duration `json:"period"`
+	Stale       bool         `json:"stale"`
+}
+
+// Health is a freshness state of all groups.
+type Health struct {
+	Healthy bool          `json:"healthy"` // there are no stale groups
+	Ready   bool          `json:"ready"`   // all groups had successful fetches
+	Groups  []GroupHealth `json:"groups"`
+}
+
+// Health returns freshness states of groups ordered by names.
+// A fetch is successful if at least one subscription of the group succeeded.
+// A group is stale if its last successful fetch is older than the stale factor multiplied by its period
+// or all its fetches failed. A group without fetches is not ready, but it isn't stale.
+func (c *Crawler) Health(staleFactor float64, now time.Time) Health {
+	c.groupsMu.RLock()
+	groups := make([]GroupHealth, 0, len(c.groups))
+	for name, group := range c.groups {
+		groups = append(groups, GroupHealth{Name: name, Period: group.Period})
+	}
+	c.groupsMu.RUnlock()
+
+	c.statusMu.RLock()
+	for i := range groups {
+		status := c.groupStatus[groups[i].Name]
+		groups[i].LastEnd, groups[i].LastSuccess = status.LastEnd, status.LastSuccess
+	}
+	c.statusMu.RUnlock()
+
+	health := Health{Healthy: true, Ready: true, Groups: groups}
+	for i := range groups {
+		group := &groups[i]
+		group.Ready = !group.LastSuccess.IsZero()
+
+		if group.Ready {
+			group.Age = cfg.Duration(now.Sub(group.LastSuccess))
+			group.Stale = float64(group.Age) > staleFactor*float64(group.Period)
+		} else {
+			group.Stale = !group.LastEnd.IsZero()
+		}
+
+		health.Ready = health.Ready && group.Ready
+		health.Healthy = health.Healthy && !group.Stale
+	}
+
+	slices.SortFunc(groups, func(a, b GroupHealth) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return health
+}
+
+// Ready returns true if all groups had fetches with successful subscriptions.
+func (c *Crawler) Ready() bool {
+	c.groupsMu.RLock()
+	names := make([]string, 0, len(c.groups))
+	for name := range c.groups {
+		names = append(names, name)
+	}
+	c.groupsMu.RUnlock()
+
+	c.statusMu.RLock()
+	defer c.statusMu.RUnlock()
+
+	for _, name := range names {
+		if c.groupStatus[name].LastSuccess.IsZero() {
+			return false
+		}
+	}
+
+	return true
+}
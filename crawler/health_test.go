@@ -0,0 +1,121 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+func TestCrawler_Health(t *testing.T) {
+	groups := []cfg.Group{
+		{Name: "b-group", Period: cfg.Duration(time.Hour), Static: []string{"ss://b"}},
+		{Name: "a-group", Period: cfg.Duration(time.Minute), Static: []string{"ss://a"}},
+	}
+
+	c := New(groups, userAgentDefault, 1, maxConcurrentDefault, "")
+	defer c.Shutdown()
+
+	now := time.Now()
+	health := c.Health(2, now)
+
+	if health.Ready || !health.Healthy || c.Ready() {
+		t.Errorf("unexpected health before fetches: %+v", health)
+	}
+
+	if n := len(health.Groups); n != 2 || health.Groups[0].Name != "a-group" || health.Groups[1].Name != "b-group" {
+		t.Fatalf("unexpected groups %+v", health.Groups)
+	}
+
+	for _, group := range groups {
+		if _, err := c.Get(context.Background(), group.Name, true, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if health = c.Health(2, time.Now()); !health.Ready || !health.Healthy || !c.Ready() {
+		t.Errorf("unexpected health after fetches: %+v", health)
+	}
+
+	// a-group is older than two its periods
+	health = c.Health(2, now.Add(3*time.Minute))
+	if !health.Ready || health.Healthy {
+		t.Errorf("unexpected health with stale group: %+v", health)
+	}
+
+	a, b := health.Groups[0], health.Groups[1]
+	if !a.Stale || a.Period != cfg.Duration(time.Minute) || a.Age < cfg.Duration(2*time.Minute) {
+		t.Errorf("unexpected stale group health: %+v", a)
+	}
+
+	if b.Stale || !b.Ready || b.LastEnd.IsZero() {
+		t.Errorf("unexpected fresh group health: %+v", b)
+	}
+}
+
+func TestCrawler_HealthFailedSubscriptions(t *testing.T) {
+	var failed atomic.Bool
+	failed.Store(true)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if failed.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ss://a"))
+	}))
+	defer server.Close()
+
+	group := cfg.Group{
+		Name:   "group",
+		Period: cfg.Duration(time.Minute),
+		Subscriptions: []cfg.Subscription{
+			{Name: "sub1", Path: cfg.SubPath(server.URL), Timeout: cfg.Duration(time.Second)},
+			{Name: "sub2", Path: cfg.SubPath(server.URL + "/other"), Timeout: cfg.Duration(time.Second)},
+		},
+	}
+
+	c := New([]cfg.Group{group}, userAgentDefault, 1, maxConcurrentDefault, "")
+	defer c.Shutdown()
+
+	fetch := func() {
+		if _, err := c.Get(context.Background(), group.Name, true, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every subscription fails
+	fetch()
+
+	health := c.Health(2, time.Now())
+	if c.Ready() || health.Ready || health.Healthy || !health.Groups[0].Stale || !health.Groups[0].LastSuccess.IsZero() {
+		t.Errorf("unexpected health after failed fetch: %+v", health)
+	}
+
+	failed.Store(false)
+	fetch()
+
+	status, _ := c.GroupStatus(group.Name)
+	lastSuccess := status.LastSuccess
+
+	if health = c.Health(2, time.Now()); !c.Ready() || !health.Ready || !health.Healthy || lastSuccess.IsZero() {
+		t.Errorf("unexpected health after successful fetch: %+v", health)
+	}
+
+	failed.Store(true)
+	fetch()
+
+	if status, _ = c.GroupStatus(group.Name); !status.LastSuccess.Equal(lastSuccess) || !status.LastEnd.After(lastSuccess) {
+		t.Errorf("last success is changed by failed fetch: %+v", status)
+	}
+
+	// the age is counted from the last successful fetch
+	health = c.Health(2, lastSuccess.Add(3*time.Minute))
+	if !health.Ready || health.Healthy || health.Groups[0].Age < cfg.Duration(3*time.Minute) {
+		t.Errorf("unexpected health with failing subscriptions: %+v", health)
+	}
+}
@@ -0,0 +1,129 @@
+package crawler
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+// mergeSubscriptions selects subscriptions' results by the group merge strategy.
+// The results map contains urls of successfully fetched subscriptions, a failed one is absent.
+// A fallback subscription is used only if its main subscription is used and has no urls.
+// Selected non-empty results are returned in subscriptions' priority order.
+func mergeSubscriptions(group *cfg.Group, results map[string][]string) []fetchResult {
+	var (
+		active     = make(map[string]bool, len(group.Subscriptions))
+		candidates = make([]*cfg.Subscription, 0, len(group.Subscriptions))
+		selected   = make([]fetchResult, 0, len(group.Subscriptions))
+	)
+
+	for i := range group.Subscriptions {
+		sub := &group.Subscriptions[i]
+		if isActive(group, sub.Name, results, active) {
+			candidates = append(candidates, sub)
+		}
+	}
+
+	// lower value is a higher priority, the configuration order is kept for equal priorities
+	slices.SortStableFunc(candidates, func(a, b *cfg.Subscription) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+
+	var tier int // priority of selected results for priority tiers strategy
+	for _, sub := range candidates {
+		urls := results[sub.Name]
+		if len(urls) == 0 {
+			continue
+		}
+
+		switch group.Merge {
+		case cfg.MergeFirstNonEmpty:
+			return append(selected, fetchResult{subscription: sub.Name, urls: urls})
+		case cfg.MergePriorityTiers:
+			if len(selected) > 0 && sub.Priority != tier {
+				// a higher priority tier has non-empty results
+				return selected
+			}
+			tier = sub.Priority
+		}
+
+		selected = append(selected, fetchResult{subscription: sub.Name, urls: urls})
+	}
+
+	return selected
+}
+
+// isActive returns true if the subscription's result should be used.
+// It's always true for main subscriptions, fallback ones depend on their main subscriptions.
+// The active map is used to memorize already checked subscriptions.
+func isActive(group *cfg.Group, name string, results map[string][]string, active map[string]bool) bool {
+	if ok, found := active[name]; found {
+		return ok
+	}
+
+	sub, ok := group.Subscription(name)
+	if !ok {
+		return false
+	}
+
+	target := sub.FallbackFor
+	if target != "" {
+		// fallbacks chains are validated to be acyclic
+		ok = isActive(group, target, results, active) && len(results[target]) == 0
+	}
+
+	active[name] = ok
+	return ok
+}
+
+// limitURLs returns at most n urls of the list selected by the mode, zero n means no limit.
+// The source list is not modified.
+func limitURLs(urls []string, n uint32, mode cfg.SelectMode, rnd *rand.Rand) []string {
+	if n == 0 || len(urls) <= int(n) {
+		return urls
+	}
+
+	if mode != cfg.SelectRandom {
+		return urls[:n]
+	}
+
+	// partial Fisher-Yates shuffle of a copy
+	sample := slices.Clone(urls)
+	for i := range int(n) {
+		j := i + rnd.IntN(len(sample)-i)
+		sample[i], sample[j] = sample[j], sample[i]
+	}
+
+	return sample[:n]
+}
+
+// limitGroup joins the lists of urls keeping at most n urls selected by the mode, zero n means no limit.
+// The round-robin mode takes urls one by one from every list in turn.
+func limitGroup(lists [][]string, n uint32, mode cfg.SelectMode, rnd *rand.Rand) []string {
+	var total int
+	for _, urls := range lists {
+		total += len(urls)
+	}
+
+	if mode != cfg.SelectRoundRobin || n == 0 || total <= int(n) {
+		joined := make([]string, 0, total)
+		for _, urls := range lists {
+			joined = append(joined, urls...)
+		}
+
+		return limitURLs(joined, n, mode, rnd)
+	}
+
+	result := make([]string, 0, n)
+	for i := 0; len(result) < int(n); i++ {
+		for _, urls := range lists {
+			if i < len(urls) && len(result) < int(n) {
+				result = append(result, urls[i])
+			}
+		}
+	}
+
+	return result
+}
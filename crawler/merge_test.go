@@ -0,0 +1,183 @@
+package crawler
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+func TestMergeSubscriptions(t *testing.T) {
+	subscriptions := []cfg.Subscription{
+		{Name: "primary", Priority: 1},
+		{Name: "backup", Priority: 1, FallbackFor: "primary"},
+		{Name: "reserve", Priority: 1, FallbackFor: "backup"},
+		{Name: "second", Priority: 2},
+		{Name: "first", Priority: 0},
+	}
+
+	tests := []struct {
+		name    string
+		merge   cfg.MergeStrategy
+		results map[string][]string
+		want    []string // names of selected subscriptions
+	}{
+		{
+			name:    "default union",
+			results: map[string][]string{"primary": {"a"}, "backup": {"b"}, "second": {"c"}, "first": {"d"}},
+			want:    []string{"first", "primary", "second"},
+		},
+		{
+			name:    "union with failed primary",
+			merge:   cfg.MergeUnion,
+			results: map[string][]string{"backup": {"b"}, "reserve": {"r"}, "second": {"c"}},
+			want:    []string{"backup", "second"},
+		},
+		{
+			name:    "union with empty primary and backup",
+			merge:   cfg.MergeUnion,
+			results: map[string][]string{"primary": {}, "reserve": {"r"}},
+			want:    []string{"reserve"},
+		},
+		{
+			name:    "first non empty",
+			merge:   cfg.MergeFirstNonEmpty,
+			results: map[string][]string{"primary": {"a"}, "first": {}, "second": {"c"}},
+			want:    []string{"primary"},
+		},
+		{
+			name:    "first non empty fallback",
+			merge:   cfg.MergeFirstNonEmpty,
+			results: map[string][]string{"backup": {"b"}, "second": {"c"}},
+			want:    []string{"backup"},
+		},
+		{
+			name:    "priority tiers",
+			merge:   cfg.MergePriorityTiers,
+			results: map[string][]string{"primary": {"a"}, "backup": {"b"}, "second": {"c"}},
+			want:    []string{"primary"},
+		},
+		{
+			name:    "priority tiers with fallback",
+			merge:   cfg.MergePriorityTiers,
+			results: map[string][]string{"first": {}, "backup": {"b"}, "second": {"c"}},
+			want:    []string{"backup"},
+		},
+		{
+			name:    "priority tiers last tier",
+			merge:   cfg.MergePriorityTiers,
+			results: map[string][]string{"first": {}, "second": {"c"}},
+			want:    []string{"second"},
+		},
+		{
+			name:    "all failed",
+			merge:   cfg.MergePriorityTiers,
+			results: map[string][]string{},
+			want:    []string{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			group := &cfg.Group{Name: "group", Merge: tc.merge, Subscriptions: subscriptions}
+			selected := mergeSubscriptions(group, tc.results)
+
+			names := make([]string, 0, len(selected))
+			for _, res := range selected {
+				if !slices.Equal(res.urls, tc.results[res.subscription]) {
+					t.Errorf("urls of %q = %v, want %v", res.subscription, res.urls, tc.results[res.subscription])
+				}
+				names = append(names, res.subscription)
+			}
+
+			if !slices.Equal(names, tc.want) {
+				t.Errorf("selected = %v, want %v", names, tc.want)
+			}
+		})
+	}
+}
+
+func TestLimitURLs(t *testing.T) {
+	urls := []string{"a", "b", "c", "d", "e"}
+
+	tests := []struct {
+		name string
+		n    uint32
+		mode cfg.SelectMode
+		want []string // nil for random results
+	}{
+		{name: "no limit", want: urls},
+		{name: "big limit", n: 10, mode: cfg.SelectRandom, want: urls},
+		{name: "default first", n: 2, want: []string{"a", "b"}},
+		{name: "first", n: 3, mode: cfg.SelectFirst, want: []string{"a", "b", "c"}},
+		{name: "random", n: 3, mode: cfg.SelectRandom},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewPCG(1, 2))
+			got := limitURLs(urls, tc.n, tc.mode, rnd)
+
+			if tc.want != nil {
+				if !slices.Equal(got, tc.want) {
+					t.Errorf("got = %v, want %v", got, tc.want)
+				}
+				return
+			}
+
+			if n := len(got); n != int(tc.n) {
+				t.Fatalf("length = %d, want %d", n, tc.n)
+			}
+
+			sorted := slices.Sorted(slices.Values(got))
+			if len(slices.Compact(sorted)) != len(got) {
+				t.Errorf("duplicated values: %v", got)
+			}
+
+			for _, u := range got {
+				if !slices.Contains(urls, u) {
+					t.Errorf("unexpected value %q", u)
+				}
+			}
+
+			// the same seed gives the same sample
+			if again := limitURLs(urls, tc.n, tc.mode, rand.New(rand.NewPCG(1, 2))); !slices.Equal(got, again) {
+				t.Errorf("not reproducible sample %v != %v", got, again)
+			}
+		})
+	}
+
+	if !slices.Equal(urls, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("source urls are modified: %v", urls)
+	}
+}
+
+func TestLimitGroup(t *testing.T) {
+	lists := [][]string{{"s1"}, {"a1", "a2", "a3", "a4"}, {}, {"b1", "b2"}}
+
+	tests := []struct {
+		name string
+		n    uint32
+		mode cfg.SelectMode
+		want []string
+	}{
+		{name: "no limit", mode: cfg.SelectRoundRobin, want: []string{"s1", "a1", "a2", "a3", "a4", "b1", "b2"}},
+		{name: "first", n: 3, want: []string{"s1", "a1", "a2"}},
+		{name: "round robin", n: 5, mode: cfg.SelectRoundRobin, want: []string{"s1", "a1", "b1", "a2", "b2"}},
+		{name: "round robin tail", n: 6, mode: cfg.SelectRoundRobin, want: []string{"s1", "a1", "b1", "a2", "b2", "a3"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := limitGroup(lists, tc.n, tc.mode, rand.New(rand.NewPCG(1, 2)))
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("got = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	if got := limitGroup(lists, 4, cfg.SelectRandom, rand.New(rand.NewPCG(1, 2))); len(got) != 4 {
+		t.Errorf("random length = %d, want 4", len(got))
+	}
+}
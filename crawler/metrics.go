@@ -0,0 +1,42 @@
+package crawler
+
+import (
+	"github.com/z0rr0/smerge/metrics"
+)
+
+var (
+	fetchDuration = metrics.NewHistogramVec(
+		"smerge_fetch_duration_seconds", "Duration of subscriptions' fetches.", nil, "group", "subscription",
+	)
+	fetchErrors = metrics.NewCounterVec(
+		"smerge_fetch_errors_total", "Number of failed subscriptions' fetches.", "group", "subscription",
+	)
+	fetchBytes = metrics.NewCounterVec(
+		"smerge_fetch_bytes_total", "Number of fetched bytes of subscriptions.", "group", "subscription",
+	)
+	groupURLs = metrics.NewGaugeVec(
+		"smerge_group_urls", "Number of URLs in the last group result.", "group",
+	)
+	semaphoreUsed = metrics.NewGaugeFunc(
+		"smerge_fetch_semaphore_used", "Number of running subscriptions' fetches.",
+	)
+	semaphoreCapacity = metrics.NewGaugeFunc(
+		"smerge_fetch_semaphore_capacity", "Maximum number of concurrent subscriptions' fetches.",
+	)
+)
+
+// observeFetch records metrics of the subscription fetch, a used cache is a failed fetch too.
+func observeFetch(groupName string, status *SubscriptionStatus) {
+	fetchDuration.Observe(status.Latency.Timed().Seconds(), groupName, status.Name)
+	fetchBytes.Add(float64(status.Bytes), groupName, status.Name)
+
+	if status.Error != "" {
+		fetchErrors.Inc(groupName, status.Name)
+	}
+}
+
+// observeSemaphore sets functions of semaphore metrics for the crawler.
+func (c *Crawler) observeSemaphore() {
+	semaphoreUsed.Set(func() float64 { return float64(len(c.semaphore)) })
+	semaphoreCapacity.Set(func() float64 { return float64(cap(c.semaphore)) })
+}
@@ -0,0 +1,139 @@
+package crawler
+
+import (
+	"log/slog"
+	"reflect"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+// Reload applies a new groups configuration without a restart.
+// Removed groups are stopped, new ones are started, changed groups are restarted with an immediate fetch,
+// unchanged groups keep running without any fetch. Last results of changed groups are served
+// until their new fetches are done, results and states of removed groups and subscriptions are dropped.
+// The HTTP client is replaced if the maximum subscription timeout is changed,
+// other crawler options (user agent, retries, circuit breaker, etc.) are not changed.
+func (c *Crawler) Reload(groups []cfg.Group) {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	if c.ctx.Err() != nil {
+		slog.Warn("crawler reload skipped, it is stopped")
+		return
+	}
+
+	newGroups := make(map[string]*cfg.Group, len(groups))
+	for i := range groups {
+		newGroups[groups[i].Name] = &groups[i]
+	}
+
+	var (
+		added, changed, removed []string
+		stopped                 []*groupHandler
+	)
+
+	c.groupsMu.Lock()
+	for name, group := range c.groups {
+		newGroup, ok := newGroups[name]
+		switch {
+		case !ok:
+			removed = append(removed, name)
+		case !reflect.DeepEqual(group, newGroup):
+			changed = append(changed, name)
+		default:
+			continue
+		}
+
+		if handler, ok := c.handlers[name]; ok {
+			handler.cancel()
+			stopped = append(stopped, handler)
+			delete(c.handlers, name)
+		}
+	}
+	c.groupsMu.Unlock()
+
+	// wait stopped handlers, so old and new handlers of a changed group don't run together
+	for _, handler := range stopped {
+		<-handler.done
+	}
+
+	// new and changed groups use the client with their timeouts from the first fetch
+	if timeout := maxSubscriptionTimeout(groups); timeout != c.timeout {
+		c.setTimeout(timeout)
+	}
+
+	c.groupsMu.Lock()
+	oldGroups := c.groups
+	c.groups = newGroups
+
+	for _, name := range removed {
+		delete(c.refresh, name)
+	}
+
+	for name, group := range newGroups {
+		if _, ok := oldGroups[name]; !ok {
+			added = append(added, name)
+			c.refresh[name] = make(chan struct{}, 1)
+		}
+
+		if _, ok := c.handlers[name]; !ok {
+			c.startGroup(group)
+		}
+	}
+	c.groupsMu.Unlock()
+
+	c.dropRemoved(newGroups)
+
+	if c.watchOpts.Enabled {
+		if c.watchCancel != nil {
+			c.watchCancel()
+		}
+		c.watchLocal()
+	}
+
+	slog.Info("crawler reloaded", "groups", len(newGroups), "added", added, "changed", changed, "removed", removed)
+}
+
+// dropRemoved deletes results, cache and states of groups and subscriptions which are not in the groups.
+func (c *Crawler) dropRemoved(groups map[string]*cfg.Group) {
+	exists := func(key subKey) bool {
+		group, ok := groups[key.group]
+		if !ok {
+			return false
+		}
+
+		_, ok = group.Subscription(key.subscription)
+		return ok
+	}
+
+	c.Lock()
+	for name := range c.result {
+		if _, ok := groups[name]; !ok {
+			delete(c.result, name)
+			groupURLs.Delete(name)
+		}
+	}
+	c.Unlock()
+
+	c.cacheMu.Lock()
+	for key := range c.cache {
+		if !exists(key) {
+			delete(c.cache, key)
+		}
+	}
+	c.cacheMu.Unlock()
+
+	c.statusMu.Lock()
+	for name := range c.groupStatus {
+		if _, ok := groups[name]; !ok {
+			delete(c.groupStatus, name)
+		}
+	}
+
+	for key := range c.subStatus {
+		if !exists(key) {
+			delete(c.subStatus, key)
+		}
+	}
+	c.statusMu.Unlock()
+}
@@ -0,0 +1,150 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+// waitResult waits the expected group result.
+func waitResult(c *Crawler, groupName, expected string) error {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		if data, err := c.Get(context.Background(), groupName, false, false); err == nil && string(data) == expected {
+			return nil
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	data, err := c.Get(context.Background(), groupName, false, false)
+	return errors.Join(err, errors.New("unexpected result "+string(data)+" of group "+groupName))
+}
+
+func TestCrawler_Reload(t *testing.T) {
+	var (
+		period = cfg.Duration(time.Hour)
+		group  = func(name string, values ...string) cfg.Group {
+			return cfg.Group{
+				Name:          name,
+				Period:        period,
+				Subscriptions: []cfg.Subscription{{Name: "sub1", Inline: values}},
+			}
+		}
+	)
+
+	c := New([]cfg.Group{group("kept", "a"), group("changed", "b"), group("removed", "c")}, userAgentDefault, retriesDefault, 1, "")
+	c.Run()
+	defer c.Shutdown()
+
+	for name, expected := range map[string]string{"kept": "a", "changed": "b", "removed": "c"} {
+		if err := waitResult(c, name, expected); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keptStatus, _ := c.GroupStatus("kept")
+
+	c.Reload([]cfg.Group{group("kept", "a"), group("changed", "b", "d"), group("added", "e")})
+
+	for name, expected := range map[string]string{"kept": "a", "changed": "b\nd", "added": "e"} {
+		if err := waitResult(c, name, expected); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := c.Get(context.Background(), "removed", false, false); !errors.Is(err, ErrNotFoundGroup) {
+		t.Errorf("expected not found error for removed group, got %v", err)
+	}
+
+	if _, ok := c.GroupStatus("removed"); ok {
+		t.Error("expected no status of removed group")
+	}
+
+	if c.Refresh("removed") {
+		t.Error("expected no refresh of removed group")
+	}
+
+	if status, _ := c.GroupStatus("kept"); !status.LastStart.Equal(keptStatus.LastStart) {
+		t.Errorf("unchanged group was fetched again: %v != %v", status.LastStart, keptStatus.LastStart)
+	}
+
+	c.cacheMu.RLock()
+	_, cached := c.cache[subKey{group: "removed", subscription: "sub1"}]
+	c.cacheMu.RUnlock()
+
+	if cached {
+		t.Error("expected no cache of removed group")
+	}
+
+	c.groupsMu.RLock()
+	handlers := len(c.handlers)
+	c.groupsMu.RUnlock()
+
+	if handlers != 3 {
+		t.Errorf("expected 3 group handlers, got %d", handlers)
+	}
+}
+
+func TestCrawler_ReloadStopped(t *testing.T) {
+	groups := []cfg.Group{{Name: "group1", Period: cfg.Duration(time.Hour)}}
+	c := New(groups, userAgentDefault, retriesDefault, 1, "")
+	c.Run()
+	c.Shutdown()
+
+	c.Reload([]cfg.Group{{Name: "group2", Period: cfg.Duration(time.Hour)}})
+	if _, ok := c.group("group2"); ok {
+		t.Error("stopped crawler should not be reloaded")
+	}
+}
+
+func TestCrawler_ReloadTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if _, err := w.Write([]byte("a")); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	group := func(timeout time.Duration) cfg.Group {
+		return cfg.Group{
+			Name:   "group1",
+			Period: cfg.Duration(time.Hour),
+			Subscriptions: []cfg.Subscription{
+				{Name: "sub1", Path: cfg.SubPath(server.URL), Timeout: cfg.Duration(timeout)},
+			},
+		}
+	}
+
+	opts := cfg.BreakerOptions{Failures: 3, Successes: 1, CoolDown: cfg.Duration(time.Minute)}
+	c := New([]cfg.Group{group(time.Second)}, userAgentDefault, retriesDefault, 1, "", WithBreakerOptions(opts))
+	c.Run()
+	defer c.Shutdown()
+
+	if err := waitResult(c, "group1", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Reload([]cfg.Group{group(3 * time.Second)})
+
+	client := c.client.Load()
+	if client.Timeout != 6*time.Second {
+		t.Errorf("got client timeout %v, want %v", client.Timeout, 6*time.Second)
+	}
+
+	if timeout := c.transport.transport.Load().ResponseHeaderTimeout; timeout != 3*time.Second {
+		t.Errorf("got response header timeout %v, want %v", timeout, 3*time.Second)
+	}
+
+	if client.Transport != c.breaker {
+		t.Error("circuit breaker is not kept")
+	}
+
+	if err := waitResult(c, "group1", "a"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+// SubscriptionStatus is a state of the last subscription fetch.
+type SubscriptionStatus struct {
+	Name       string       `json:"name"`
+	FetchedAt  time.Time    `json:"fetched_at,omitzero"`
+	StatusCode int          `json:"status_code,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	Cached     bool         `json:"cached,omitempty"`
+	Bytes      int64        `json:"bytes"`
+	Lines      int          `json:"lines"`    // number of values before filtering
+	Filtered   int          `json:"filtered"` // number of values after filtering
+	Latency    cfg.Duration `json:"latency"`
+}
+
+// done completes the status by the fetch result.
+func (s SubscriptionStatus) done(res fetchResult, start time.Time) SubscriptionStatus {
+	s.Latency = cfg.Duration(time.Since(start))
+	s.Filtered = len(res.urls)
+
+	if res.error != nil {
+		s.Error = res.error.Error()
+	}
+
+	return s
+}
+
+// GroupStatus is a state of the last group fetch.
+type GroupStatus struct {
+	Name          string               `json:"name"`
+	Endpoint      string               `json:"endpoint"`
+	LastStart     time.Time            `json:"last_start,omitzero"`
+	LastEnd       time.Time            `json:"last_end,omitzero"`
+	LastSuccess   time.Time            `json:"last_success,omitzero"` // end of the last fetch with a successful subscription
+	Duration      cfg.Duration         `json:"duration"`
+	URLs          int                  `json:"urls"`
+	Bytes         int                  `json:"bytes"`
+	NextRun       time.Time            `json:"next_run,omitzero"`
+	Subscriptions []SubscriptionStatus `json:"subscriptions"`
+}
+
+// setSubscriptionStatus stores the status of the last subscription fetch.
+func (c *Crawler) setSubscriptionStatus(key subKey, status SubscriptionStatus) {
+	c.statusMu.Lock()
+	c.subStatus[key] = status
+	c.statusMu.Unlock()
+}
+
+// setGroupStatus stores the status of the last group fetch, the next run time is kept,
+// the last success time is kept too if the fetch failed.
+func (c *Crawler) setGroupStatus(status GroupStatus) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	current := c.groupStatus[status.Name]
+	status.NextRun = current.NextRun
+
+	if status.LastSuccess.IsZero() {
+		status.LastSuccess = current.LastSuccess
+	}
+
+	c.groupStatus[status.Name] = status
+}
+
+// setNextRun stores the time of the next scheduled group fetch.
+func (c *Crawler) setNextRun(groupName string, next time.Time) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	status := c.groupStatus[groupName]
+	status.Name, status.NextRun = groupName, next
+	c.groupStatus[groupName] = status
+}
+
+// Status returns states of all groups ordered by names,
+// their subscriptions are in the configuration order.
+func (c *Crawler) Status() []GroupStatus {
+	c.statusMu.RLock()
+	defer c.statusMu.RUnlock()
+
+	c.groupsMu.RLock()
+	result := make([]GroupStatus, 0, len(c.groups))
+	for _, group := range c.groups {
+		result = append(result, c.buildGroupStatus(group))
+	}
+	c.groupsMu.RUnlock()
+
+	slices.SortFunc(result, func(a, b GroupStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return result
+}
+
+// GroupStatus returns the state of the group.
+func (c *Crawler) GroupStatus(groupName string) (GroupStatus, bool) {
+	group, ok := c.group(groupName)
+	if !ok {
+		return GroupStatus{}, false
+	}
+
+	c.statusMu.RLock()
+	defer c.statusMu.RUnlock()
+
+	return c.buildGroupStatus(group), true
+}
+
+// buildGroupStatus returns the group state with its subscriptions' states,
+// a subscription without fetches has only its name. A caller should hold the status read lock.
+func (c *Crawler) buildGroupStatus(group *cfg.Group) GroupStatus {
+	status := c.groupStatus[group.Name]
+	status.Name = group.Name
+	status.Endpoint = group.Endpoint
+	status.Subscriptions = make([]SubscriptionStatus, 0, len(group.Subscriptions))
+
+	for _, sub := range group.Subscriptions {
+		subStatus, ok := c.subStatus[subKey{group: group.Name, subscription: sub.Name}]
+		if !ok {
+			subStatus.Name = sub.Name
+		}
+		status.Subscriptions = append(status.Subscriptions, subStatus)
+	}
+
+	return status
+}
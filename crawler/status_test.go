@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+func TestCrawler_Status(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if _, err := w.Write([]byte("vless://a\nss://b\nvless://c")); err != nil {
+			t.Errorf("failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	groups := []cfg.Group{
+		{
+			Name:   "b-group",
+			Period: cfg.Duration(time.Hour),
+			Subscriptions: []cfg.Subscription{
+				{
+					Name:        "ok",
+					Path:        cfg.SubPath(server.URL),
+					Timeout:     cfg.Duration(time.Second),
+					HasPrefixes: cfg.Prefixes{"vless://"},
+				},
+				{Name: "fail", Path: cfg.SubPath(server.URL + "/fail"), Timeout: cfg.Duration(time.Second)},
+			},
+		},
+		{
+			Name:          "a-group",
+			Endpoint:      "/a",
+			Period:        cfg.Duration(time.Hour),
+			Subscriptions: []cfg.Subscription{{Name: "not-fetched", Inline: []string{"ss://x"}}},
+		},
+	}
+
+	c := New(groups, userAgentDefault, 1, maxConcurrentDefault, "")
+	defer c.Shutdown()
+
+	if _, err := c.Get(context.Background(), "b-group", true, false); err != nil {
+		t.Fatal(err)
+	}
+
+	status := c.Status()
+	if n := len(status); n != 2 {
+		t.Fatalf("status length = %d, want 2", n)
+	}
+
+	if name := status[0].Name; name != "a-group" {
+		t.Errorf("first group = %q, want a-group", name)
+	}
+
+	if endpoint := status[0].Endpoint; endpoint != "/a" {
+		t.Errorf("first group endpoint = %q, want /a", endpoint)
+	}
+
+	if s := status[0]; !s.LastStart.IsZero() || len(s.Subscriptions) != 1 || s.Subscriptions[0].Name != "not-fetched" {
+		t.Errorf("unexpected not fetched group status: %+v", s)
+	}
+
+	group, ok := c.GroupStatus("b-group")
+	if !ok {
+		t.Fatal("group status not found")
+	}
+
+	if group.LastStart.IsZero() || group.LastEnd.Before(group.LastStart) || group.URLs != 2 || group.Bytes == 0 {
+		t.Errorf("unexpected group status: %+v", group)
+	}
+
+	okSub, failSub := group.Subscriptions[0], group.Subscriptions[1]
+	if okSub.StatusCode != http.StatusOK || okSub.Lines != 3 || okSub.Filtered != 2 || okSub.Bytes != 26 || okSub.Error != "" {
+		t.Errorf("unexpected subscription status: %+v", okSub)
+	}
+
+	if failSub.StatusCode != http.StatusNotFound || !strings.Contains(failSub.Error, "404") || failSub.Filtered != 0 {
+		t.Errorf("unexpected failed subscription status: %+v", failSub)
+	}
+
+	if _, ok = c.GroupStatus("unknown"); ok {
+		t.Error("unexpected status of unknown group")
+	}
+
+	data, err := json.Marshal(&group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `"name":"fail","fetched_at":`) || !strings.Contains(string(data), `"status_code":404`) {
+		t.Errorf("unexpected json: %s", data)
+	}
+}
@@ -0,0 +1,258 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+// ErrWatchRoot is an error if a watched path is out of the root directory.
+var ErrWatchRoot = fmt.Errorf("path is out of root directory")
+
+// fileState is a state of a watched file for polling.
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// watchTarget is a watched local subscription path, a file, a directory or a glob pattern.
+type watchTarget struct {
+	key     string // subscription path, it's sent as an event
+	dir     string // directory of files relative to the root
+	pattern string // pattern of files' names, empty for all files of a directory
+	file    bool   // the path is a single file
+}
+
+// newWatchTarget creates a watch target for the subscription path.
+func newWatchTarget(root *os.Root, key string) watchTarget {
+	key = filepath.Clean(key)
+
+	if dir, pattern, ok := cfg.SubPath(key).Pattern(); ok {
+		return watchTarget{key: key, dir: dir, pattern: pattern}
+	}
+
+	if info, err := root.Stat(key); err == nil && info.IsDir() {
+		return watchTarget{key: key, dir: key}
+	}
+
+	return watchTarget{key: key, dir: filepath.Dir(key), file: true}
+}
+
+// match checks if the file name in the directory relates to the target.
+func (wt *watchTarget) match(relDir, name string) bool {
+	if relDir != wt.dir {
+		return false
+	}
+
+	switch {
+	case wt.file:
+		return filepath.Join(relDir, name) == wt.key
+	case wt.pattern != "":
+		ok, _ := filepath.Match(wt.pattern, name)
+		return ok
+	default:
+		return true
+	}
+}
+
+// states returns states of all target's files.
+func (wt *watchTarget) states(root *os.Root) map[string]fileState {
+	if wt.file {
+		return map[string]fileState{wt.key: statFile(root, wt.key)}
+	}
+
+	d, err := root.Open(wt.dir)
+	if err != nil {
+		slog.Warn("watch open directory", "directory", wt.dir, "error", err)
+		return nil
+	}
+
+	entries, err := d.ReadDir(-1)
+	if closeErr := d.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if err != nil {
+		slog.Warn("watch read directory", "directory", wt.dir, "error", err)
+	}
+
+	states := make(map[string]fileState, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !wt.match(wt.dir, entry.Name()) {
+			continue
+		}
+
+		name := filepath.Join(wt.dir, entry.Name())
+		states[name] = statFile(root, name)
+	}
+
+	return states
+}
+
+// watchTargets creates watch targets for the subscriptions' paths.
+func watchTargets(rootDir string, keys []string) ([]watchTarget, error) {
+	root, err := os.OpenRoot(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("open root %q: %w", rootDir, err)
+	}
+
+	targets := make([]watchTarget, 0, len(keys))
+	for _, key := range keys {
+		targets = append(targets, newWatchTarget(root, key))
+	}
+
+	return targets, root.Close()
+}
+
+// watchDirs returns a map of absolute directories to their relative names for watch targets.
+// It checks that every directory is inside the root directory, including symbolic links resolving.
+func watchDirs(rootDir string, targets []watchTarget) (map[string]string, error) {
+	realRoot, err := filepath.EvalSymlinks(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve root %q: %w", rootDir, err)
+	}
+
+	dirs := make(map[string]string, len(targets))
+	for _, target := range targets {
+		relDir := target.dir
+		if !filepath.IsLocal(relDir) {
+			return nil, errors.Join(ErrWatchRoot, fmt.Errorf("directory %q", relDir))
+		}
+
+		realDir, dirErr := filepath.EvalSymlinks(filepath.Join(realRoot, relDir))
+		if dirErr != nil {
+			return nil, fmt.Errorf("resolve directory %q: %w", relDir, dirErr)
+		}
+
+		if rel, relErr := filepath.Rel(realRoot, realDir); relErr != nil || !filepath.IsLocal(rel) {
+			return nil, errors.Join(ErrWatchRoot, fmt.Errorf("directory %q", relDir))
+		}
+
+		dirs[realDir] = relDir
+	}
+
+	return dirs, nil
+}
+
+// watchFiles starts watching of the subscriptions' paths relative to the root directory.
+// It returns a channel of changed paths, the channel is closed when the context is done.
+// The inotify is used if it's available and poll is false, otherwise files are polled with the interval.
+func watchFiles(ctx context.Context, rootDir string, keys []string, poll bool, interval time.Duration) <-chan string {
+	events := make(chan string)
+
+	go func() {
+		defer close(events)
+
+		targets, err := watchTargets(rootDir, keys)
+		if err != nil {
+			slog.Error("watch targets", "root", rootDir, "error", err)
+			return
+		}
+
+		if !poll {
+			if err = watchNotify(ctx, rootDir, targets, events); err == nil {
+				return
+			}
+			slog.Warn("file notifications are not available, use polling", "error", err)
+		}
+
+		watchPoll(ctx, rootDir, targets, interval, events)
+	}()
+
+	return events
+}
+
+// watchPoll checks files' states with the interval and sends changed targets' keys to events.
+// Files are opened by os.Root, so it can't read anything out of the root directory.
+func watchPoll(ctx context.Context, rootDir string, targets []watchTarget, interval time.Duration, events chan<- string) {
+	root, err := os.OpenRoot(rootDir)
+	if err != nil {
+		slog.Error("watch poll open root", "root", rootDir, "error", err)
+		return
+	}
+	defer func() {
+		if closeErr := root.Close(); closeErr != nil {
+			slog.Error("watch poll close root", "root", rootDir, "error", closeErr)
+		}
+	}()
+
+	var (
+		ticker = time.NewTicker(interval)
+		states = make([]map[string]fileState, len(targets))
+	)
+	defer ticker.Stop()
+
+	for i := range targets {
+		states[i] = targets[i].states(root)
+	}
+
+	slog.Info("watch local files by polling", "targets", len(targets), "interval", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for i := range targets {
+				current := targets[i].states(root)
+				if maps.Equal(current, states[i]) {
+					continue
+				}
+
+				states[i] = current
+				if !sendEvent(ctx, events, targets[i].key) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// statFile returns the state of the file inside the root.
+func statFile(root *os.Root, name string) fileState {
+	info, err := root.Stat(name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("watch stat file", "file", name, "error", err)
+		}
+		return fileState{}
+	}
+
+	return fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// sendEvent sends the target key to events or returns false if the context is done.
+func sendEvent(ctx context.Context, events chan<- string, key string) bool {
+	select {
+	case events <- key:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sendMatched sends keys of targets related to the file in the directory.
+// It returns false if the context is done.
+func sendMatched(ctx context.Context, events chan<- string, targets []watchTarget, relDir, name string) bool {
+	name = strings.TrimRight(name, "\x00")
+	if name == "" {
+		return true
+	}
+
+	for i := range targets {
+		if targets[i].match(relDir, name) && !sendEvent(ctx, events, targets[i].key) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,103 @@
+//go:build linux
+
+package crawler
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"syscall"
+)
+
+const (
+	// inotifyMask is a set of directory events that can change a watched file.
+	inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM |
+		syscall.IN_CREATE | syscall.IN_DELETE
+	// inotifyBufferSize is a size of buffer for inotify events reading.
+	inotifyBufferSize = 64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1)
+)
+
+// watchNotify watches directories of the targets using inotify and sends keys of changed targets to events.
+// It returns an error if inotify can't be initialized, otherwise it works until the context is done.
+func watchNotify(ctx context.Context, rootDir string, targets []watchTarget, events chan<- string) error {
+	dirs, err := watchDirs(rootDir, targets)
+	if err != nil {
+		return err
+	}
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify init: %w", err)
+	}
+
+	// a non-blocking descriptor is handled by runtime poller, so Close interrupts Read
+	f := os.NewFile(uintptr(fd), "inotify")
+	descriptors := make(map[int32]string, len(dirs))
+
+	for absDir, relDir := range dirs {
+		wd, addErr := syscall.InotifyAddWatch(fd, absDir, inotifyMask)
+		if addErr != nil {
+			return errors.Join(fmt.Errorf("inotify watch %q: %w", relDir, addErr), f.Close())
+		}
+		descriptors[int32(wd)] = relDir // #nosec G115 -- watch descriptors are int32 in inotify events
+	}
+
+	go func() {
+		<-ctx.Done()
+		if closeErr := f.Close(); closeErr != nil {
+			slog.Error("inotify close", "error", closeErr)
+		}
+	}()
+
+	slog.Info("watch local files by inotify", "targets", len(targets), "directories", len(descriptors))
+	readNotify(ctx, f, descriptors, targets, events)
+
+	return nil
+}
+
+// readNotify reads inotify events from the file and sends keys of related targets to events.
+func readNotify(ctx context.Context, f *os.File, descriptors map[int32]string, targets []watchTarget, events chan<- string) {
+	buf := make([]byte, inotifyBufferSize)
+
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("inotify read", "error", err)
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			var (
+				wd      = int32(binary.NativeEndian.Uint32(buf[offset:])) // #nosec G115 -- it's a signed field
+				mask    = binary.NativeEndian.Uint32(buf[offset+4:])
+				nameLen = int(binary.NativeEndian.Uint32(buf[offset+12:]))
+				start   = offset + syscall.SizeofInotifyEvent
+			)
+			offset = start + nameLen
+
+			if mask&syscall.IN_Q_OVERFLOW != 0 {
+				// some events were lost, consider all targets as changed
+				for i := range targets {
+					if !sendEvent(ctx, events, targets[i].key) {
+						return
+					}
+				}
+				continue
+			}
+
+			relDir, ok := descriptors[wd]
+			if !ok || offset > n {
+				continue
+			}
+
+			if !sendMatched(ctx, events, targets, relDir, string(buf[start:offset])) {
+				return
+			}
+		}
+	}
+}
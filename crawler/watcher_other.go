@@ -0,0 +1,13 @@
+//go:build !linux
+
+package crawler
+
+import (
+	"context"
+	"errors"
+)
+
+// watchNotify is not supported on this platform, polling is used instead.
+func watchNotify(_ context.Context, _ string, _ []watchTarget, _ chan<- string) error {
+	return errors.New("inotify is not supported")
+}
@@ -0,0 +1,213 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+// writeFile writes the data to the file creating its directory.
+func writeFile(t *testing.T, name, data string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchDirs(t *testing.T) {
+	var (
+		tmpDir  = t.TempDir()
+		rootDir = filepath.Join(tmpDir, "root")
+		outDir  = filepath.Join(tmpDir, "out")
+	)
+
+	writeFile(t, filepath.Join(rootDir, "sub", "a.txt"), "a")
+	writeFile(t, filepath.Join(outDir, "b.txt"), "b")
+
+	if err := os.Symlink(outDir, filepath.Join(rootDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		files   []string
+		want    []string
+		wantErr error
+	}{
+		{name: "root file", files: []string{"a.txt"}, want: []string{"."}},
+		{name: "sub directory", files: []string{"sub/a.txt", "sub/b.txt", "c.txt"}, want: []string{".", "sub"}},
+		{name: "directory and pattern", files: []string{"sub", "sub/*.txt"}, want: []string{"sub"}},
+		{name: "parent directory", files: []string{"../out/b.txt"}, wantErr: ErrWatchRoot},
+		{name: "symbolic link", files: []string{"link/b.txt"}, wantErr: ErrWatchRoot},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			targets, err := watchTargets(rootDir, tc.files)
+			if err != nil {
+				t.Fatalf("unexpected targets error: %v", err)
+			}
+
+			dirs, err := watchDirs(rootDir, targets)
+
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Errorf("error = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var relDirs []string
+			for _, relDir := range dirs {
+				relDirs = append(relDirs, relDir)
+			}
+
+			if slices.Sort(relDirs); !slices.Equal(relDirs, tc.want) {
+				t.Errorf("dirs = %v, want %v", relDirs, tc.want)
+			}
+		})
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		changed string // file name to change
+		poll    bool
+	}{
+		{name: "notify file", key: "nodes/a.txt", changed: "a.txt"},
+		{name: "poll file", key: "nodes/a.txt", changed: "a.txt", poll: true},
+		{name: "notify directory", key: "nodes", changed: "new.txt"},
+		{name: "poll directory", key: "nodes", changed: "new.txt", poll: true},
+		{name: "notify pattern", key: "nodes/*.txt", changed: "new.txt"},
+		{name: "poll pattern", key: "nodes/*.txt", changed: "new.txt", poll: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rootDir := t.TempDir()
+			writeFile(t, filepath.Join(rootDir, "nodes", "a.txt"), "a")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			events := watchFiles(ctx, rootDir, []string{tc.key}, tc.poll, 10*time.Millisecond)
+			time.Sleep(50 * time.Millisecond) // wait watcher initialization
+
+			// not watched file is ignored
+			writeFile(t, filepath.Join(rootDir, "b.csv"), "b")
+			writeFile(t, filepath.Join(rootDir, "nodes", tc.changed), "a\nb")
+
+			select {
+			case key := <-events:
+				if want := filepath.Clean(tc.key); key != want {
+					t.Errorf("event = %q, want %q", key, want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Error("timeout waiting for file event")
+			}
+
+			cancel()
+			for range events {
+				// wait channel closing
+			}
+		})
+	}
+}
+
+func TestCrawler_WatchLocal(t *testing.T) {
+	var otherCalls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherCalls.Add(1)
+		if _, err := w.Write([]byte("line2")); err != nil {
+			t.Errorf("failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	rootDir := t.TempDir()
+	writeFile(t, filepath.Join(rootDir, "a.txt"), "line1")
+
+	groups := []cfg.Group{
+		{
+			Name:   "watched",
+			Period: cfg.Duration(time.Hour),
+			Subscriptions: []cfg.Subscription{
+				{Name: "a", Path: "a.txt", Local: true, Timeout: cfg.Duration(time.Second)},
+			},
+		},
+		{
+			Name:   "other",
+			Period: cfg.Duration(time.Hour),
+			Subscriptions: []cfg.Subscription{
+				{Name: "b", Path: cfg.SubPath(server.URL), Timeout: cfg.Duration(time.Second)},
+			},
+		},
+	}
+	opts := cfg.WatchOptions{Enabled: true, Debounce: cfg.Duration(20 * time.Millisecond)}
+
+	c := New(groups, userAgentDefault, retriesDefault, maxConcurrentDefault, rootDir, WithWatchOptions(opts))
+	c.Run()
+	defer c.Shutdown()
+
+	time.Sleep(100 * time.Millisecond) // wait the first fetch and watcher initialization
+	writeFile(t, filepath.Join(rootDir, "a.txt"), "line1\nline3")
+
+	expected := map[string][]byte{"watched": []byte("line1\nline3"), "other": []byte("line2")}
+	deadline := time.Now().Add(2 * time.Second)
+
+	for time.Now().Before(deadline) {
+		c.RLock()
+		err := compareResults(c.result, expected)
+		c.RUnlock()
+
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.RLock()
+	if err := compareResults(c.result, expected); err != nil {
+		t.Errorf("group was not refreshed after file change: %v", err)
+	}
+	c.RUnlock()
+
+	if n := otherCalls.Load(); n != 1 {
+		t.Errorf("not affected group was fetched %d times, want 1", n)
+	}
+}
+
+func TestCrawler_Refresh(t *testing.T) {
+	c := New([]cfg.Group{{Name: "group"}}, userAgentDefault, retriesDefault, maxConcurrentDefault, "")
+
+	if !c.Refresh("group") || !c.Refresh("group") {
+		t.Error("failed to refresh known group")
+	}
+
+	if n := len(c.refresh["group"]); n != 1 {
+		t.Errorf("pending refreshes = %d, want 1", n)
+	}
+
+	if c.Refresh("unknown") {
+		t.Error("unexpected refresh of unknown group")
+	}
+}
@@ -1,8 +1,10 @@
 package limiter
 
 import (
+	"container/list"
 	"context"
 	"log/slog"
+	"net/netip"
 	"sync"
 	"time"
 )
@@ -26,6 +28,8 @@ type TokenBucket struct {
 	refillRate     float64 // per interval
 	interval       time.Duration
 	lastRefillTime time.Time
+	element        *list.Element // position in the recently used list, nil if buckets are not limited
+	policy         string        // name of the bucket policy, it's empty for the default one
 }
 
 // NewTokenBucket creates a new TokenBucket with the specified max tokens and refill rate.
@@ -60,7 +64,31 @@ func (tb *TokenBucket) Allow() bool {
 	return true
 }
 
+// update changes the bucket parameters, current tokens are limited by the new max tokens.
+func (tb *TokenBucket) update(maxTokens, refillRate float64, interval time.Duration) {
+	tb.Lock()
+	defer tb.Unlock()
+
+	tb.tokens = min(tb.tokens, maxTokens)
+	tb.maxTokens = maxTokens
+	tb.refillRate = refillRate
+	tb.interval = interval
+}
+
+// Policy is a rate limit of named requests kind, it doesn't limit requests if its rate or burst is zero.
+type Policy struct {
+	Rate     float64
+	Burst    float64
+	Interval time.Duration
+}
+
+// limited returns true if the policy limits requests.
+func (p Policy) limited() bool {
+	return p.Rate != 0 && p.Burst != 0
+}
+
 // IPRateLimiter is a rate limiter that limits requests based on the IP address.
+// Requests of named policies have own buckets, other requests use the default rate and burst.
 type IPRateLimiter struct {
 	sync.RWMutex
 	buckets           map[string]*TokenBucket
@@ -68,53 +96,231 @@ type IPRateLimiter struct {
 	rate              float64
 	burst             float64
 	interval          time.Duration
-	excluded          map[string]struct{}
+	excluded          []netip.Prefix // networks without rate limits
+	ipv4Bits          int            // prefix length of IPv4 bucket keys
+	ipv6Bits          int            // prefix length of IPv6 bucket keys
+	maxBuckets        int            // 0 means no limit
+	policies          map[string]Policy
+	recentMu          sync.Mutex // for recent list and buckets' elements
+	recent            *list.List // keys of buckets from the most to the least recently used
+}
+
+// Option is a function which configures IPRateLimiter.
+type Option func(*IPRateLimiter)
+
+// WithKeyPrefix sets prefix lengths of IPv4 and IPv6 addresses, all addresses of one network share a bucket.
+func WithKeyPrefix(ipv4Bits, ipv6Bits int) Option {
+	return func(irl *IPRateLimiter) {
+		irl.ipv4Bits = ipv4Bits
+		irl.ipv6Bits = ipv6Bits
+	}
+}
+
+// WithMaxBuckets sets the maximum number of buckets, the least recently used ones are evicted.
+func WithMaxBuckets(n int) Option {
+	return func(irl *IPRateLimiter) {
+		irl.maxBuckets = n
+	}
+}
+
+// WithPolicies sets named rate limit policies.
+func WithPolicies(policies map[string]Policy) Option {
+	return func(irl *IPRateLimiter) {
+		irl.policies = policies
+	}
 }
 
 // NewIPRateLimiter creates a new IPRateLimiter with the specified rate and burst.
-func NewIPRateLimiter(rate, burst float64, interval time.Duration, excluded map[string]struct{}) *IPRateLimiter {
-	return &IPRateLimiter{
+// Requests from excluded networks are not limited.
+// Every IP address gets its own bucket and number of buckets is not limited by default.
+func NewIPRateLimiter(
+	rate, burst float64, interval time.Duration, excluded []netip.Prefix, opts ...Option,
+) *IPRateLimiter {
+	irl := &IPRateLimiter{
 		buckets:           make(map[string]*TokenBucket),
 		ignoreLimitBucket: &IgnoreLimitBucket{},
 		rate:              rate,
 		burst:             burst,
 		interval:          interval,
 		excluded:          excluded,
+		ipv4Bits:          32,
+		ipv6Bits:          128,
+		recent:            list.New(),
 	}
+
+	for _, opt := range opts {
+		opt(irl)
+	}
+
+	return irl
+}
+
+// bucketKey returns a key of the address bucket, it's the address network with configured prefix length.
+func (irl *IPRateLimiter) bucketKey(addr netip.Addr) string {
+	bits := irl.ipv6Bits
+	if addr.Is4() {
+		bits = irl.ipv4Bits
+	}
+
+	if bits <= 0 || bits >= addr.BitLen() {
+		return addr.String()
+	}
+
+	return netip.PrefixFrom(addr, bits).Masked().String()
 }
 
-// getOrCreateBucket returns the TokenBucket for the given IP address.
-// It uses privileged mode to check if the limiter was created before.
-func (irl *IPRateLimiter) getOrCreateBucket(ip string) *TokenBucket {
+// policy returns the named policy or the default one if it's not found. A caller should hold the lock.
+func (irl *IPRateLimiter) policy(name string) Policy {
+	if p, ok := irl.policies[name]; ok {
+		return p
+	}
+	return Policy{Rate: irl.rate, Burst: irl.burst, Interval: irl.interval}
+}
+
+// getOrCreateBucket returns the TokenBucket of the policy for the given key.
+// It uses privileged mode to check if the limiter was created before,
+// a new bucket evicts old ones if number of buckets is limited.
+func (irl *IPRateLimiter) getOrCreateBucket(name, key string) *TokenBucket {
 	irl.Lock()
-	bucket, ok := irl.buckets[ip]
+	defer irl.Unlock()
 
+	bucket, ok := irl.buckets[key]
 	if !ok {
-		bucket = NewTokenBucket(irl.burst, irl.rate, irl.interval)
-		irl.buckets[ip] = bucket
+		p := irl.policy(name)
+		bucket = NewTokenBucket(p.Burst, p.Rate, p.Interval)
+		bucket.policy = name
+		irl.buckets[key] = bucket
+
+		if irl.maxBuckets > 0 {
+			irl.recentMu.Lock()
+			bucket.element = irl.recent.PushFront(key)
+			irl.evict()
+			irl.recentMu.Unlock()
+		}
 	}
 
-	irl.Unlock()
 	return bucket
 }
 
-// GetBucket returns the TokenBucket for the given IP address.
+// evict removes the least recently used buckets above the limit, a new bucket is the most recently used one.
+// A caller should hold the lock and the recent list lock.
+func (irl *IPRateLimiter) evict() {
+	for len(irl.buckets) > irl.maxBuckets {
+		oldest := irl.recent.Back()
+		if oldest == nil {
+			return
+		}
+
+		key := irl.recent.Remove(oldest).(string)
+		irl.buckets[key].element = nil
+		delete(irl.buckets, key)
+	}
+}
+
+// touch marks the bucket as the most recently used one, an evicted bucket is skipped.
+func (irl *IPRateLimiter) touch(bucket *TokenBucket) {
+	irl.recentMu.Lock()
+	defer irl.recentMu.Unlock()
+
+	if bucket.element != nil {
+		irl.recent.MoveToFront(bucket.element)
+	}
+}
+
+// isExcluded returns true if the address belongs to one of excluded networks. A caller should hold the lock.
+func (irl *IPRateLimiter) isExcluded(addr netip.Addr) bool {
+	for _, prefix := range irl.excluded {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetBucket returns the TokenBucket of the default policy for the given IP address.
 func (irl *IPRateLimiter) GetBucket(ip string) Bucket {
-	if _, ok := irl.excluded[ip]; ok {
-		return irl.ignoreLimitBucket
+	return irl.GetPolicyBucket("", ip)
+}
+
+// GetPolicyBucket returns the TokenBucket of the named policy for the given IP address,
+// it's shared by addresses of one network. An unknown policy name means the default policy.
+// An invalid IP address is never excluded, it gets its own bucket.
+func (irl *IPRateLimiter) GetPolicyBucket(name, ip string) Bucket {
+	key := ip
+	addr, err := netip.ParseAddr(ip)
+
+	if err == nil {
+		addr = addr.WithZone("").Unmap()
+		key = irl.bucketKey(addr)
 	}
 
 	irl.RLock()
-	bucket, ok := irl.buckets[ip]
+	if _, ok := irl.policies[name]; !ok {
+		name = ""
+	}
+
+	if name != "" {
+		key = name + " " + key
+	}
+
+	limited := irl.policy(name).limited()
+	excluded := err == nil && irl.isExcluded(addr)
+	bucket, ok := irl.buckets[key]
 	irl.RUnlock()
 
+	if excluded || !limited {
+		return irl.ignoreLimitBucket
+	}
+
 	if !ok {
-		return irl.getOrCreateBucket(ip)
+		return irl.getOrCreateBucket(name, key)
+	}
+
+	if irl.maxBuckets > 0 {
+		irl.touch(bucket)
 	}
 
 	return bucket
 }
 
+// Update changes rate limiting parameters, existing buckets get them too.
+func (irl *IPRateLimiter) Update(rate, burst float64, interval time.Duration, excluded []netip.Prefix) {
+	irl.Lock()
+	defer irl.Unlock()
+
+	irl.rate = rate
+	irl.burst = burst
+	irl.interval = interval
+	irl.excluded = excluded
+
+	irl.updateBuckets()
+}
+
+// UpdatePolicies replaces named policies, existing buckets of removed policies get the default parameters.
+func (irl *IPRateLimiter) UpdatePolicies(policies map[string]Policy) {
+	irl.Lock()
+	defer irl.Unlock()
+
+	irl.policies = policies
+	irl.updateBuckets()
+}
+
+// updateBuckets sets parameters of buckets' policies. A caller should hold the lock.
+func (irl *IPRateLimiter) updateBuckets() {
+	for _, bucket := range irl.buckets {
+		p := irl.policy(bucket.policy)
+		bucket.update(p.Burst, p.Rate, p.Interval)
+	}
+}
+
+// Len returns the number of active buckets.
+func (irl *IPRateLimiter) Len() int {
+	irl.RLock()
+	defer irl.RUnlock()
+
+	return len(irl.buckets)
+}
+
 // cleanupBuckets removes buckets that have not been used for a specified duration.
 func (irl *IPRateLimiter) cleanupBuckets(cleanupInterval time.Duration) uint64 {
 	var (
@@ -122,18 +328,25 @@ func (irl *IPRateLimiter) cleanupBuckets(cleanupInterval time.Duration) uint64 {
 		now   = time.Now()
 	)
 	irl.Lock()
+	irl.recentMu.Lock()
 
-	for ip, bucket := range irl.buckets {
+	for key, bucket := range irl.buckets {
 		bucket.RLock()
 		lastUsed := bucket.lastRefillTime
 
 		if now.Sub(lastUsed) > cleanupInterval {
-			delete(irl.buckets, ip)
+			if bucket.element != nil {
+				irl.recent.Remove(bucket.element)
+				bucket.element = nil
+			}
+
+			delete(irl.buckets, key)
 			count++
 		}
 		bucket.RUnlock()
 	}
 
+	irl.recentMu.Unlock()
 	irl.Unlock()
 	return count
 }
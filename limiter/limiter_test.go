@@ -2,10 +2,22 @@ package limiter
 
 import (
 	"context"
+	"fmt"
+	"net/netip"
+	"slices"
 	"testing"
 	"time"
 )
 
+// prefixes returns parsed networks.
+func prefixes(values ...string) []netip.Prefix {
+	result := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		result = append(result, netip.MustParsePrefix(value))
+	}
+	return result
+}
+
 func TestTokenBucket_Allow(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -89,7 +101,7 @@ func TestIPRateLimiter_GetBucket(t *testing.T) {
 		interval time.Duration
 		ips      []string
 		wantSame []bool // whether the same bucket should be returned for consecutive calls with the same IP
-		excluded map[string]struct{}
+		excluded []netip.Prefix
 	}{
 		{
 			name:     "Single IP",
@@ -114,7 +126,7 @@ func TestIPRateLimiter_GetBucket(t *testing.T) {
 			interval: time.Second,
 			ips:      []string{"192.168.1.1", "192.168.1.2", "192.168.1.3"},
 			wantSame: []bool{true, false},
-			excluded: map[string]struct{}{"192.168.1.1": {}, "192.168.1.2": {}},
+			excluded: prefixes("192.168.1.1/32", "192.168.1.2/32"),
 		},
 	}
 
@@ -127,8 +139,8 @@ func TestIPRateLimiter_GetBucket(t *testing.T) {
 			for _, ip := range tt.ips {
 				bucket := irl.GetBucket(ip)
 
-				if _, ok := tt.excluded[ip]; ok {
-					if _, ok = bucket.(*IgnoreLimitBucket); !ok {
+				if slices.ContainsFunc(tt.excluded, func(p netip.Prefix) bool { return p.Contains(netip.MustParseAddr(ip)) }) {
+					if _, ok := bucket.(*IgnoreLimitBucket); !ok {
 						t.Errorf("expected IgnoreLimitBucket for excluded IP %s, got %T", ip, bucket)
 					}
 				}
@@ -150,6 +162,67 @@ func TestIPRateLimiter_GetBucket(t *testing.T) {
 	}
 }
 
+func TestIPRateLimiter_ExcludedNetworks(t *testing.T) {
+	irl := NewIPRateLimiter(1, 1, time.Hour, prefixes("10.1.2.0/24", "2001:db8:1:2::/64", "192.168.1.1/32"))
+
+	tests := []struct {
+		ip       string
+		excluded bool
+	}{
+		{ip: "10.1.2.0", excluded: true},
+		{ip: "10.1.2.255", excluded: true},
+		{ip: "10.1.3.1"},
+		{ip: "192.168.1.1", excluded: true},
+		{ip: "192.168.1.2"},
+		{ip: "::ffff:10.1.2.3", excluded: true},
+		{ip: "2001:db8:1:2:abcd::1", excluded: true},
+		{ip: "2001:db8:1:3::1"},
+		{ip: "invalid"},
+		{ip: ""},
+	}
+
+	for _, tc := range tests {
+		_, ok := irl.GetBucket(tc.ip).(*IgnoreLimitBucket)
+		if ok != tc.excluded {
+			t.Errorf("IP %q: excluded = %v, want %v", tc.ip, ok, tc.excluded)
+		}
+	}
+}
+
+func TestIPRateLimiter_Len(t *testing.T) {
+	irl := NewIPRateLimiter(1, 5, time.Second, prefixes("192.168.1.3/32"))
+
+	for _, ip := range []string{"192.168.1.1", "192.168.1.2", "192.168.1.1", "192.168.1.3"} {
+		irl.GetBucket(ip)
+	}
+
+	if n := irl.Len(); n != 2 {
+		t.Errorf("expected 2 buckets, got %d", n)
+	}
+}
+
+func TestIPRateLimiter_Update(t *testing.T) {
+	const ip = "192.168.1.1"
+	irl := NewIPRateLimiter(1, 5, time.Hour, nil)
+
+	bucket := irl.GetBucket(ip)
+	irl.Update(1, 2, time.Hour, prefixes("192.168.1.2/32"))
+
+	for i := range 3 {
+		if allowed := bucket.Allow(); allowed != (i < 2) {
+			t.Errorf("request %d: allowed = %v", i, allowed)
+		}
+	}
+
+	if newBucket := irl.GetBucket("192.168.1.3").(*TokenBucket); newBucket.maxTokens != 2 {
+		t.Errorf("expected new bucket max tokens 2, got %v", newBucket.maxTokens)
+	}
+
+	if _, ok := irl.GetBucket("192.168.1.2").(*IgnoreLimitBucket); !ok {
+		t.Error("expected IgnoreLimitBucket for new excluded IP")
+	}
+}
+
 func TestIPRateLimiter_RateLimiting(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -159,7 +232,7 @@ func TestIPRateLimiter_RateLimiting(t *testing.T) {
 		ips            []string
 		sleepIntervals []time.Duration
 		wantResults    []bool
-		excluded       map[string]struct{}
+		excluded       []netip.Prefix
 	}{
 		{
 			name:           "Single IP within limit",
@@ -205,7 +278,7 @@ func TestIPRateLimiter_RateLimiting(t *testing.T) {
 			ips:            []string{"192.168.1.1", "192.168.1.2", "192.168.1.1", "192.168.1.2"},
 			sleepIntervals: []time.Duration{0, 0, 0, 0},
 			wantResults:    []bool{true, true, true, true},
-			excluded:       map[string]struct{}{"192.168.1.1": {}, "192.168.1.2": {}},
+			excluded:       prefixes("192.168.1.1/32", "192.168.1.2/32"),
 		},
 	}
 
@@ -342,3 +415,201 @@ func TestIPRateLimiter_Cleanup(t *testing.T) {
 		t.Errorf("after cleanup goroutine: bucket count = %v, want %v", remainingCount, 1)
 	}
 }
+
+func TestIPRateLimiter_KeyPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		ip       string
+		other    string
+		shared   bool
+		expected string
+	}{
+		{name: "default IPv4", ip: "192.168.1.1", other: "192.168.1.2", expected: "192.168.1.1"},
+		{name: "default IPv6", ip: "2001:db8::1", other: "2001:db8::2", expected: "2001:db8::1"},
+		{
+			name:     "IPv6 network",
+			opts:     []Option{WithKeyPrefix(32, 64)},
+			ip:       "2001:db8:1:2:aaaa::1",
+			other:    "2001:db8:1:2:bbbb::2",
+			shared:   true,
+			expected: "2001:db8:1:2::/64",
+		},
+		{
+			name:     "other IPv6 network",
+			opts:     []Option{WithKeyPrefix(32, 64)},
+			ip:       "2001:db8:1:2::1",
+			other:    "2001:db8:1:3::1",
+			expected: "2001:db8:1:2::/64",
+		},
+		{
+			name:     "IPv4 network",
+			opts:     []Option{WithKeyPrefix(24, 64)},
+			ip:       "192.168.1.1",
+			other:    "::ffff:192.168.1.2",
+			shared:   true,
+			expected: "192.168.1.0/24",
+		},
+		{
+			name:     "zone",
+			opts:     []Option{WithKeyPrefix(32, 64)},
+			ip:       "fe80::1%eth0",
+			other:    "fe80::2%eth1",
+			shared:   true,
+			expected: "fe80::/64",
+		},
+		{name: "invalid IP", opts: []Option{WithKeyPrefix(24, 64)}, ip: "invalid", other: "invalid2", expected: "invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			irl := NewIPRateLimiter(1, 1, time.Hour, nil, tt.opts...)
+
+			if shared := irl.GetBucket(tt.ip) == irl.GetBucket(tt.other); shared != tt.shared {
+				t.Errorf("shared bucket = %v, want %v", shared, tt.shared)
+			}
+
+			if _, ok := irl.buckets[tt.expected]; !ok {
+				t.Errorf("bucket %q not found", tt.expected)
+			}
+		})
+	}
+}
+
+func TestIPRateLimiter_MaxBuckets(t *testing.T) {
+	irl := NewIPRateLimiter(1, 1, time.Hour, nil, WithMaxBuckets(2))
+
+	first := irl.GetBucket("192.168.1.1")
+	_ = irl.GetBucket("192.168.1.2")
+
+	// the first bucket becomes the most recently used one
+	if bucket := irl.GetBucket("192.168.1.1"); bucket != first {
+		t.Fatal("bucket is not reused")
+	}
+
+	_ = irl.GetBucket("192.168.1.3")
+
+	if n := irl.Len(); n != 2 {
+		t.Errorf("expected 2 buckets, got %d", n)
+	}
+
+	for key, expected := range map[string]bool{"192.168.1.1": true, "192.168.1.2": false, "192.168.1.3": true} {
+		if _, ok := irl.buckets[key]; ok != expected {
+			t.Errorf("bucket %q exists = %v, want %v", key, ok, expected)
+		}
+	}
+
+	if bucket := irl.GetBucket("192.168.1.1"); bucket != first {
+		t.Error("recently used bucket is evicted")
+	}
+
+	if count := irl.cleanupBuckets(0); count != 2 || irl.Len() != 0 {
+		t.Errorf("cleanup removed %d buckets, %d buckets left", count, irl.Len())
+	}
+
+	// the least recently used bucket is evicted, the order is changed by lookups
+	irl = NewIPRateLimiter(1, 1, time.Hour, nil, WithMaxBuckets(3))
+	for i := range 3 {
+		_ = irl.GetBucket(fmt.Sprintf("10.0.0.%d", i))
+	}
+
+	for i := range 32 {
+		_ = irl.GetBucket("10.0.0.0")
+		_ = irl.GetBucket("10.0.0.1")
+		ip := fmt.Sprintf("10.0.1.%d", i)
+		_ = irl.GetBucket(ip)
+
+		// a new bucket evicts the previous new one or the initial "10.0.0.2"
+		if n := irl.Len(); n != 3 {
+			t.Fatalf("expected 3 buckets, got %d", n)
+		}
+
+		for _, key := range []string{"10.0.0.0", "10.0.0.1", ip} {
+			if _, ok := irl.buckets[key]; !ok {
+				t.Fatalf("recently used bucket %q is evicted", key)
+			}
+		}
+
+		if irl.recent.Len() != irl.Len() {
+			t.Fatalf("recent list has %d keys, %d buckets", irl.recent.Len(), irl.Len())
+		}
+	}
+
+	// only the least recently used bucket of many ones is evicted
+	const (
+		size   = 64
+		unused = "10.0.0.40"
+	)
+	irl = NewIPRateLimiter(1, 1, time.Hour, nil, WithMaxBuckets(size))
+	for i := range size {
+		_ = irl.GetBucket(fmt.Sprintf("10.0.0.%d", i))
+	}
+
+	for i := range size {
+		if ip := fmt.Sprintf("10.0.0.%d", i); ip != unused {
+			_ = irl.GetBucket(ip)
+		}
+	}
+	_ = irl.GetBucket("10.0.1.1")
+
+	for i := range size {
+		ip := fmt.Sprintf("10.0.0.%d", i)
+		if _, ok := irl.buckets[ip]; ok == (ip == unused) {
+			t.Errorf("bucket %q exists = %v", ip, ok)
+		}
+	}
+}
+
+func TestIPRateLimiter_Policies(t *testing.T) {
+	const ip = "192.168.1.1"
+	irl := NewIPRateLimiter(1, 3, time.Hour, prefixes("10.0.0.0/8"), WithPolicies(map[string]Policy{
+		"force":     {Rate: 1, Burst: 1, Interval: time.Hour},
+		"unlimited": {},
+	}))
+
+	allowed := func(bucket Bucket, n int) int {
+		var count int
+		for range n {
+			if bucket.Allow() {
+				count++
+			}
+		}
+		return count
+	}
+
+	tests := []struct {
+		name     string
+		policy   string
+		ip       string
+		expected int
+	}{
+		{name: "force", policy: "force", ip: ip, expected: 1},
+		{name: "default", ip: ip, expected: 3},
+		{name: "unknown", policy: "unknown", ip: ip, expected: 0}, // the default bucket is already used
+		{name: "unlimited", policy: "unlimited", ip: ip, expected: 5},
+		{name: "excluded", policy: "force", ip: "10.1.1.1", expected: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if n := allowed(irl.GetPolicyBucket(tt.policy, tt.ip), 5); n != tt.expected {
+				t.Errorf("allowed %d requests, want %d", n, tt.expected)
+			}
+		})
+	}
+
+	if n := irl.Len(); n != 2 {
+		t.Errorf("expected 2 buckets, got %d", n)
+	}
+
+	irl.UpdatePolicies(map[string]Policy{"force": {Rate: 1, Burst: 3, Interval: time.Millisecond}})
+	time.Sleep(10 * time.Millisecond)
+
+	if n := allowed(irl.GetPolicyBucket("force", ip), 5); n != 3 {
+		t.Errorf("allowed %d requests after policy update, want 3", n)
+	}
+
+	if bucket := irl.GetPolicyBucket("unlimited", ip); bucket == irl.ignoreLimitBucket {
+		t.Error("removed policy is not replaced by the default one")
+	}
+}
@@ -0,0 +1,257 @@
+// Package logfile implements a log file writer with rotation by size and age.
+package logfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// backupTimeFormat is a time format of rotated files' suffixes, their names are sorted by time.
+	backupTimeFormat = "20060102T150405.000000000"
+
+	// Stdout is an output name of the standard output.
+	Stdout = "stdout"
+	// Stderr is an output name of the standard error.
+	Stderr = "stderr"
+)
+
+// ErrClosed is an error of writing to the closed file.
+var ErrClosed = errors.New("log file is closed")
+
+// Writer is a log file writer, the file is rotated when its size or age exceeds the limits.
+// A rotated file is renamed with a time suffix, and old rotated files are removed.
+type Writer struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64         // 0 is no limit
+	maxAge     time.Duration // 0 is no limit
+	maxBackups int           // 0 keeps all rotated files
+	file       *os.File      // nil if it's not reopened after rotation, the next write tries to open it again
+	size       int64
+	opened     time.Time // creation time of the file, it's the modification time of an existing one
+	closed     bool
+}
+
+// Option is a functional option of the writer.
+type Option func(*Writer)
+
+// WithMaxSize sets the maximum size of the file in bytes.
+func WithMaxSize(size int64) Option {
+	return func(w *Writer) {
+		w.maxSize = size
+	}
+}
+
+// WithMaxAge sets the maximum age of the file since it was created,
+// the age of an existing non-empty file is counted from its modification time.
+func WithMaxAge(age time.Duration) Option {
+	return func(w *Writer) {
+		w.maxAge = age
+	}
+}
+
+// WithMaxBackups sets the number of kept rotated files.
+func WithMaxBackups(n int) Option {
+	return func(w *Writer) {
+		w.maxBackups = n
+	}
+}
+
+// nopCloser is a writer which is not closed, it's used for standard outputs.
+type nopCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Open returns a writer of the output, it's the standard output for an empty or Stdout name,
+// the standard error for Stderr name, otherwise a file writer with the options.
+func Open(output string, opts ...Option) (io.WriteCloser, error) {
+	switch output {
+	case "", Stdout:
+		return nopCloser{os.Stdout}, nil
+	case Stderr:
+		return nopCloser{os.Stderr}, nil
+	}
+
+	return New(output, opts...)
+}
+
+// New opens the log file for appending and returns a new writer.
+func New(path string, opts ...Option) (*Writer, error) {
+	w := &Writer{path: path}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// open opens or creates the log file. A caller should hold the lock.
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return fmt.Errorf("create log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Join(fmt.Errorf("stat log file: %w", err), file.Close())
+	}
+
+	w.file, w.size, w.opened = file, info.Size(), time.Now()
+	if w.size > 0 {
+		w.opened = info.ModTime()
+	}
+
+	return nil
+}
+
+// Write writes the data to the log file, the file is rotated before if it's needed.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.needRotate(len(p), time.Now()) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+// needRotate returns true if the file size or age exceeds the limits. An empty file is not rotated.
+func (w *Writer) needRotate(n int, now time.Time) bool {
+	if w.size == 0 {
+		return false
+	}
+
+	return (w.maxSize > 0 && w.size+int64(n) > w.maxSize) || (w.maxAge > 0 && now.Sub(w.opened) >= w.maxAge)
+}
+
+// rotate renames the current file, opens a new one and removes old rotated files.
+// If the file isn't opened again, it stays closed until the next write.
+// Errors of renaming and old files removal are written to stderr, they don't stop logging,
+// a not renamed file is opened again to append. A caller should hold the lock.
+func (w *Writer) rotate() error {
+	err := w.file.Close()
+	w.file = nil
+
+	if err != nil {
+		return fmt.Errorf("close log file: %w", err)
+	}
+
+	backup := w.path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(w.path, backup); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "log rotation error: rename log file: %v\n", err)
+		return w.open()
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	if err := w.removeBackups(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "log rotation error: %v\n", err)
+	}
+
+	return nil
+}
+
+// Backups returns paths of rotated files from the oldest to the newest.
+func (w *Writer) Backups() ([]string, error) {
+	var (
+		dir, base = filepath.Split(w.path)
+		names     []string
+	)
+
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, fmt.Errorf("read log directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), base+".")
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+
+		if _, parseErr := time.Parse(backupTimeFormat, suffix); parseErr == nil {
+			names = append(names, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	slices.Sort(names)
+	return names, nil
+}
+
+// removeBackups removes the oldest rotated files except maxBackups latest ones.
+func (w *Writer) removeBackups() error {
+	if w.maxBackups <= 0 {
+		return nil
+	}
+
+	names, err := w.Backups()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, name := range names[:max(len(names)-w.maxBackups, 0)] {
+		if removeErr := os.Remove(name); removeErr != nil {
+			errs = append(errs, fmt.Errorf("remove rotated log file: %w", removeErr))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close closes the log file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+
+	return w.file.Close()
+}
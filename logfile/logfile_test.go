@@ -0,0 +1,285 @@
+package logfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFile returns the file content.
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+// write writes the lines to the writer.
+func write(t *testing.T, w *Writer, lines ...string) {
+	t.Helper()
+
+	for _, line := range lines {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriter_MaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "smerge.log")
+
+	w, err := New(path, WithMaxSize(10), WithMaxBackups(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, w, "line1\n", "line2\n")
+	if content := readFile(t, path); content != "line2\n" {
+		t.Errorf("unexpected current file %q", content)
+	}
+
+	write(t, w, "line3\n", "line4\n", "line5\n")
+	if content := readFile(t, path); content != "line5\n" {
+		t.Errorf("unexpected current file %q", content)
+	}
+
+	backups, err := w.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(backups); n != 2 {
+		t.Fatalf("unexpected backups %v", backups)
+	}
+
+	if content := readFile(t, backups[0]) + readFile(t, backups[1]); content != "line3\nline4\n" {
+		t.Errorf("unexpected backups content %q", content)
+	}
+
+	// too long line is written to a new file as is
+	write(t, w, "too long line\n")
+	if content := readFile(t, path); content != "too long line\n" {
+		t.Errorf("unexpected current file %q", content)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = w.Write([]byte("closed\n")); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Errorf("unexpected second close error %v", err)
+	}
+}
+
+func TestWriter_MaxAge(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		path = filepath.Join(dir, "smerge.log")
+	)
+
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// other files are not rotated files
+	if err := os.WriteFile(path+".bak", []byte("other\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(path, WithMaxAge(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if closeErr := w.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+	}()
+
+	write(t, w, "line1\n")
+	if content := readFile(t, path); content != "old\nline1\n" {
+		t.Errorf("unexpected current file %q", content)
+	}
+
+	w.opened = w.opened.Add(-time.Hour)
+	write(t, w, "line2\n")
+
+	if content := readFile(t, path); content != "line2\n" {
+		t.Errorf("unexpected current file %q", content)
+	}
+
+	backups, err := w.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backups) != 1 || !strings.HasPrefix(backups[0], path+".") {
+		t.Fatalf("unexpected backups %v", backups)
+	}
+
+	if content := readFile(t, backups[0]); content != "old\nline1\n" {
+		t.Errorf("unexpected backup content %q", content)
+	}
+}
+
+func TestWriter_MaxAgeExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "smerge.log")
+
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	modTime := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(path, WithMaxAge(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if closeErr := w.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+	}()
+
+	// the age of the existing file is counted from its modification time, not from the start
+	write(t, w, "line1\n")
+	if content := readFile(t, path); content != "line1\n" {
+		t.Errorf("unexpected current file %q", content)
+	}
+
+	if backups, _ := w.Backups(); len(backups) != 1 || readFile(t, backups[0]) != "old\n" {
+		t.Errorf("unexpected backups %v", backups)
+	}
+}
+
+func TestWriter_ReopenError(t *testing.T) {
+	var (
+		dir  = filepath.Join(t.TempDir(), "logs")
+		path = filepath.Join(dir, "smerge.log")
+	)
+
+	w, err := New(path, WithMaxSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if closeErr := w.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+	}()
+
+	write(t, w, "line1\n")
+
+	// the log directory is replaced by a file, so rotation can't open a new log file
+	if err = os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(dir, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = w.Write([]byte("line2\n")); err == nil || w.file != nil {
+		t.Fatalf("unexpected rotation result %v", err)
+	}
+
+	if _, err = w.Write([]byte("line3\n")); err == nil {
+		t.Error("expected error of closed file")
+	}
+
+	if err = os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, w, "line4\n")
+	if content := readFile(t, path); content != "line4\n" {
+		t.Errorf("unexpected current file %q", content)
+	}
+}
+
+func TestWriter_RenameError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "smerge.log")
+
+	w, err := New(path, WithMaxSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if closeErr := w.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+	}()
+
+	write(t, w, "line1\n")
+
+	// the log file is removed, so rotation can't rename it, but a new file is opened
+	if err = os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, w, "line2\n")
+	if content := readFile(t, path); content != "line2\n" {
+		t.Errorf("unexpected current file %q", content)
+	}
+
+	backups, err := w.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backups) != 0 {
+		t.Errorf("unexpected backups %v", backups)
+	}
+}
+
+func TestNew_Error(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := New(dir); err == nil {
+		t.Error("expected error for directory")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for output, expected := range map[string]*os.File{"": os.Stdout, Stdout: os.Stdout, Stderr: os.Stderr} {
+		w, err := Open(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if nc, ok := w.(nopCloser); !ok || nc.Writer != expected {
+			t.Errorf("unexpected writer %T for %q", w, output)
+		}
+
+		if err = w.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	name := filepath.Join(t.TempDir(), "test.log")
+	w, err := Open(name, WithMaxBackups(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fw, ok := w.(*Writer); !ok || fw.maxBackups != 1 {
+		t.Errorf("unexpected writer %T", w)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Error(err)
+	}
+}
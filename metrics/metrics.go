@@ -0,0 +1,400 @@
+// Package metrics implements a minimal set of Prometheus metrics
+// written in the text exposition format without external dependencies.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// labelSep is a separator of labels' values in series keys, it can't be a part of valid UTF-8 text.
+const labelSep = "\xff"
+
+// DefaultBuckets are default histogram buckets in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Default is a default registry of metrics, package-level metrics are registered in it once.
+var Default = NewRegistry()
+
+// collector is a metric that can be written in the text exposition format.
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry is a set of metrics.
+type Registry struct {
+	sync.Mutex
+	collectors []collector
+	names      map[string]struct{}
+}
+
+// NewRegistry creates a new empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+// register adds the metric to the registry, it panics if the name is already registered.
+func (r *Registry) register(name string, c collector) {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.names[name]; ok {
+		panic(fmt.Sprintf("metric %q is already registered", name))
+	}
+
+	r.names[name] = struct{}{}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes all metrics in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.Unlock()
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	for _, c := range collectors {
+		c.write(bw)
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// countWriter counts written bytes.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes data to the underlying writer and counts bytes.
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// desc is a common description of a metric.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+// writeHeader writes HELP and TYPE lines of the metric.
+func (d *desc) writeHeader(w *bufio.Writer) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+}
+
+// writeSample writes one sample line, extra is an additional label pair like `le="1"`.
+func (d *desc) writeSample(w *bufio.Writer, suffix string, values []string, extra string, value float64) {
+	_, _ = w.WriteString(d.name + suffix)
+
+	if len(values) > 0 || extra != "" {
+		pairs := make([]string, 0, len(values)+1)
+		for i, v := range values {
+			pairs = append(pairs, d.labels[i]+`="`+escapeLabel(v)+`"`)
+		}
+
+		if extra != "" {
+			pairs = append(pairs, extra)
+		}
+
+		_, _ = w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+
+	_, _ = w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+// key returns a series key of labels' values, it panics if the number of values is wrong.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %q has %d labels, but got %d values", d.name, len(d.labels), len(values)))
+	}
+
+	return strings.Join(values, labelSep)
+}
+
+// series is a value of a metric with labels.
+type series struct {
+	values []string
+	value  float64
+}
+
+// vec is a set of series with float values.
+type vec struct {
+	sync.Mutex
+	desc
+	series map[string]*series
+}
+
+// add adds the delta to the series value.
+func (v *vec) add(delta float64, values []string) {
+	key := v.key(values)
+
+	v.Lock()
+	defer v.Unlock()
+
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: slices.Clone(values)}
+		v.series[key] = s
+	}
+
+	s.value += delta
+}
+
+// set sets the series value.
+func (v *vec) set(value float64, values []string) {
+	key := v.key(values)
+
+	v.Lock()
+	defer v.Unlock()
+
+	if s, ok := v.series[key]; ok {
+		s.value = value
+		return
+	}
+
+	v.series[key] = &series{values: slices.Clone(values), value: value}
+}
+
+// write writes all series ordered by their labels.
+func (v *vec) write(w *bufio.Writer) {
+	v.Lock()
+	defer v.Unlock()
+
+	v.writeHeader(w)
+	for _, key := range sortedKeys(v.series) {
+		s := v.series[key]
+		v.writeSample(w, "", s.values, "", s.value)
+	}
+}
+
+// CounterVec is a counter with labels.
+type CounterVec struct {
+	vec
+}
+
+// NewCounterVec creates and registers a new counter in the default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// NewCounterVec creates and registers a new counter in the registry.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec{desc: desc{name: name, help: help, kind: "counter", labels: labels}, series: make(map[string]*series)}}
+	r.register(name, c)
+	return c
+}
+
+// Inc increments the counter with labels' values.
+func (c *CounterVec) Inc(values ...string) {
+	c.add(1, values)
+}
+
+// Add adds a non-negative value to the counter with labels' values.
+func (c *CounterVec) Add(value float64, values ...string) {
+	if value < 0 {
+		panic(fmt.Sprintf("counter %q can't decrease", c.name))
+	}
+
+	c.add(value, values)
+}
+
+// GaugeVec is a gauge with labels.
+type GaugeVec struct {
+	vec
+}
+
+// NewGaugeVec creates and registers a new gauge in the default registry.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labels...)
+}
+
+// NewGaugeVec creates and registers a new gauge in the registry.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec{desc: desc{name: name, help: help, kind: "gauge", labels: labels}, series: make(map[string]*series)}}
+	r.register(name, g)
+	return g
+}
+
+// Set sets the gauge value with labels' values.
+func (g *GaugeVec) Set(value float64, values ...string) {
+	g.set(value, values)
+}
+
+// Delete removes the gauge series with labels' values.
+func (g *GaugeVec) Delete(values ...string) {
+	key := g.key(values)
+
+	g.Lock()
+	delete(g.series, key)
+	g.Unlock()
+}
+
+// GaugeFunc is a gauge without labels, its value is returned by a function during writing.
+type GaugeFunc struct {
+	sync.Mutex
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc creates and registers a new gauge function in the default registry.
+// It's not written until its function is set.
+func NewGaugeFunc(name, help string) *GaugeFunc {
+	return Default.NewGaugeFunc(name, help)
+}
+
+// NewGaugeFunc creates and registers a new gauge function in the registry.
+func (r *Registry) NewGaugeFunc(name, help string) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name: name, help: help, kind: "gauge"}}
+	r.register(name, g)
+	return g
+}
+
+// Set sets the function of gauge value, nil value disables the gauge.
+func (g *GaugeFunc) Set(fn func() float64) {
+	g.Lock()
+	g.fn = fn
+	g.Unlock()
+}
+
+// write writes the gauge value if its function is set.
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.Lock()
+	fn := g.fn
+	g.Unlock()
+
+	if fn == nil {
+		return
+	}
+
+	g.writeHeader(w)
+	g.writeSample(w, "", nil, "", fn())
+}
+
+// histogramSeries is a histogram value with labels.
+type histogramSeries struct {
+	values []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec is a histogram with labels.
+type HistogramVec struct {
+	sync.Mutex
+	desc
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+// NewHistogramVec creates and registers a new histogram in the default registry.
+// Buckets are upper bounds, DefaultBuckets are used if they are empty.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// NewHistogramVec creates and registers a new histogram in the registry.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: slices.Sorted(slices.Values(buckets)),
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(name, h)
+	return h
+}
+
+// Observe adds the value to the histogram with labels' values.
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	key := h.key(values)
+
+	h.Lock()
+	defer h.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{values: slices.Clone(values), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+
+	if i, _ := slices.BinarySearch(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+
+	s.count++
+	s.sum += value
+}
+
+// write writes all series ordered by their labels.
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.series) {
+		var (
+			s          = h.series[key]
+			cumulative uint64
+		)
+
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			h.writeSample(w, "_bucket", s.values, `le="`+formatFloat(bound)+`"`, float64(cumulative))
+		}
+
+		h.writeSample(w, "_bucket", s.values, `le="+Inf"`, float64(s.count))
+		h.writeSample(w, "_sum", s.values, "", s.sum)
+		h.writeSample(w, "_count", s.values, "", float64(s.count))
+	}
+}
+
+// sortedKeys returns sorted keys of the map.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+	return keys
+}
+
+// formatFloat formats the value for the text exposition format.
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escapeLabel escapes a label value.
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// escapeHelp escapes a help text.
+func escapeHelp(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	var (
+		registry  = NewRegistry()
+		counter   = registry.NewCounterVec("test_requests_total", "Number of\nrequests.", "path", "code")
+		noLabels  = registry.NewCounterVec("test_rejections_total", "Number of rejections.")
+		gauge     = registry.NewGaugeVec("test_urls", "Number of URLs.", "group")
+		gaugeFunc = registry.NewGaugeFunc("test_used", "Used slots.")
+		_         = registry.NewGaugeFunc("test_disabled", "Disabled gauge.")
+		histogram = registry.NewHistogramVec("test_duration_seconds", "Duration.", []float64{1, 0.1}, "group")
+	)
+
+	counter.Inc("/b", "200")
+	counter.Add(2, "/a\"\\", "404")
+	counter.Inc("/b", "200")
+	noLabels.Inc()
+	gauge.Set(5, "g1")
+	gauge.Set(3, "g1")
+	gauge.Set(1, "g2")
+	gauge.Delete("g2")
+	gaugeFunc.Set(func() float64 { return 7 })
+	histogram.Observe(0.05, "g1")
+	histogram.Observe(0.5, "g1")
+	histogram.Observe(2, "g1")
+
+	expected := `# HELP test_requests_total Number of\nrequests.
+# TYPE test_requests_total counter
+test_requests_total{path="/a\"\\",code="404"} 2
+test_requests_total{path="/b",code="200"} 2
+# HELP test_rejections_total Number of rejections.
+# TYPE test_rejections_total counter
+test_rejections_total 1
+# HELP test_urls Number of URLs.
+# TYPE test_urls gauge
+test_urls{group="g1"} 3
+# HELP test_used Used slots.
+# TYPE test_used gauge
+test_used 7
+# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{group="g1",le="0.1"} 1
+test_duration_seconds_bucket{group="g1",le="1"} 2
+test_duration_seconds_bucket{group="g1",le="+Inf"} 3
+test_duration_seconds_sum{group="g1"} 2.55
+test_duration_seconds_count{group="g1"} 3
+`
+	var b strings.Builder
+	n, err := registry.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := b.String(); got != expected {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, expected)
+	}
+
+	if n != int64(b.Len()) {
+		t.Errorf("written %d bytes, want %d", n, b.Len())
+	}
+}
+
+func TestRegistry_RegisterPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic for duplicated metric")
+		}
+	}()
+
+	registry := NewRegistry()
+	registry.NewCounterVec("test_duplicated_total", "Duplicated.")
+	registry.NewGaugeVec("test_duplicated_total", "Duplicated.")
+}
+
+func TestCounterVec_Panic(t *testing.T) {
+	counter := NewRegistry().NewCounterVec("test_panic_total", "Panic.", "label")
+	testCases := []struct {
+		name string
+		fn   func()
+	}{
+		{name: "negative", fn: func() { counter.Add(-1, "value") }},
+		{name: "labels", fn: func() { counter.Inc("a", "b") }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("expected panic")
+				}
+			}()
+			tc.fn()
+		})
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	testCases := []struct {
+		value    float64
+		expected string
+	}{
+		{value: 0, expected: "0"},
+		{value: 1.5, expected: "1.5"},
+		{value: 1e21, expected: "1e+21"},
+		{value: math.Inf(1), expected: "+Inf"},
+		{value: math.Inf(-1), expected: "-Inf"},
+		{value: math.NaN(), expected: "NaN"},
+	}
+
+	for _, tc := range testCases {
+		if got := formatFloat(tc.value); got != tc.expected {
+			t.Errorf("formatFloat(%v) = %q, want %q", tc.value, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/logfile"
+)
+
+// combinedTimeFormat is a time format of Apache combined access log.
+const combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessRecord is a record of the completed request.
+type accessRecord struct {
+	Time       time.Time `json:"time"`
+	ID         string    `json:"id"`
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Group      string    `json:"group,omitempty"`
+	Duration   float64   `json:"duration"` // seconds
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// accessLogger writes records of completed requests to the access log.
+type accessLogger struct {
+	sync.Mutex
+	w     io.WriteCloser
+	json  bool
+	debug bool // requests are logged by the application log with debug level
+}
+
+// newAccessLogger opens the access log output, it returns nil if the access log is disabled.
+func newAccessLogger(options *cfg.AccessLogOptions) (*accessLogger, error) {
+	if !options.Enabled() {
+		return nil, nil
+	}
+
+	w, err := logfile.Open(
+		options.Output,
+		logfile.WithMaxSize(int64(options.MaxSize)<<20),
+		logfile.WithMaxAge(options.MaxAge.Timed()),
+		logfile.WithMaxBackups(int(options.MaxBackups)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("open access log: %w", err)
+	}
+
+	return &accessLogger{w: w, json: options.Format == cfg.AccessLogJSON, debug: options.DebugRequests}, nil
+}
+
+// requestLevel returns a log level of the application log lines of requests.
+func (al *accessLogger) requestLevel() slog.Level {
+	if al != nil && al.debug {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// newAccessRecord returns a record of the completed request, the path should be redacted.
+func newAccessRecord(
+	r *http.Request, path, reqID string, ri *info, rw *responseWriter, start time.Time, duration time.Duration,
+) *accessRecord {
+	record := &accessRecord{
+		Time:       start,
+		ID:         reqID,
+		RemoteAddr: remoteAddress(r),
+		Method:     r.Method,
+		Path:       path,
+		Proto:      r.Proto,
+		Status:     rw.Status(),
+		Bytes:      rw.BytesWritten(),
+		Group:      ri.group,
+		Duration:   duration.Seconds(),
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+	}
+
+	if r.URL.RawQuery != "" {
+		record.Query = redactQuery(r.URL)
+	}
+
+	return record
+}
+
+// Log writes the record, write errors are logged by the application log.
+func (al *accessLogger) Log(record *accessRecord) {
+	if al == nil {
+		return
+	}
+
+	var line []byte
+	if al.json {
+		data, err := json.Marshal(record)
+		if err != nil {
+			slog.Error("access log marshal error", "id", record.ID, "error", err)
+			return
+		}
+		line = append(data, '\n')
+	} else {
+		line = appendCombined(make([]byte, 0, 256), record)
+	}
+
+	al.Lock()
+	defer al.Unlock()
+
+	if _, err := al.w.Write(line); err != nil {
+		slog.Error("access log write error", "id", record.ID, "error", err)
+	}
+}
+
+// Close closes the access log output.
+func (al *accessLogger) Close() error {
+	if al == nil {
+		return nil
+	}
+
+	al.Lock()
+	defer al.Unlock()
+
+	return al.w.Close()
+}
+
+// appendCombined appends the record in Apache combined format and extra quoted group and duration in seconds:
+// host ident user [time] "request" status bytes "referer" "user-agent" "group" duration.
+func appendCombined(buf []byte, record *accessRecord) []byte {
+	uri := record.Path
+	if record.Query != "" {
+		uri += "?" + record.Query
+	}
+
+	buf = append(buf, record.RemoteAddr...)
+	buf = append(buf, " - - ["...)
+	buf = record.Time.AppendFormat(buf, combinedTimeFormat)
+	buf = append(buf, "] "...)
+	buf = appendQuoted(buf, record.Method+" "+uri+" "+record.Proto)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(record.Status), 10)
+	buf = append(buf, ' ')
+
+	if record.Bytes > 0 {
+		buf = strconv.AppendInt(buf, record.Bytes, 10)
+	} else {
+		buf = append(buf, '-')
+	}
+
+	for _, value := range []string{record.Referer, record.UserAgent, record.Group} {
+		buf = append(buf, ' ')
+		buf = appendQuoted(buf, value)
+	}
+
+	buf = append(buf, ' ')
+	buf = strconv.AppendFloat(buf, record.Duration, 'f', 6, 64)
+
+	return append(buf, '\n')
+}
+
+// appendQuoted appends the double-quoted value, an empty one is "-".
+// Quotes, backslashes and control characters are escaped, so a value can't break the line format.
+func appendQuoted(buf []byte, value string) []byte {
+	if value == "" {
+		return append(buf, `"-"`...)
+	}
+
+	buf = append(buf, '"')
+	for _, c := range []byte(value) {
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c < 0x20 || c == 0x7f:
+			buf = fmt.Appendf(buf, `\x%02x`, c)
+		default:
+			buf = append(buf, c)
+		}
+	}
+
+	return append(buf, '"')
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+func TestAppendCombined(t *testing.T) {
+	record := &accessRecord{
+		Time:       time.Date(2025, 1, 2, 15, 4, 5, 0, time.FixedZone("", 3*3600)),
+		RemoteAddr: "192.168.1.1",
+		Method:     http.MethodGet,
+		Path:       "/group",
+		Query:      "token=%2A%2A%2A",
+		Proto:      "HTTP/1.1",
+		Status:     http.StatusOK,
+		Bytes:      1234,
+		Group:      "group1",
+		Duration:   0.0125,
+		UserAgent:  `client "1.0"` + "\n",
+	}
+
+	expected := `192.168.1.1 - - [02/Jan/2025:15:04:05 +0300] "GET /group?token=%2A%2A%2A HTTP/1.1" 200 1234 ` +
+		`"-" "client \"1.0\"\x0a" "group1" 0.012500` + "\n"
+
+	if line := string(appendCombined(nil, record)); line != expected {
+		t.Errorf("got %q, want %q", line, expected)
+	}
+
+	record.Bytes, record.Group, record.UserAgent, record.Query = 0, "", "", ""
+	expected = `192.168.1.1 - - [02/Jan/2025:15:04:05 +0300] "GET /group HTTP/1.1" 200 - "-" "-" "-" 0.012500` + "\n"
+
+	if line := string(appendCombined(nil, record)); line != expected {
+		t.Errorf("got %q, want %q", line, expected)
+	}
+}
+
+func TestAccessLogger(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			setRequestGroup(r.Context(), "group1")
+			if _, err := w.Write([]byte("data")); err != nil {
+				t.Error(err)
+			}
+		})
+	)
+
+	if al, err := newAccessLogger(&cfg.AccessLogOptions{}); err != nil || al != nil {
+		t.Errorf("unexpected disabled access log %v: %v", al, err)
+	}
+
+	tests := []struct {
+		name    string
+		options cfg.AccessLogOptions
+		check   func(t *testing.T, line string)
+	}{
+		{
+			name:    "combined",
+			options: cfg.AccessLogOptions{Output: filepath.Join(dir, "combined.log"), Format: cfg.AccessLogCombined},
+			check: func(t *testing.T, line string) {
+				expected := `"GET /test?token=%2A%2A%2A HTTP/1.1" 200 4 "https://example.com" "test-agent" "group1" `
+				if !strings.HasPrefix(line, "192.0.2.1 - - [") || !strings.Contains(line, expected) {
+					t.Errorf("unexpected combined line %q", line)
+				}
+			},
+		},
+		{
+			name:    "json",
+			options: cfg.AccessLogOptions{Output: filepath.Join(dir, "access.json"), Format: cfg.AccessLogJSON},
+			check: func(t *testing.T, line string) {
+				var record accessRecord
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatal(err)
+				}
+
+				if record.ID == "" || record.Status != http.StatusOK || record.Bytes != 4 || record.Group != "group1" ||
+					record.Query != "token=%2A%2A%2A" || record.UserAgent != "test-agent" || record.Duration <= 0 {
+					t.Errorf("unexpected record %+v", record)
+				}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			al, err := newAccessLogger(&tc.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test?token=secret12345", nil)
+			req.Header.Set("User-Agent", "test-agent")
+			req.Header.Set("Referer", "https://example.com")
+
+			LoggingMiddleware(next, al, nil).ServeHTTP(httptest.NewRecorder(), req)
+
+			if err = al.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(tc.options.Output)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			if len(lines) != 1 {
+				t.Fatalf("got %d lines: %q", len(lines), data)
+			}
+
+			tc.check(t, lines[0])
+		})
+	}
+}
+
+func TestLoggingMiddleware_RedactPath(t *testing.T) {
+	const secret = "secret12345"
+
+	var (
+		logBuf bytes.Buffer
+		dir    = t.TempDir()
+		groups = map[string]*cfg.Group{"group1": {Name: "group1", Endpoint: "group1"}}
+		redact = func(path string) string { return redactPath(path, groups) }
+		next   = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	)
+
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logBuf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(defaultLogger)
+
+	for _, format := range []string{cfg.AccessLogCombined, cfg.AccessLogJSON} {
+		for _, path := range []string{"/group1/" + secret, "/u/" + secret + "/group1"} {
+			t.Run(format+path, func(t *testing.T) {
+				logBuf.Reset()
+				options := cfg.AccessLogOptions{Output: filepath.Join(dir, format+".log"), Format: format}
+
+				al, err := newAccessLogger(&options)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				LoggingMiddleware(next, al, redact).ServeHTTP(httptest.NewRecorder(), req)
+
+				if err = al.Close(); err != nil {
+					t.Fatal(err)
+				}
+
+				data, err := os.ReadFile(options.Output)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if logs := logBuf.String(); strings.Contains(logs, secret) || !strings.Contains(logs, "***") {
+					t.Errorf("token is not redacted in logs %q", logs)
+				}
+
+				if strings.Contains(string(data), secret) || !strings.Contains(string(data), "***") {
+					t.Errorf("token is not redacted in access log %q", data)
+				}
+			})
+		}
+	}
+}
+
+func TestAccessLogger_RequestLevel(t *testing.T) {
+	var al *accessLogger
+	if level := al.requestLevel(); level != slog.LevelInfo {
+		t.Errorf("got level %v for disabled access log", level)
+	}
+
+	al = &accessLogger{debug: true}
+	if level := al.requestLevel(); level != slog.LevelDebug {
+		t.Errorf("got level %v for debug requests", level)
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/crawler"
+)
+
+// StatusGetter is an interface for getting crawler states.
+type StatusGetter interface {
+	Status() []crawler.GroupStatus
+	GroupStatus(groupName string) (crawler.GroupStatus, bool)
+	BreakerStatus() []crawler.BreakerStatus
+}
+
+// groupURL is a path of the group endpoint with its access token.
+type groupURL struct {
+	Path string `json:"path"`
+}
+
+// handleAdmin handles read-only admin API requests with the path prefix,
+// other requests are passed to the next handler. Requests without a valid token are not found.
+// Routes:
+//   - {prefix}/status - states of all groups and their subscriptions
+//   - {prefix}/status/{group} - state of the group by its name
+//   - {prefix}/breakers - states of upstream hosts' circuit breakers
+//   - {prefix}/users - users' usage statistics
+//   - {prefix}/url/{group} - path of the group endpoint with its first access token
+//   - {prefix}/dashboard - HTML page of groups' states
+//
+// The tokens function returns access tokens by groups' names of the current configuration.
+func handleAdmin(
+	next http.Handler, options *cfg.AdminOptions, sg StatusGetter, users *userRegistry, tokens func() map[string][]string,
+) http.Handler {
+	var (
+		prefix    = options.Prefix
+		token     = options.Token
+		dashboard = dashboardData{Prefix: options.Prefix, PublicURL: options.PublicURL}
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, found := strings.CutPrefix(r.URL.Path, prefix+"/")
+		if !found {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if token != "" && !validToken(requestToken(r, ""), []string{token}) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		route, param, _ := strings.Cut(strings.Trim(path, "/"), "/")
+		switch {
+		case route == "status" && param == "":
+			writeJSON(w, r, sg.Status())
+		case route == "status":
+			if status, ok := sg.GroupStatus(param); ok {
+				writeJSON(w, r, &status)
+				return
+			}
+			http.Error(w, "Not Found", http.StatusNotFound)
+		case route == "breakers" && param == "":
+			writeJSON(w, r, sg.BreakerStatus())
+		case route == "users" && param == "":
+			writeJSON(w, r, users.Stats())
+		case route == "url" && param != "":
+			status, ok := sg.GroupStatus(param)
+			if !ok {
+				http.Error(w, "Not Found", http.StatusNotFound)
+				return
+			}
+
+			u := groupURL{Path: status.Endpoint}
+			if groupTokens := tokens()[param]; len(groupTokens) > 0 {
+				// tokens are validated to be used as a path segment
+				u.Path += "/" + groupTokens[0]
+			}
+			writeJSON(w, r, &u)
+		case route == "dashboard" && param == "":
+			writeDashboard(w, r, dashboard)
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		}
+	})
+}
+
+// handleRefresh handles requests "{prefix}/refresh/{group}" of the admin API to start the group fetch
+// out of its schedule, other requests are passed to the next handler. Only POST method is allowed,
+// so a cross-site link or image can't start it. Requests without a valid admin token are not found.
+func handleRefresh(next http.Handler, rl *reloader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin := &rl.current().Admin
+		groupName, found := strings.CutPrefix(r.URL.Path, admin.Prefix+"/refresh/")
+
+		if !found || !admin.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if admin.Token != "" && !validToken(requestToken(r, ""), []string{admin.Token}) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if groupName = strings.Trim(groupName, "/"); groupName == "" || !rl.cr.Refresh(groupName) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// writeJSON writes the value to the response as JSON.
+func writeJSON(w http.ResponseWriter, r *http.Request, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "json marshal error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(data); err != nil {
+		ctx := r.Context()
+		reqID, _ := GetRequestID(ctx)
+		slog.ErrorContext(ctx, "response write error", "id", reqID, "error", err)
+	}
+}
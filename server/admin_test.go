@@ -0,0 +1,274 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/crawler"
+)
+
+type mockStatusGetter struct {
+	groups []crawler.GroupStatus
+}
+
+func (m *mockStatusGetter) Status() []crawler.GroupStatus {
+	return m.groups
+}
+
+func (m *mockStatusGetter) GroupStatus(groupName string) (crawler.GroupStatus, bool) {
+	for _, group := range m.groups {
+		if group.Name == groupName {
+			return group, true
+		}
+	}
+	return crawler.GroupStatus{}, false
+}
+
+func (m *mockStatusGetter) BreakerStatus() []crawler.BreakerStatus {
+	return []crawler.BreakerStatus{{Host: "example.com", State: crawler.BreakerOpen}}
+}
+
+func TestHandleAdmin(t *testing.T) {
+	const token = "admin12345"
+	var (
+		start = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		sg    = &mockStatusGetter{groups: []crawler.GroupStatus{
+			{
+				Name:      "group1",
+				Endpoint:  "/g1",
+				LastStart: start,
+				LastEnd:   start.Add(time.Second),
+				Duration:  cfg.Duration(time.Second),
+				URLs:      2,
+				Bytes:     10,
+				Subscriptions: []crawler.SubscriptionStatus{
+					{Name: "sub1", StatusCode: http.StatusOK, Lines: 3, Filtered: 2, Latency: cfg.Duration(time.Millisecond)},
+				},
+			},
+		}}
+		users = newUserRegistry([]cfg.User{{Name: "alice", Token: "alice12345"}}, "", "")
+		next  = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	)
+	users.Visit("alice", "127.0.0.1", start)
+
+	tests := []struct {
+		name         string
+		token        string
+		path         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "status",
+			token:        token,
+			path:         "/admin/status",
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"name":"group1","endpoint":"/g1","last_start":"2025-01-02T03:04:05Z","last_end":"2025-01-02T03:04:06Z",` +
+				`"duration":"1s","urls":2,"bytes":10,"subscriptions":[{"name":"sub1","status_code":200,` +
+				`"bytes":0,"lines":3,"filtered":2,"latency":"1ms"}]}]`,
+		},
+		{
+			name:         "group status",
+			token:        token,
+			path:         "/admin/status/group1/",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"name":"group1","endpoint":"/g1","last_start":"2025-01-02T03:04:05Z","last_end":"2025-01-02T03:04:06Z",` +
+				`"duration":"1s","urls":2,"bytes":10,"subscriptions":[{"name":"sub1","status_code":200,` +
+				`"bytes":0,"lines":3,"filtered":2,"latency":"1ms"}]}`,
+		},
+		{
+			name:         "unknown group status",
+			token:        token,
+			path:         "/admin/status/group2",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Not Found\n",
+		},
+		{
+			name:         "breakers",
+			token:        token,
+			path:         "/admin/breakers",
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"host":"example.com","state":"open","failures":0}]`,
+		},
+		{
+			name:         "users",
+			token:        token,
+			path:         "/admin/users",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"alice":{"requests":1,"last_seen":"2025-01-02T03:04:05Z","last_ip":"127.0.0.1"}}`,
+		},
+		{
+			name:         "group url",
+			token:        token,
+			path:         "/admin/url/group1",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"path":"/g1/group12345"}`,
+		},
+		{
+			name:         "unknown group url",
+			token:        token,
+			path:         "/admin/url/group2",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Not Found\n",
+		},
+		{
+			name:         "unknown route",
+			token:        token,
+			path:         "/admin/unknown",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Not Found\n",
+		},
+		{
+			name:         "invalid token",
+			token:        "admin1234",
+			path:         "/admin/status",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Not Found\n",
+		},
+		{
+			name:         "no token",
+			path:         "/admin/status",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Not Found\n",
+		},
+		{
+			name:         "other path",
+			path:         "/administrator",
+			expectedCode: http.StatusTeapot,
+		},
+	}
+
+	tokens := func() map[string][]string {
+		return map[string][]string{"group1": {"group12345", "group67890"}}
+	}
+	handler := handleAdmin(next, &cfg.AdminOptions{Prefix: "/admin", Token: token}, sg, users, tokens)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.expectedCode {
+				t.Errorf("got status code %d, want %d", rec.Code, tc.expectedCode)
+			}
+
+			if body := rec.Body.String(); body != tc.expectedBody {
+				t.Errorf("got body %s, want %s", body, tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestHandleAdmin_NoToken(t *testing.T) {
+	handler := handleAdmin(
+		http.NotFoundHandler(), &cfg.AdminOptions{Prefix: "/admin"}, &mockStatusGetter{}, newUserRegistry(nil, "", ""), nil,
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/status", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status code %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if body := rec.Body.String(); body != "null" {
+		t.Errorf("got body %s, want null", body)
+	}
+}
+
+func TestHandleAdmin_Dashboard(t *testing.T) {
+	options := &cfg.AdminOptions{Prefix: "/api", Token: "admin12345", PublicURL: "https://example.com/smerge"}
+	handler := handleAdmin(http.NotFoundHandler(), options, &mockStatusGetter{}, newUserRegistry(nil, "", ""), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/dashboard?token=admin12345", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status code %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if contentType := rec.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("got content type %q", contentType)
+	}
+
+	body := rec.Body.String()
+	for _, expected := range []string{`const prefix = "/api";`, `const publicURL = "https://example.com/smerge" ||`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("body does not contain %q", expected)
+		}
+	}
+
+	if strings.Contains(body, "admin12345") {
+		t.Error("body contains the token")
+	}
+}
+
+func TestHandleRefresh(t *testing.T) {
+	const token = "admin12345"
+	var (
+		root       = t.TempDir()
+		configFile = filepath.Join(root, "config.json")
+	)
+
+	if err := os.WriteFile(configFile, fmt.Appendf(nil, manageConfigJSON, root), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := cfg.New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cr := crawler.New(config.ActiveGroups(), config.UserAgent, config.Retries, 2, config.Root)
+	cr.Run()
+	defer cr.Shutdown()
+
+	var (
+		rl      = &reloader{config: config, cr: cr}
+		next    = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusTeapot) })
+		handler = handleRefresh(next, rl)
+	)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		token        string
+		expectedCode int
+	}{
+		{name: "refresh", method: http.MethodPost, path: "/admin/refresh/group1", token: token, expectedCode: http.StatusAccepted},
+		{name: "get method", method: http.MethodGet, path: "/admin/refresh/group1", token: token, expectedCode: http.StatusMethodNotAllowed},
+		{name: "unknown group", method: http.MethodPost, path: "/admin/refresh/group2", token: token, expectedCode: http.StatusNotFound},
+		{name: "no group", method: http.MethodPost, path: "/admin/refresh/", token: token, expectedCode: http.StatusNotFound},
+		{name: "no token", method: http.MethodPost, path: "/admin/refresh/group1", expectedCode: http.StatusNotFound},
+		{name: "no token get", method: http.MethodGet, path: "/admin/refresh/group1", expectedCode: http.StatusNotFound},
+		{name: "other path", method: http.MethodGet, path: "/admin/status", token: token, expectedCode: http.StatusTeapot},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.expectedCode {
+				t.Errorf("got status code %d, want %d", rec.Code, tc.expectedCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"log/slog"
+	"net/http"
+)
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+// dashboardTemplate is a template of the admin dashboard page.
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// dashboardData is data of the admin dashboard page.
+type dashboardData struct {
+	Prefix    string // path prefix of the admin API
+	PublicURL string // base URL of group endpoints, the page origin is used if it's empty
+}
+
+// writeDashboard writes the admin dashboard page.
+// The page requests the admin API itself with the token from its URL query.
+func writeDashboard(w http.ResponseWriter, r *http.Request, data dashboardData) {
+	var buf bytes.Buffer
+
+	if err := dashboardTemplate.Execute(&buf, data); err != nil {
+		slog.ErrorContext(r.Context(), "dashboard template error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Cache-Control", "no-store")
+	header.Set("Referrer-Policy", "no-referrer")
+	header.Set(
+		"Content-Security-Policy",
+		"default-src 'none'; connect-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'",
+	)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		ctx := r.Context()
+		reqID, _ := GetRequestID(ctx)
+		slog.ErrorContext(ctx, "response write error", "id", reqID, "error", err)
+	}
+}
@@ -2,12 +2,15 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
 
 	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/convert"
 	"github.com/z0rr0/smerge/crawler"
 )
 
@@ -15,13 +18,13 @@ type mockCrawler struct {
 	data string
 }
 
-func (m *mockCrawler) Get(_ string, _ bool, _ bool) ([]byte, error) {
+func (m *mockCrawler) Get(_ context.Context, _ string, _ bool, _ bool) ([]byte, error) {
 	return []byte(m.data), nil
 }
 
 type mockCrawlerError struct{}
 
-func (m *mockCrawlerError) Get(_ string, _ bool, _ bool) ([]byte, error) {
+func (m *mockCrawlerError) Get(_ context.Context, _ string, _ bool, _ bool) ([]byte, error) {
 	return nil, crawler.ErrGroupDecode
 }
 
@@ -57,9 +60,11 @@ func TestHandleGroup(t *testing.T) {
 	crWithErr := &mockCrawlerError{}
 
 	groups := map[string]*cfg.Group{
-		"test":  {Name: "test"},
-		"other": {Name: "other"},
+		"test":   {Name: "test"},
+		"other":  {Name: "other"},
+		"secret": {Name: "secret"},
 	}
+	tokens := map[string][]string{"secret": {"token12345", "other12345"}}
 
 	tests := []struct {
 		name         string
@@ -69,6 +74,8 @@ func TestHandleGroup(t *testing.T) {
 		path         string
 		force        string
 		decode       string
+		token        string
+		auth         string
 		expectedCode int
 		expectedBody string
 	}{
@@ -97,6 +104,66 @@ func TestHandleGroup(t *testing.T) {
 			expectedCode: http.StatusNotFound,
 			expectedBody: "Not Found\n",
 		},
+		{
+			name:         "token in path",
+			getter:       cr,
+			method:       "GET",
+			path:         "/secret/other12345",
+			expectedCode: http.StatusOK,
+			expectedBody: mockData,
+		},
+		{
+			name:         "token in query",
+			getter:       cr,
+			method:       "GET",
+			path:         "/secret",
+			token:        "token12345",
+			expectedCode: http.StatusOK,
+			expectedBody: mockData,
+		},
+		{
+			name:         "token in header",
+			getter:       cr,
+			method:       "GET",
+			path:         "/secret/",
+			auth:         "Bearer token12345",
+			expectedCode: http.StatusOK,
+			expectedBody: mockData,
+		},
+		{
+			name:         "no token",
+			getter:       cr,
+			method:       "GET",
+			path:         "/secret",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Not Found\n",
+		},
+		{
+			name:         "invalid token",
+			getter:       cr,
+			method:       "GET",
+			path:         "/secret/token1234",
+			auth:         "Bearer token12345",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Not Found\n",
+		},
+		{
+			name:         "invalid header",
+			getter:       cr,
+			method:       "GET",
+			path:         "/secret",
+			auth:         "Basic token12345",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Not Found\n",
+		},
+		{
+			name:         "token for not protected group",
+			getter:       cr,
+			method:       "GET",
+			path:         "/test/token12345",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Not Found\n",
+		},
 		{
 			name:         "error from crawler",
 			getter:       crWithErr,
@@ -135,10 +202,16 @@ func TestHandleGroup(t *testing.T) {
 			if tc.decode != "" {
 				q.Set("decode", tc.decode)
 			}
+			if tc.token != "" {
+				q.Set("token", tc.token)
+			}
 
 			u.RawQuery = q.Encode()
 			req := httptest.NewRequest(tc.method, u.String(), nil)
-			handler := handleGroup(groups, tc.getter)
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			handler := handleGroup(groups, tokens, nil, tc.getter)
 
 			if recorder == nil {
 				recorder = httptest.NewRecorder()
@@ -176,3 +249,135 @@ func TestHandleGroup(t *testing.T) {
 		})
 	}
 }
+
+// mockDecodeCrawler returns plain data if it's decoded, otherwise the stored one.
+type mockDecodeCrawler struct{}
+
+func (m *mockDecodeCrawler) Get(_ context.Context, _ string, _ bool, decode bool) ([]byte, error) {
+	if decode {
+		return []byte("ss://a\nss://b"), nil
+	}
+	return []byte("stored"), nil
+}
+
+func TestServeGroup_Format(t *testing.T) {
+	var (
+		group = &cfg.Group{Name: "test", Endpoint: "/test"}
+		rules = cfg.FormatRules{
+			{UserAgent: "(?i)v2rayn", Format: cfg.FormatBase64},
+			{UserAgent: "^curl/", Format: cfg.FormatPlain},
+			{UserAgent: "(?i)clash|mihomo", Format: cfg.FormatClash},
+		}
+		encoded = base64.StdEncoding.EncodeToString([]byte("ss://a\nss://b"))
+	)
+
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		rules        cfg.FormatRules
+		query        string
+		userAgent    string
+		expectedCode int
+		expectedBody string
+		expectedType string // text/plain by default
+		expectedVary string
+	}{
+		{name: "no rules", userAgent: "v2rayN/6.0", expectedCode: http.StatusOK, expectedBody: "stored"},
+		{name: "no rules decode", query: "decode=1", expectedCode: http.StatusOK, expectedBody: "ss://a\nss://b"},
+		{
+			name:         "base64 rule",
+			rules:        rules,
+			userAgent:    "V2RayN/6.0",
+			expectedCode: http.StatusOK,
+			expectedBody: encoded,
+			expectedVary: "User-Agent",
+		},
+		{
+			name:         "plain rule",
+			rules:        rules,
+			userAgent:    "curl/8.0",
+			expectedCode: http.StatusOK,
+			expectedBody: "ss://a\nss://b",
+			expectedVary: "User-Agent",
+		},
+		{
+			name:         "not matched",
+			rules:        rules,
+			userAgent:    "Mozilla/5.0",
+			expectedCode: http.StatusOK,
+			expectedBody: "stored",
+			expectedVary: "User-Agent",
+		},
+		{
+			name:         "explicit decode",
+			rules:        rules,
+			query:        "decode=false",
+			userAgent:    "v2rayN/6.0",
+			expectedCode: http.StatusOK,
+			expectedBody: "stored",
+			expectedVary: "User-Agent",
+		},
+		{
+			name:         "explicit format",
+			rules:        rules,
+			query:        "format=plain",
+			userAgent:    "v2rayN/6.0",
+			expectedCode: http.StatusOK,
+			expectedBody: "ss://a\nss://b",
+			expectedVary: "User-Agent",
+		},
+		{
+			name:         "clash rule",
+			rules:        rules,
+			userAgent:    "ClashMeta/1.18",
+			expectedCode: http.StatusOK,
+			expectedBody: string(convert.Clash(nil)), // mock URIs are not supported
+			expectedType: "text/yaml; charset=utf-8",
+			expectedVary: "User-Agent",
+		},
+		{
+			name:         "sing-box format",
+			query:        "format=singbox",
+			expectedCode: http.StatusOK,
+			expectedBody: string(convert.SingBox(nil)),
+			expectedType: "application/json",
+		},
+		{name: "base64 format", query: "format=base64", expectedCode: http.StatusOK, expectedBody: encoded},
+		{name: "unknown format", query: "format=yaml", expectedCode: http.StatusBadRequest, expectedBody: "Bad Request\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test?"+tc.query, nil)
+			req.Header.Set("User-Agent", tc.userAgent)
+			rec := httptest.NewRecorder()
+
+			serveGroup(rec, req, group, tc.rules, &mockDecodeCrawler{})
+
+			if rec.Code != tc.expectedCode {
+				t.Errorf("got status code %d, want %d", rec.Code, tc.expectedCode)
+			}
+
+			if body := rec.Body.String(); body != tc.expectedBody {
+				t.Errorf("got body %q, want %q", body, tc.expectedBody)
+			}
+
+			if tc.expectedType == "" && tc.expectedCode == http.StatusOK {
+				tc.expectedType = "text/plain"
+			}
+
+			if contentType := rec.Header().Get("Content-Type"); tc.expectedType != "" && contentType != tc.expectedType {
+				t.Errorf("got Content-Type %q, want %q", contentType, tc.expectedType)
+			}
+
+			if vary := rec.Header().Get("Vary"); vary != tc.expectedVary {
+				t.Errorf("got Vary %q, want %q", vary, tc.expectedVary)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/z0rr0/smerge/crawler"
+)
+
+const (
+	// readyPath is a path of the readiness check.
+	readyPath = "/ready"
+	// groupsHealthPath is a path of groups' freshness states.
+	groupsHealthPath = "/health/groups"
+)
+
+// HealthChecker is an interface for getting groups' readiness and freshness.
+type HealthChecker interface {
+	Ready() bool
+	Health(staleFactor float64, now time.Time) crawler.Health
+}
+
+// handleHealth handles readiness and groups' freshness requests, other requests are passed to the next handler.
+// The readiness check responds 503 until all groups have results,
+// groups' freshness states respond 503 if any group is stale.
+func handleHealth(next http.Handler, hc HealthChecker, staleFactor float64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimRight(r.URL.Path, "/") {
+		case readyPath:
+			if !hc.Ready() {
+				http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/plain")
+			if _, err := w.Write([]byte("READY")); err != nil {
+				ctx := r.Context()
+				reqID, _ := GetRequestID(ctx)
+				slog.ErrorContext(ctx, "response write error", "id", reqID, "error", err)
+			}
+		case groupsHealthPath:
+			health := hc.Health(staleFactor, time.Now())
+			if !health.Healthy {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			writeJSON(w, r, &health)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/crawler"
+)
+
+type mockHealthChecker struct {
+	ready bool
+	stale bool
+}
+
+func (m *mockHealthChecker) Ready() bool {
+	return m.ready
+}
+
+func (m *mockHealthChecker) Health(staleFactor float64, _ time.Time) crawler.Health {
+	group := crawler.GroupHealth{
+		Name:   "group1",
+		Ready:  m.ready,
+		Age:    cfg.Duration(time.Duration(staleFactor) * time.Second),
+		Period: cfg.Duration(time.Second),
+		Stale:  m.stale,
+	}
+	return crawler.Health{Healthy: !m.stale, Ready: m.ready, Groups: []crawler.GroupHealth{group}}
+}
+
+func TestHandleHealth(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusTeapot) })
+
+	tests := []struct {
+		name         string
+		checker      *mockHealthChecker
+		path         string
+		expectedCode int
+		expectedBody string
+		expectedType string
+	}{
+		{
+			name:         "not ready",
+			checker:      &mockHealthChecker{},
+			path:         "/ready",
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: "Service Unavailable\n",
+			expectedType: "text/plain; charset=utf-8",
+		},
+		{
+			name:         "ready",
+			checker:      &mockHealthChecker{ready: true},
+			path:         "/ready/",
+			expectedCode: http.StatusOK,
+			expectedBody: "READY",
+			expectedType: "text/plain",
+		},
+		{
+			name:         "healthy",
+			checker:      &mockHealthChecker{ready: true},
+			path:         "/health/groups",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"healthy":true,"ready":true,"groups":[{"name":"group1","ready":true,"age":"2s",` +
+				`"period":"1s","stale":false}]}`,
+			expectedType: "application/json",
+		},
+		{
+			name:         "stale",
+			checker:      &mockHealthChecker{ready: true, stale: true},
+			path:         "/health/groups",
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: `{"healthy":false,"ready":true,"groups":[{"name":"group1","ready":true,"age":"2s",` +
+				`"period":"1s","stale":true}]}`,
+			expectedType: "application/json",
+		},
+		{name: "other path", checker: &mockHealthChecker{}, path: "/health", expectedCode: http.StatusTeapot},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := handleHealth(next, tc.checker, 2)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.expectedCode {
+				t.Errorf("got status code %d, want %d", rec.Code, tc.expectedCode)
+			}
+
+			if body := rec.Body.String(); body != tc.expectedBody {
+				t.Errorf("got body %s, want %s", body, tc.expectedBody)
+			}
+
+			if contentType := rec.Header().Get("Content-Type"); contentType != tc.expectedType {
+				t.Errorf("got content type %q, want %q", contentType, tc.expectedType)
+			}
+		})
+	}
+}
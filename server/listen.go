@@ -0,0 +1,205 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+const (
+	// systemdFirstFD is the first file descriptor of sockets passed by systemd.
+	systemdFirstFD = 3
+	// systemdDefaultName is a name of passed sockets if LISTEN_FDNAMES is not set.
+	systemdDefaultName = "unknown"
+	// socketDialTimeout is a timeout to check that a Unix socket file is used by a running process.
+	socketDialTimeout = time.Second
+)
+
+// activatedSockets is a set of listeners passed by systemd socket activation.
+type activatedSockets struct {
+	listeners []net.Listener
+	names     []string // FileDescriptorName of every listener
+	used      []bool
+}
+
+// systemdSockets returns listeners passed by systemd socket activation, it's empty if the process
+// wasn't activated by systemd. Environment variables are unset, so child processes don't inherit them.
+func systemdSockets() (*activatedSockets, error) {
+	defer func() {
+		for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+			_ = os.Unsetenv(key)
+		}
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return &activatedSockets{}, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+
+	var names []string
+	if value := os.Getenv("LISTEN_FDNAMES"); value != "" {
+		names = strings.Split(value, ":")
+	}
+
+	return fileSockets(systemdFirstFD, n, names)
+}
+
+// fileSockets returns listeners of n sequential file descriptors from the first one with their names.
+func fileSockets(first, n int, names []string) (*activatedSockets, error) {
+	sockets := &activatedSockets{
+		listeners: make([]net.Listener, 0, n),
+		names:     make([]string, 0, n),
+		used:      make([]bool, n),
+	}
+
+	for i := range n {
+		name := systemdDefaultName
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		// the listener uses a duplicated descriptor, so the original one is closed
+		f := os.NewFile(uintptr(first+i), name)
+		if f == nil {
+			return nil, errors.Join(fmt.Errorf("invalid systemd socket %d %q", first+i, name), sockets.Close())
+		}
+
+		ln, err := net.FileListener(f)
+		closeErr := f.Close()
+
+		if err = errors.Join(err, closeErr); err != nil {
+			return nil, errors.Join(fmt.Errorf("systemd socket %d %q: %w", first+i, name, err), sockets.Close())
+		}
+
+		sockets.listeners = append(sockets.listeners, ln)
+		sockets.names = append(sockets.names, name)
+	}
+
+	return sockets, nil
+}
+
+// Select returns listeners with the name or all of them if the name is empty.
+func (s *activatedSockets) Select(name string) []net.Listener {
+	var listeners []net.Listener
+
+	for i, ln := range s.listeners {
+		if name == "" || s.names[i] == name {
+			listeners = append(listeners, ln)
+			s.used[i] = true
+		}
+	}
+
+	return listeners
+}
+
+// Close closes listeners, which were not selected.
+func (s *activatedSockets) Close() error {
+	var errs []error
+
+	for i, ln := range s.listeners {
+		if s.used[i] {
+			continue
+		}
+
+		slog.Warn("close unused systemd socket", "name", s.names[i], "addr", ln.Addr())
+		if err := ln.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// listen returns listeners of the address "host:port", "unix:<path>", "systemd" or "systemd:<name>".
+func listen(addr string, mode os.FileMode, sockets *activatedSockets) ([]net.Listener, error) {
+	if addr == cfg.ListenSystemd || strings.HasPrefix(addr, cfg.ListenSystemd+":") {
+		name := strings.TrimPrefix(strings.TrimPrefix(addr, cfg.ListenSystemd), ":")
+		listeners := sockets.Select(name)
+
+		if len(listeners) == 0 {
+			return nil, fmt.Errorf("no systemd sockets for %q", addr)
+		}
+		return listeners, nil
+	}
+
+	if path, ok := strings.CutPrefix(addr, cfg.ListenUnix); ok {
+		ln, err := listenUnix(path, mode)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen %q: %w", addr, err)
+	}
+
+	return []net.Listener{ln}, nil
+}
+
+// listenUnix creates the Unix socket with the file mode, a stale socket file of a stopped process is removed.
+// The socket file is removed after the listener closing.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode().Type() == os.ModeSocket {
+		if conn, dialErr := net.DialTimeout("unix", path, socketDialTimeout); dialErr == nil {
+			return nil, errors.Join(fmt.Errorf("unix socket %q is in use", path), conn.Close())
+		}
+
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale unix socket %q: %w", path, err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen unix socket %q: %w", path, err)
+	}
+
+	if err = os.Chmod(path, mode); err != nil {
+		return nil, errors.Join(fmt.Errorf("change unix socket %q mode: %w", path, err), ln.Close())
+	}
+
+	return ln, nil
+}
+
+// listenAll returns listeners of all addresses, already opened listeners are closed on error.
+func listenAll(addrs []string, mode os.FileMode, sockets *activatedSockets) ([]net.Listener, error) {
+	var result []net.Listener
+
+	for _, addr := range addrs {
+		listeners, err := listen(addr, mode, sockets)
+		if err != nil {
+			return nil, errors.Join(err, closeListeners(result))
+		}
+
+		result = append(result, listeners...)
+	}
+
+	return result, nil
+}
+
+// closeListeners closes all listeners.
+func closeListeners(listeners []net.Listener) error {
+	var errs []error
+
+	for _, ln := range listeners {
+		if err := ln.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
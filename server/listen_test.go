@@ -0,0 +1,313 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+// unixClient returns an HTTP client which connects to the Unix socket.
+func unixClient(path string) *http.Client {
+	return &http.Client{
+		Timeout: time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sock")
+
+	ln, err := listenUnix(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode := info.Mode(); mode.Type() != os.ModeSocket || mode.Perm() != 0o600 {
+		t.Errorf("unexpected socket mode %v", mode)
+	}
+
+	accepted := make(chan struct{})
+	go func() {
+		// accept a check connection of the second listener
+		if conn, acceptErr := ln.Accept(); acceptErr == nil {
+			_ = conn.Close()
+		}
+		close(accepted)
+	}()
+
+	if _, err = listenUnix(path, 0o600); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("expected in use error, got %v", err)
+	}
+	<-accepted
+
+	// a stale socket file is not removed by the listener
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err = ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ln, err = listenUnix(path, 0o660); err != nil {
+		t.Fatalf("stale socket is not replaced: %v", err)
+	}
+
+	if err = ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file is not removed: %v", err)
+	}
+
+	// not a socket file is kept
+	if err = os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = listenUnix(path, 0o600); err == nil {
+		t.Error("expected error for a regular file")
+	}
+}
+
+func TestClientIPMiddleware_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sock")
+
+	ln, err := listenUnix(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs := make(chan string, 2)
+	srv := &http.Server{
+		Handler: ClientIPMiddleware(
+			http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { addrs <- remoteAddress(r) }),
+			nil,
+			true,
+		),
+		ReadHeaderTimeout: time.Second,
+	}
+
+	go func() { _ = srv.Serve(ln) }()
+	defer func() { _ = srv.Close() }()
+
+	client := unixClient(path)
+	for _, forwarded := range []string{"", "192.168.1.1"} {
+		req, reqErr := http.NewRequest(http.MethodGet, "http://smerge/", nil)
+		if reqErr != nil {
+			t.Fatal(reqErr)
+		}
+
+		if forwarded != "" {
+			req.Header.Set(httpIPForwardedFor, forwarded)
+		}
+
+		resp, reqErr := client.Do(req)
+		if reqErr != nil {
+			t.Fatal(reqErr)
+		}
+		_ = resp.Body.Close()
+	}
+
+	if addr := <-addrs; addr != unixPeerAddr {
+		t.Errorf("got address %q without forwarded headers, want %q", addr, unixPeerAddr)
+	}
+
+	if addr := <-addrs; addr != "192.168.1.1" {
+		t.Errorf("got address %q of forwarded request, want 192.168.1.1", addr)
+	}
+}
+
+func TestFileSockets(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	// fileSockets closes the passed descriptor
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sockets, err := fileSockets(fd, 1, []string{"web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if listeners := sockets.Select("admin"); len(listeners) != 0 {
+		t.Errorf("unexpected admin listeners %v", listeners)
+	}
+
+	listeners := sockets.Select("web")
+	if len(listeners) != 1 || listeners[0].Addr().String() != ln.Addr().String() {
+		t.Fatalf("unexpected web listeners %v", listeners)
+	}
+
+	if err = sockets.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = closeListeners(listeners); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = fileSockets(-1, 1, nil); err == nil {
+		t.Error("expected error for invalid descriptor")
+	}
+}
+
+func TestSystemdSockets(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+
+	sockets, err := systemdSockets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(sockets.listeners); n != 0 {
+		t.Errorf("got %d sockets of other process", n)
+	}
+
+	if value, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Errorf("LISTEN_FDS is not unset: %q", value)
+	}
+
+	if _, err = listen(cfg.ListenSystemd, 0o660, sockets); err == nil {
+		t.Error("expected error without systemd sockets")
+	}
+}
+
+func TestRunUnixSockets(t *testing.T) {
+	var (
+		dir       = t.TempDir()
+		mainPath  = filepath.Join(dir, "main.sock")
+		adminPath = filepath.Join(dir, "admin.sock")
+	)
+
+	config := &cfg.Config{
+		Listen:     []string{cfg.ListenUnix + mainPath, "localhost:43210"},
+		SocketMode: "0600",
+		Timeout:    cfg.Duration(time.Second),
+		UserAgent:  "TestUserAgent",
+		Retries:    3,
+		Root:       dir,
+		Limiter: cfg.LimitOptions{
+			MaxConcurrent: 2,
+			Interval:      cfg.Duration(time.Second),
+			CleanInterval: cfg.Duration(time.Minute),
+		},
+		Admin: cfg.AdminOptions{Listen: cfg.ListenUnix + adminPath},
+		Groups: []cfg.Group{
+			{Name: "test1", Endpoint: "/test1", Period: cfg.Duration(time.Hour), Static: []string{"ss://a"}},
+		},
+	}
+
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	serverDone := make(chan struct{})
+	go func() {
+		Run(config, "test version", testSignal)
+		close(serverDone)
+	}()
+
+	if err := waitForServerReady("localhost:43210", startTime); err != nil {
+		t.Fatalf("server did not start: %v", err)
+	}
+
+	if err := waitForReady(unixClient(mainPath), "http://smerge", startTime); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path string
+		url  string
+	}{
+		{path: mainPath, url: "http://smerge/test1"},
+		{path: adminPath, url: "http://smerge/admin/status"},
+	} {
+		resp, err := unixClient(tc.path).Get(tc.url)
+		if err != nil {
+			t.Fatalf("failed to make request: %v", err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			t.Errorf("failed to close response body: %v", closeErr)
+		}
+
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Errorf("unexpected response %d %q of %s: %v", resp.StatusCode, body, tc.url, err)
+		}
+	}
+
+	if info, err := os.Stat(mainPath); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("unexpected socket file %v: %v", info, err)
+	}
+
+	proc, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("failed to find current process: %v", err)
+	}
+
+	if err = proc.Signal(testSignal); err != nil {
+		t.Fatalf("failed to send signal: %v", err)
+	}
+
+	select {
+	case <-serverDone:
+		// server stopped successfully
+	case <-time.After(5 * time.Second):
+		t.Error("server didn't stop within timeout")
+	}
+
+	for _, path := range []string{mainPath, adminPath} {
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("socket file %q is not removed: %v", path, err)
+		}
+	}
+}
+
+func TestRun_ListenError(t *testing.T) {
+	config := &cfg.Config{Listen: []string{cfg.ListenSystemd}, Timeout: timeout}
+
+	serverDone := make(chan struct{})
+	go func() {
+		Run(config, "test version", testSignal)
+		close(serverDone)
+	}()
+
+	select {
+	case <-serverDone:
+		// server is not started
+	case <-time.After(time.Second):
+		t.Error("server didn't stop within timeout")
+	}
+}
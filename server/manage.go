@@ -0,0 +1,422 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+const (
+	// maxManageBodySize is a maximum size of management API request body.
+	maxManageBodySize = 1 << 20 // 1Mb
+	// hiddenToken is a masked access token of a group in responses and audit entries.
+	hiddenToken = "***"
+)
+
+var (
+	// errUnknownSubscription is an error of a missing subscription.
+	errUnknownSubscription = errors.New("unknown subscription")
+	// errPersist is an error of overlay saving.
+	errPersist = errors.New("persist error")
+	// errAudit is an error of audit log writing.
+	errAudit = errors.New("audit error")
+)
+
+// auditEntry is a record of the management API audit log.
+type auditEntry struct {
+	Time         time.Time `json:"time"`
+	Editor       string    `json:"editor"`
+	RemoteAddr   string    `json:"remote_addr"`
+	RequestID    string    `json:"request_id,omitempty"`
+	Action       string    `json:"action"`
+	Group        string    `json:"group"`
+	Subscription string    `json:"subscription,omitempty"`
+	Value        any       `json:"value,omitempty"` // new group or subscription
+	Error        string    `json:"error,omitempty"` // the audited change is failed and isn't applied
+}
+
+// auditLog appends entries to the audit log file as JSON lines.
+type auditLog struct {
+	sync.Mutex
+}
+
+// Write appends the entry to the file.
+func (al *auditLog) Write(fileName string, entry *auditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal audit entry: %w", err)
+	}
+
+	al.Lock()
+	defer al.Unlock()
+
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		err = fmt.Errorf("write audit log: %w", err)
+	}
+
+	if closeErr := f.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	return err
+}
+
+// redactGroup returns a copy of the group without access tokens values.
+func redactGroup(group cfg.Group) *cfg.Group {
+	if n := len(group.Tokens); n > 0 {
+		group.Tokens = slices.Repeat([]string{hiddenToken}, n)
+	}
+	return &group
+}
+
+// restoreTokens replaces hidden access tokens of the group by the current tokens at the same positions,
+// so a group from a response can be sent back. A hidden token without a current one is an error.
+func restoreTokens(group *cfg.Group, config *cfg.Config) error {
+	current, _ := config.Group(group.Name)
+
+	for i, token := range group.Tokens {
+		if token != hiddenToken {
+			continue
+		}
+
+		if i >= len(current.Tokens) {
+			return errors.Join(cfg.ErrParse, fmt.Errorf("group %q hidden token [%d] is unknown", group.Name, i))
+		}
+
+		group.Tokens[i] = current.Tokens[i]
+	}
+
+	return nil
+}
+
+// Change applies the configuration change returned by the function and records it to the audit log.
+// The audit entry is written before saving the new configuration overlay, and the overlay is saved
+// before applying, so an unrecorded or unsaved change is not applied.
+// A failed saving is recorded by one more audit entry with the error.
+func (rl *reloader) Change(entry *auditEntry, change func(config *cfg.Config) (*cfg.Config, error)) error {
+	rl.Lock()
+	defer rl.Unlock()
+
+	config, err := change(rl.config)
+	if err != nil {
+		return err
+	}
+
+	auditFile := filepath.Join(config.Root, config.Admin.AuditLog)
+	if err = rl.audit.Write(auditFile, entry); err != nil {
+		return errors.Join(errAudit, err)
+	}
+
+	overlay := config.CurrentOverlay()
+	data, err := json.MarshalIndent(&overlay, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(config.OverlayPath(), data)
+	}
+
+	if err != nil {
+		err = errors.Join(errPersist, err)
+		entry.Error = strings.ReplaceAll(err.Error(), "\n", ": ")
+
+		if auditErr := rl.audit.Write(auditFile, entry); auditErr != nil {
+			err = errors.Join(err, errAudit, auditErr)
+		}
+		return err
+	}
+
+	rl.apply(config)
+
+	slog.Info("management change",
+		"editor", entry.Editor,
+		"action", entry.Action,
+		"group", entry.Group,
+		"subscription", entry.Subscription,
+	)
+
+	return nil
+}
+
+// changeGroup returns a change of the group by the function.
+func changeGroup(name string, fn func(group *cfg.Group) error) func(config *cfg.Config) (*cfg.Config, error) {
+	return func(config *cfg.Config) (*cfg.Config, error) {
+		group, ok := config.Group(name)
+		if !ok {
+			return nil, errors.Join(cfg.ErrUnknownGroup, fmt.Errorf("group %q", name))
+		}
+
+		if err := fn(&group); err != nil {
+			return nil, err
+		}
+
+		return config.WithGroup(group)
+	}
+}
+
+// subscriptionIndex returns an index of the group subscription or an error if it's not found.
+func subscriptionIndex(group *cfg.Group, name string) (int, error) {
+	i := slices.IndexFunc(group.Subscriptions, func(s cfg.Subscription) bool { return s.Name == name })
+	if i < 0 {
+		return i, errors.Join(errUnknownSubscription, fmt.Errorf("subscription %q of group %q", name, group.Name))
+	}
+
+	return i, nil
+}
+
+// decodeBody decodes the JSON request body to the value, unknown fields are not allowed.
+func decodeBody(w http.ResponseWriter, r *http.Request, value any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxManageBodySize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(value); err != nil {
+		return errors.Join(cfg.ErrParse, fmt.Errorf("decode request body: %w", err))
+	}
+
+	return nil
+}
+
+// handleManage handles the management API requests with the path prefix "{prefix}/groups",
+// other requests are passed to the next handler. Requests without a valid editor token are not found.
+// Routes:
+//   - GET {prefix}/groups - all groups including disabled ones
+//   - GET, PUT, DELETE {prefix}/groups/{group} - get, add or replace, remove the group
+//   - POST {prefix}/groups/{group}/disable, {prefix}/groups/{group}/enable - disable or enable the group
+//   - PUT, DELETE {prefix}/groups/{group}/subscriptions/{subscription} - add or replace, remove the subscription
+//   - POST {prefix}/groups/{group}/subscriptions/{subscription}/disable (or enable) - disable or enable it
+func handleManage(next http.Handler, rl *reloader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := rl.current()
+		path, found := strings.CutPrefix(r.URL.Path, config.Admin.Prefix+"/groups")
+
+		if !found || len(config.Admin.Editors) == 0 || (path != "" && path[0] != '/') {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		editor, ok := config.Admin.Editor(requestToken(r, ""))
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		var (
+			reqID, _ = GetRequestID(r.Context())
+			entry    = &auditEntry{Time: time.Now().UTC(), Editor: editor, RemoteAddr: remoteAddress(r), RequestID: reqID}
+			parts    []string
+		)
+
+		if path = strings.Trim(path, "/"); path != "" {
+			parts = strings.Split(path, "/")
+		}
+
+		if len(parts) == 0 {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			groups := make([]*cfg.Group, len(config.Groups))
+			for i, group := range config.Groups {
+				groups[i] = redactGroup(group)
+			}
+
+			writeJSON(w, r, groups)
+			return
+		}
+
+		entry.Group = parts[0]
+		switch {
+		case len(parts) == 1:
+			manageGroup(w, r, rl, entry)
+		case len(parts) == 2 && (parts[1] == "disable" || parts[1] == "enable"):
+			manageGroupState(w, r, rl, entry, parts[1] == "disable")
+		case len(parts) == 3 && parts[1] == "subscriptions":
+			entry.Subscription = parts[2]
+			manageSubscription(w, r, rl, entry)
+		case len(parts) == 4 && parts[1] == "subscriptions" && (parts[3] == "disable" || parts[3] == "enable"):
+			entry.Subscription = parts[2]
+			manageSubscriptionState(w, r, rl, entry, parts[3] == "disable")
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		}
+	})
+}
+
+// manageGroup handles requests of the group: GET, PUT and DELETE.
+func manageGroup(w http.ResponseWriter, r *http.Request, rl *reloader, entry *auditEntry) {
+	switch r.Method {
+	case http.MethodGet:
+		if group, ok := rl.current().Group(entry.Group); ok {
+			writeJSON(w, r, redactGroup(group))
+			return
+		}
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case http.MethodPut:
+		var group cfg.Group
+		if err := decodeBody(w, r, &group); err != nil {
+			writeManageError(w, r, err)
+			return
+		}
+
+		if group.Name == "" {
+			group.Name = entry.Group
+		}
+
+		if group.Name != entry.Group {
+			writeManageError(w, r, errors.Join(cfg.ErrParse, fmt.Errorf("group name %q differs from path", group.Name)))
+			return
+		}
+
+		entry.Action, entry.Value = "group.put", redactGroup(group)
+		err := rl.Change(entry, func(config *cfg.Config) (*cfg.Config, error) {
+			if err := restoreTokens(&group, config); err != nil {
+				return nil, err
+			}
+			return config.WithGroup(group)
+		})
+		writeManageResult(w, r, rl, entry.Group, err)
+	case http.MethodDelete:
+		entry.Action = "group.delete"
+		err := rl.Change(entry, func(config *cfg.Config) (*cfg.Config, error) {
+			return config.WithoutGroup(entry.Group)
+		})
+
+		if err != nil {
+			writeManageError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// manageGroupState handles requests to disable or enable the group.
+func manageGroupState(w http.ResponseWriter, r *http.Request, rl *reloader, entry *auditEntry, disabled bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entry.Action = "group." + stateAction(disabled)
+	err := rl.Change(entry, changeGroup(entry.Group, func(group *cfg.Group) error {
+		group.Disabled = disabled
+		return nil
+	}))
+	writeManageResult(w, r, rl, entry.Group, err)
+}
+
+// manageSubscription handles requests of the group subscription: PUT and DELETE.
+func manageSubscription(w http.ResponseWriter, r *http.Request, rl *reloader, entry *auditEntry) {
+	var change func(group *cfg.Group) error
+
+	switch r.Method {
+	case http.MethodPut:
+		var sub cfg.Subscription
+		if err := decodeBody(w, r, &sub); err != nil {
+			writeManageError(w, r, err)
+			return
+		}
+
+		if sub.Name == "" {
+			sub.Name = entry.Subscription
+		}
+
+		if sub.Name != entry.Subscription {
+			writeManageError(w, r, errors.Join(cfg.ErrParse, fmt.Errorf("subscription name %q differs from path", sub.Name)))
+			return
+		}
+
+		entry.Action, entry.Value = "subscription.put", &sub
+		change = func(group *cfg.Group) error {
+			if i, err := subscriptionIndex(group, sub.Name); err == nil {
+				group.Subscriptions[i] = sub
+			} else {
+				group.Subscriptions = append(group.Subscriptions, sub)
+			}
+			return nil
+		}
+	case http.MethodDelete:
+		entry.Action = "subscription.delete"
+		change = func(group *cfg.Group) error {
+			i, err := subscriptionIndex(group, entry.Subscription)
+			if err != nil {
+				return err
+			}
+
+			group.Subscriptions = slices.Delete(group.Subscriptions, i, i+1)
+			return nil
+		}
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := rl.Change(entry, changeGroup(entry.Group, change))
+	writeManageResult(w, r, rl, entry.Group, err)
+}
+
+// manageSubscriptionState handles requests to disable or enable the group subscription.
+func manageSubscriptionState(w http.ResponseWriter, r *http.Request, rl *reloader, entry *auditEntry, disabled bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entry.Action = "subscription." + stateAction(disabled)
+	err := rl.Change(entry, changeGroup(entry.Group, func(group *cfg.Group) error {
+		i, err := subscriptionIndex(group, entry.Subscription)
+		if err != nil {
+			return err
+		}
+
+		group.Subscriptions[i].Disabled = disabled
+		return nil
+	}))
+	writeManageResult(w, r, rl, entry.Group, err)
+}
+
+// stateAction returns an audit action name of the state change.
+func stateAction(disabled bool) string {
+	if disabled {
+		return "disable"
+	}
+	return "enable"
+}
+
+// writeManageResult writes the changed group without access tokens or the error to the response.
+func writeManageResult(w http.ResponseWriter, r *http.Request, rl *reloader, groupName string, err error) {
+	if err != nil {
+		writeManageError(w, r, err)
+		return
+	}
+
+	group, _ := rl.current().Group(groupName)
+	writeJSON(w, r, redactGroup(group))
+}
+
+// writeManageError writes the management API error to the response.
+// Unknown groups and subscriptions are not found, persistence and audit errors are internal, others are bad requests.
+func writeManageError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, cfg.ErrUnknownGroup) || errors.Is(err, errUnknownSubscription):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case errors.Is(err, errPersist) || errors.Is(err, errAudit):
+		slog.ErrorContext(r.Context(), "management change is not saved", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	default:
+		http.Error(w, strings.ReplaceAll(err.Error(), "\n", ": "), http.StatusBadRequest)
+	}
+}
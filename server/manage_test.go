@@ -0,0 +1,472 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/crawler"
+)
+
+// manageConfigJSON is a configuration with the management API, root directory is set by the argument.
+const manageConfigJSON = `{
+  "host": "localhost",
+  "port": 43210,
+  "user_agent": "TestUserAgent",
+  "timeout": "5s",
+  "root": %q,
+  "retries": 1,
+  "limiter": {"max_concurrent": 2, "interval": "1s", "clean_interval": "1m"},
+  "admin": {"token": "admin12345", "editors": [{"name": "alice", "token": "alice12345"}]},
+  "groups": [{"name": "group1", "endpoint": "/group1", "period": "1h", "static": ["ss://a"]}]
+}`
+
+func TestHandleManage(t *testing.T) {
+	const editorToken = "alice12345"
+	var (
+		root       = t.TempDir()
+		configFile = filepath.Join(root, "config.json")
+	)
+
+	if err := os.WriteFile(configFile, fmt.Appendf(nil, manageConfigJSON, root), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := cfg.New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cr := crawler.New(config.ActiveGroups(), config.UserAgent, config.Retries, 2, config.Root)
+	cr.Run()
+	defer cr.Shutdown()
+
+	var (
+		users   = newUserRegistry(nil, "", "")
+		groups  = newReloadableHandler(buildGroupsHandler(config, cr, users))
+		rl      = &reloader{config: config, cr: cr, users: users, groups: groups}
+		next    = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusTeapot) })
+		handler = handleManage(next, rl)
+	)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		token        string
+		body         string
+		expectedCode int
+		expectedBody string
+		hiddenToken  bool // the group token is not in the response
+	}{
+		{name: "other path", method: http.MethodGet, path: "/admin/groupsx", token: editorToken, expectedCode: http.StatusTeapot},
+		{name: "no token", method: http.MethodGet, path: "/admin/groups", expectedCode: http.StatusNotFound},
+		{name: "admin token", method: http.MethodGet, path: "/admin/groups", token: "admin12345", expectedCode: http.StatusNotFound},
+		{
+			name:         "list groups",
+			method:       http.MethodGet,
+			path:         "/admin/groups",
+			token:        editorToken,
+			expectedCode: http.StatusOK,
+			expectedBody: `"name":"group1"`,
+		},
+		{name: "list method", method: http.MethodPost, path: "/admin/groups", token: editorToken, expectedCode: http.StatusMethodNotAllowed},
+		{
+			name:         "add group",
+			method:       http.MethodPut,
+			path:         "/admin/groups/group2",
+			token:        editorToken,
+			body:         `{"endpoint": "/group2", "period": "1h", "static": ["ss://b"], "tokens": ["group2token"]}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `"name":"group2"`,
+			hiddenToken:  true,
+		},
+		{
+			name:         "get protected group",
+			method:       http.MethodGet,
+			path:         "/admin/groups/group2",
+			token:        editorToken,
+			expectedCode: http.StatusOK,
+			expectedBody: `"tokens":["***"]`,
+			hiddenToken:  true,
+		},
+		{
+			name:         "list protected groups",
+			method:       http.MethodGet,
+			path:         "/admin/groups",
+			token:        editorToken,
+			expectedCode: http.StatusOK,
+			expectedBody: `"name":"group2"`,
+			hiddenToken:  true,
+		},
+		{
+			name:         "put hidden token",
+			method:       http.MethodPut,
+			path:         "/admin/groups/group2",
+			token:        editorToken,
+			body:         `{"name":"group2","endpoint":"/group2","period":"1h","static":["ss://b"],"tokens":["***"]}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `"tokens":["***"]`,
+			hiddenToken:  true,
+		},
+		{
+			name:         "put unknown hidden token",
+			method:       http.MethodPut,
+			path:         "/admin/groups/group2",
+			token:        editorToken,
+			body:         `{"endpoint": "/group2", "period": "1h", "static": ["ss://b"], "tokens": ["***", "***"]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "hidden token [1] is unknown",
+		},
+		{
+			name:         "invalid group",
+			method:       http.MethodPut,
+			path:         "/admin/groups/group3",
+			token:        editorToken,
+			body:         `{"endpoint": "/group3", "period": "1h"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "has no subscriptions",
+		},
+		{
+			name:         "unknown field",
+			method:       http.MethodPut,
+			path:         "/admin/groups/group3",
+			token:        editorToken,
+			body:         `{"endpoint": "/group3", "period": "1h", "unknown": true}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "name mismatch",
+			method:       http.MethodPut,
+			path:         "/admin/groups/group3",
+			token:        editorToken,
+			body:         `{"name": "group4", "endpoint": "/group3", "period": "1h", "static": ["ss://b"]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "add subscription",
+			method:       http.MethodPut,
+			path:         "/admin/groups/group2/subscriptions/sub1",
+			token:        editorToken,
+			body:         `{"inline": ["vless://c"]}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `"subscriptions":[{"name":"sub1"`,
+		},
+		{
+			name:         "disable subscription",
+			method:       http.MethodPost,
+			path:         "/admin/groups/group2/subscriptions/sub1/disable",
+			token:        editorToken,
+			expectedCode: http.StatusOK,
+			expectedBody: `"disabled":true`,
+		},
+		{
+			name:         "unknown subscription",
+			method:       http.MethodDelete,
+			path:         "/admin/groups/group2/subscriptions/sub2",
+			token:        editorToken,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "delete subscription",
+			method:       http.MethodDelete,
+			path:         "/admin/groups/group2/subscriptions/sub1",
+			token:        editorToken,
+			expectedCode: http.StatusOK,
+			expectedBody: `"subscriptions":[]`,
+		},
+		{
+			name:         "disable group",
+			method:       http.MethodPost,
+			path:         "/admin/groups/group1/disable",
+			token:        editorToken,
+			expectedCode: http.StatusOK,
+			expectedBody: `"disabled":true`,
+		},
+		{name: "get group", method: http.MethodGet, path: "/admin/groups/group1", token: editorToken, expectedCode: http.StatusOK},
+		{name: "unknown group", method: http.MethodGet, path: "/admin/groups/group5", token: editorToken, expectedCode: http.StatusNotFound},
+		{name: "delete unknown", method: http.MethodDelete, path: "/admin/groups/group5", token: editorToken, expectedCode: http.StatusNotFound},
+		{name: "state method", method: http.MethodGet, path: "/admin/groups/group1/enable", token: editorToken, expectedCode: http.StatusMethodNotAllowed},
+		{name: "unknown route", method: http.MethodGet, path: "/admin/groups/group1/other", token: editorToken, expectedCode: http.StatusNotFound},
+		{name: "delete group", method: http.MethodDelete, path: "/admin/groups/group1", token: editorToken, expectedCode: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", bearerPrefix+tt.token)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedCode, w.Code, w.Body.String())
+			}
+
+			if body := w.Body.String(); !strings.Contains(body, tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedBody, body)
+			}
+
+			if tt.hiddenToken && strings.Contains(w.Body.String(), "group2token") {
+				t.Errorf("response contains group token: %q", w.Body.String())
+			}
+		})
+	}
+
+	// group2 is served by its token, deleted group1 is not found
+	if code := waitStatus(groups, "/group2/group2token", http.StatusOK); code != http.StatusOK {
+		t.Errorf("group2 status %d", code)
+	}
+
+	if code := waitStatus(groups, "/group1", http.StatusNotFound); code != http.StatusNotFound {
+		t.Errorf("group1 status %d", code)
+	}
+
+	// overlay is used by a new configuration
+	reloaded, err := cfg.New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reloaded.Groups) != 1 || reloaded.Groups[0].Name != "group2" {
+		t.Errorf("unexpected reloaded groups %+v", reloaded.Groups)
+	}
+
+	f, err := os.Open(filepath.Join(root, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+	}()
+
+	var actions []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if entry.Editor != "alice" {
+			t.Errorf("unexpected editor %q", entry.Editor)
+		}
+
+		if strings.Contains(scanner.Text(), "group2token") {
+			t.Error("audit log contains group token")
+		}
+		actions = append(actions, entry.Action)
+	}
+
+	expected := "group.put,group.put,subscription.put,subscription.disable,subscription.delete,group.disable,group.delete"
+	if got := strings.Join(actions, ","); got != expected {
+		t.Errorf("unexpected audit actions %q", got)
+	}
+}
+
+func TestHandleManage_AuditError(t *testing.T) {
+	root := t.TempDir()
+	configFile := filepath.Join(root, "config.json")
+
+	if err := os.WriteFile(configFile, fmt.Appendf(nil, manageConfigJSON, root), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := cfg.New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the audit log can't be written to a directory
+	config.Admin.AuditLog = "."
+
+	cr := crawler.New(config.ActiveGroups(), config.UserAgent, config.Retries, 2, config.Root)
+	defer cr.Shutdown()
+
+	var (
+		users   = newUserRegistry(nil, "", "")
+		groups  = newReloadableHandler(buildGroupsHandler(config, cr, users))
+		rl      = &reloader{config: config, cr: cr, users: users, groups: groups}
+		handler = handleManage(http.NotFoundHandler(), rl)
+		req     = httptest.NewRequest(http.MethodPost, "/admin/groups/group1/disable", nil)
+		w       = httptest.NewRecorder()
+	)
+
+	req.Header.Set("Authorization", bearerPrefix+"alice12345")
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+
+	if group, _ := rl.current().Group("group1"); group.Disabled {
+		t.Error("unrecorded change is applied")
+	}
+
+	if _, err = os.Stat(config.OverlayPath()); !os.IsNotExist(err) {
+		t.Errorf("unrecorded change is saved: %v", err)
+	}
+}
+
+func TestHandleManage_PersistError(t *testing.T) {
+	root := t.TempDir()
+	configFile := filepath.Join(root, "config.json")
+
+	if err := os.WriteFile(configFile, fmt.Appendf(nil, manageConfigJSON, root), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := cfg.New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the overlay can't replace a directory
+	config.Overlay = "."
+
+	cr := crawler.New(config.ActiveGroups(), config.UserAgent, config.Retries, 2, config.Root)
+	defer cr.Shutdown()
+
+	var (
+		users   = newUserRegistry(nil, "", "")
+		groups  = newReloadableHandler(buildGroupsHandler(config, cr, users))
+		rl      = &reloader{config: config, cr: cr, users: users, groups: groups}
+		handler = handleManage(http.NotFoundHandler(), rl)
+		req     = httptest.NewRequest(http.MethodPost, "/admin/groups/group1/disable", nil)
+		w       = httptest.NewRecorder()
+	)
+
+	req.Header.Set("Authorization", bearerPrefix+"alice12345")
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+
+	if group, _ := rl.current().Group("group1"); group.Disabled {
+		t.Error("unsaved change is applied")
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, config.Admin.AuditLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if n := len(lines); n != 2 {
+		t.Fatalf("got %d audit entries, want 2", n)
+	}
+
+	var entry auditEntry
+	if err = json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Action != "group.disable" || !strings.Contains(entry.Error, "persist error") {
+		t.Errorf("unexpected failure audit entry %+v", entry)
+	}
+}
+
+func TestHandleManage_ServeRace(t *testing.T) {
+	const configJSON = `{
+  "host": "localhost",
+  "port": 43210,
+  "user_agent": "TestUserAgent",
+  "timeout": "5s",
+  "root": %q,
+  "retries": 1,
+  "limiter": {"max_concurrent": 2, "interval": "1s", "clean_interval": "1m"},
+  "admin": {"token": "admin12345", "editors": [{"name": "alice", "token": "alice12345"}]},
+  "format_rules": [{"user_agent": "^clash", "format": "plain"}],
+  "groups": [
+    {
+      "name": "group1",
+      "endpoint": "/group1",
+      "period": "1h",
+      "static": ["ss://a"],
+      "subscriptions": [{"name": "sub1", "inline": ["ss://b"]}]
+    },
+    {
+      "name": "group2",
+      "endpoint": "/group2",
+      "period": "1h",
+      "subscriptions": [{"name": "sub2", "url": "sub2.txt", "local": true, "timeout": "1s", "retry": {}}]
+    }
+  ]
+}`
+	root := t.TempDir()
+	configFile := filepath.Join(root, "config.json")
+
+	if err := os.WriteFile(filepath.Join(root, "sub2.txt"), []byte("ss://c\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(configFile, fmt.Appendf(nil, configJSON, root), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := cfg.New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cr := crawler.New(config.ActiveGroups(), config.UserAgent, config.Retries, 2, config.Root)
+	cr.Run()
+	defer cr.Shutdown()
+
+	var (
+		users   = newUserRegistry(nil, "", "")
+		groups  = newReloadableHandler(buildGroupsHandler(config, cr, users))
+		rl      = &reloader{config: config, cr: cr, users: users, groups: groups}
+		handler = handleManage(groups, rl)
+		done    = make(chan struct{})
+		served  = make(chan struct{})
+		started = make(chan struct{})
+	)
+
+	go func() {
+		defer close(served)
+
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/group1", nil)
+			req.Header.Set("User-Agent", "clash-meta")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if i == 0 {
+				close(started)
+			}
+		}
+	}()
+	<-started
+
+	for _, action := range []string{"disable", "enable", "disable", "enable"} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/groups/group1/"+action, nil)
+		req.Header.Set("Authorization", bearerPrefix+"alice12345")
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: got status %d, want %d", action, w.Code, http.StatusOK)
+		}
+	}
+
+	close(done)
+	<-served
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/z0rr0/smerge/metrics"
+)
+
+// requestInfo is a key for mutable request details in a request context.
+const requestInfo ctxKey = "requestInfo"
+
+var (
+	httpRequests = metrics.NewCounterVec(
+		"smerge_http_requests_total", "Number of HTTP requests by group and status code.", "group", "status",
+	)
+	rateLimitRejections = metrics.NewCounterVec(
+		"smerge_rate_limit_rejections_total", "Number of requests rejected by the rate limiter.",
+	)
+	limiterBuckets = metrics.NewGaugeFunc(
+		"smerge_limiter_buckets", "Number of active rate limiter buckets.",
+	)
+)
+
+// info is a request details filled by handlers.
+type info struct {
+	group string
+}
+
+// withRequestInfo returns a context with empty request details.
+func withRequestInfo(ctx context.Context) (context.Context, *info) {
+	ri := &info{}
+	return context.WithValue(ctx, requestInfo, ri), ri
+}
+
+// setRequestGroup sets the group name of the request if its context has request details.
+func setRequestGroup(ctx context.Context, groupName string) {
+	if ri, ok := ctx.Value(requestInfo).(*info); ok {
+		ri.group = groupName
+	}
+}
+
+// observeRequest records metrics of the completed request.
+func observeRequest(ri *info, status int) {
+	httpRequests.Inc(ri.group, strconv.Itoa(status))
+}
+
+// handleMetrics serves Prometheus metrics with the path, other requests are passed to the next handler.
+// Requests without a valid token are not found if the token is set.
+func handleMetrics(next http.Handler, path, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimRight(r.URL.Path, "/") != path {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if token != "" && !validToken(requestToken(r, ""), []string{token}) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if _, err := metrics.Default.WriteTo(w); err != nil {
+			ctx := r.Context()
+			reqID, _ := GetRequestID(ctx)
+			slog.ErrorContext(ctx, "response write error", "id", reqID, "error", err)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/metrics"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	const token = "metrics123"
+	var (
+		groups = map[string]*cfg.Group{"group1": {Name: "metrics_group"}}
+		next   = handleGroup(groups, nil, nil, &mockCrawler{data: "data"})
+	)
+	handler := LoggingMiddleware(handleMetrics(next, "/metrics", token), nil, nil)
+
+	// metrics are shared by tests, so the group request is checked by a change of its counter
+	series := `smerge_http_requests_total{group="metrics_group",status="200"}`
+	before := metricValue(t, series)
+
+	req := httptest.NewRequest(http.MethodGet, "/group1", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if delta := metricValue(t, series) - before; delta != 1 {
+		t.Errorf("group requests counter is changed by %v, want 1", delta)
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		token        string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "metrics",
+			path:         "/metrics",
+			token:        token,
+			expectedCode: http.StatusOK,
+			expectedBody: series + " ",
+		},
+		{
+			name:         "trailing slash",
+			path:         "/metrics/",
+			token:        token,
+			expectedCode: http.StatusOK,
+			expectedBody: "# TYPE smerge_http_requests_total counter",
+		},
+		{name: "no token", path: "/metrics", expectedCode: http.StatusNotFound},
+		{name: "invalid token", path: "/metrics", token: "invalid123", expectedCode: http.StatusNotFound},
+		{name: "other path", path: "/group1", token: token, expectedCode: http.StatusOK, expectedBody: "data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", bearerPrefix+tt.token)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, w.Code)
+			}
+
+			if body := w.Body.String(); !strings.Contains(body, tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedBody, body)
+			}
+		})
+	}
+}
+
+// metricValue returns the current value of the series from the default registry, zero if it's not written.
+func metricValue(t *testing.T, series string) float64 {
+	var b strings.Builder
+	if _, err := metrics.Default.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	for line := range strings.Lines(b.String()) {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+	}
+
+	return 0
+}
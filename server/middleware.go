@@ -3,16 +3,19 @@ package server
 import (
 	"bufio"
 	"context"
+	"encoding/base64"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
 	"runtime/debug"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/convert"
 	"github.com/z0rr0/smerge/crawler"
 	"github.com/z0rr0/smerge/limiter"
 )
@@ -101,23 +104,49 @@ func (rw *responseWriter) Push(target string, opts *http.PushOptions) error {
 	return fmt.Errorf("underlying ResponseWriter does not implement http.Pusher")
 }
 
-// LoggingMiddleware creates a middleware that logs incoming requests and their duration
-func LoggingMiddleware(next http.Handler) http.Handler {
+// ClientIPMiddleware finds the client address of the request by forwarded headers of trusted proxies
+// and stores it in the request context with a flag that the connection is from a trusted proxy.
+// Peers of Unix socket listeners are trusted proxies only if unixTrusted is true. It should be the first middleware.
+func ClientIPMiddleware(next http.Handler, proxies []netip.Prefix, unixTrusted bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIP, clientAddress(r, proxies, unixTrusted))
+		ctx = context.WithValue(ctx, trustedProxy, trustedPeer(r, proxies, unixTrusted))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// LoggingMiddleware creates a middleware that logs incoming requests and their duration,
+// completed requests are also written to the access log if it's not nil.
+// A valid incoming request ID is used only if the request is from a trusted proxy, otherwise a new one is generated.
+// The redact function hides access tokens of logged paths, only users' tokens are hidden if it's nil.
+func LoggingMiddleware(next http.Handler, al *accessLogger, redact func(string) string) http.Handler {
+	level := al.requestLevel()
+	if redact == nil {
+		redact = func(path string) string { return redactPath(path, nil) }
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var (
 			start      = time.Now()
-			reqID      = generateRequestID()
+			reqID      string
 			remoteAddr = remoteAddress(r)
+			path       = redact(r.URL.Path)
 		)
 
-		ctx := r.Context()
+		if id, ok := incomingRequestID(r); ok && isTrustedProxy(r) {
+			reqID = id
+		} else {
+			reqID = generateRequestID()
+		}
+
+		ctx, ri := withRequestInfo(r.Context())
 		ctx = context.WithValue(ctx, requestID, reqID)
 		r = r.WithContext(ctx)
 
-		slog.InfoContext(ctx, "request started",
+		slog.Log(ctx, level, "request started",
 			"id", reqID,
 			"method", r.Method,
-			"path", r.URL.Path,
+			"path", path,
 			"remote_addr", remoteAddr,
 			"user_agent", r.UserAgent(),
 		)
@@ -127,17 +156,22 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 
 		next.ServeHTTP(wrappedWriter, r)
 		duration := time.Since(start)
+		observeRequest(ri, wrappedWriter.Status())
+		if al != nil {
+			al.Log(newAccessRecord(r, path, reqID, ri, wrappedWriter, start, duration))
+		}
+
 		attrs := []any{
 			slog.String("id", reqID),
 			slog.String("method", r.Method),
-			slog.String("path", r.URL.Path),
+			slog.String("path", path),
 			slog.String("remote_addr", remoteAddr),
 			slog.Int("status", wrappedWriter.Status()),
 			slog.Duration("duration", duration),
 		}
 
 		if r.URL.RawQuery != "" {
-			attrs = append(attrs, slog.String("query", r.URL.RawQuery))
+			attrs = append(attrs, slog.String("query", redactQuery(r.URL)))
 		}
 
 		switch {
@@ -146,7 +180,7 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		case wrappedWriter.Status() >= http.StatusBadRequest:
 			slog.WarnContext(ctx, "request completed with client error", attrs...)
 		default:
-			slog.InfoContext(ctx, "request completed", attrs...)
+			slog.Log(ctx, level, "request completed", attrs...)
 		}
 	})
 }
@@ -167,18 +201,29 @@ func ErrorHandlingMiddleware(next http.Handler) http.Handler {
 }
 
 // RateLimiterMiddleware is a middleware that limits the rate of incoming requests.
-func RateLimiterMiddleware(next http.Handler, ipLimiter *limiter.IPRateLimiter) http.Handler {
+// The policy function chooses a rate limit policy by the request, the default policy is used if it's nil.
+func RateLimiterMiddleware(
+	next http.Handler, ipLimiter *limiter.IPRateLimiter, policy func(*http.Request) string,
+) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if ipLimiter == nil {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		ctx := r.Context()
-		remoteAddr := remoteAddress(r)
+		var (
+			ctx        = r.Context()
+			remoteAddr = remoteAddress(r)
+			name       string
+		)
+
+		if policy != nil {
+			name = policy(r)
+		}
 
-		if bucket := ipLimiter.GetBucket(remoteAddr); !bucket.Allow() {
-			slog.WarnContext(ctx, "rate limit exceeded", "remote_addr", remoteAddr)
+		if bucket := ipLimiter.GetPolicyBucket(name, remoteAddr); !bucket.Allow() {
+			slog.WarnContext(ctx, "rate limit exceeded", "remote_addr", remoteAddr, "policy", name)
+			rateLimitRejections.Inc()
 			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
 			return
 		}
@@ -218,36 +263,141 @@ func HealthCheckMiddleware(next http.Handler, versionInfo string) http.Handler {
 }
 
 // handleGroup is a main logic for handling group requests.
-func handleGroup(groups map[string]*cfg.Group, cr crawler.Getter) http.HandlerFunc {
+// A group with access tokens requires a valid token as the last path segment,
+// Authorization header or query parameter, otherwise it's not found to hide its existence.
+func handleGroup(
+	groups map[string]*cfg.Group, tokens map[string][]string, rules cfg.FormatRules, cr crawler.Getter,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		url := strings.Trim(r.URL.Path, "/ ")
-		group, ok := groups[url]
+		group, pathToken, ok := lookupGroup(groups, r.URL.Path)
+
+		if ok {
+			if groupTokens := tokens[group.Name]; len(groupTokens) > 0 {
+				ok = validToken(requestToken(r, pathToken), groupTokens)
+			} else {
+				ok = pathToken == ""
+			}
+		}
+
 		if !ok {
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
 		}
 
-		force := parseBool(r.FormValue("force"))
-		decode := parseBool(r.FormValue("decode"))
-		groupData, err := cr.Get(group.Name, force, decode)
+		serveGroup(w, r, group, rules, cr)
+	}
+}
 
-		if err != nil {
-			slog.ErrorContext(r.Context(), "handle group", "name", group.Name, "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+// handleUsers handles personal users' requests with the path "/u/{token}/{group}",
+// where group is a group endpoint. Other requests are passed to the next handler.
+// An unknown, disabled or expired user and not allowed group are not found to hide their existence.
+func handleUsers(
+	next http.Handler, groups map[string]*cfg.Group, users *userRegistry, rules cfg.FormatRules, cr crawler.Getter,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, found := strings.CutPrefix(r.URL.Path, usersPrefix)
+		if !found {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		w.Header().Set("Content-Type", "text/plain")
-		if _, writeErr := w.Write(groupData); writeErr != nil {
-			ctx := r.Context()
-			reqID, exists := GetRequestID(ctx)
+		var (
+			now                = time.Now()
+			token, endpoint, _ = strings.Cut(path, "/")
+			group, groupExists = groups[strings.Trim(endpoint, "/ ")]
+			user, userExists   = users.Lookup(token)
+		)
 
-			if !exists {
-				reqID = "unknown"
-				slog.WarnContext(ctx, "request id not found", "method", r.Method, "path", r.URL.Path)
-			}
+		if !groupExists || !userExists || !user.Active(now) || !user.Allowed(group.Name) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
 
-			slog.ErrorContext(ctx, "response write error", "id", reqID, "error", writeErr)
+		users.Visit(user.Name, remoteAddress(r), now)
+		serveGroup(w, r, group, rules, cr)
+	})
+}
+
+// groupFormat returns the output format of the group data and true if it's chosen
+// by "format" or "decode" query parameters or by User-Agent rules if there are no parameters.
+// A false "decode" value or no matched rules keep the group data as is.
+func groupFormat(r *http.Request, rules cfg.FormatRules) (cfg.Format, bool, error) {
+	query := r.URL.Query()
+
+	if query.Has("format") {
+		format := cfg.Format(query.Get("format"))
+		return format, true, format.Validate()
+	}
+
+	if query.Has("decode") {
+		if parseBool(query.Get("decode")) {
+			return cfg.FormatPlain, true, nil
 		}
+		return "", false, nil
+	}
+
+	format, ok := rules.Format(r.UserAgent())
+	return format, ok, nil
+}
+
+// convertGroup returns a client configuration of the plain group data, unsupported URIs are skipped.
+func convertGroup(ctx context.Context, groupName string, data []byte, configure func([]*convert.Proxy) []byte) []byte {
+	proxies, skipped := convert.ParseList(data)
+	if skipped > 0 {
+		slog.DebugContext(ctx, "unsupported URIs are skipped", "group", groupName, "count", skipped)
+	}
+
+	return configure(proxies)
+}
+
+// serveGroup writes the group data to the response in the requested format.
+func serveGroup(w http.ResponseWriter, r *http.Request, group *cfg.Group, rules cfg.FormatRules, cr crawler.Getter) {
+	ctx := r.Context()
+	setRequestGroup(ctx, group.Name)
+
+	if len(rules) > 0 {
+		w.Header().Add("Vary", "User-Agent")
+	}
+
+	format, formatted, err := groupFormat(r, rules)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	force := parseBool(r.FormValue("force"))
+	reqID, exists := GetRequestID(ctx)
+	if exists {
+		// forced fetches forward it to upstreams
+		ctx = crawler.WithRequestID(ctx, reqID)
+	}
+
+	groupData, err := cr.Get(ctx, group.Name, force, formatted)
+
+	if err != nil {
+		slog.ErrorContext(ctx, "handle group", "name", group.Name, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// data is decoded by the crawler, so it's always plain here
+	contentType := "text/plain"
+	switch format {
+	case cfg.FormatBase64:
+		groupData = base64.StdEncoding.AppendEncode(nil, groupData)
+	case cfg.FormatClash:
+		groupData, contentType = convertGroup(ctx, group.Name, groupData, convert.Clash), "text/yaml; charset=utf-8"
+	case cfg.FormatSingBox:
+		groupData, contentType = convertGroup(ctx, group.Name, groupData, convert.SingBox), "application/json"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if _, writeErr := w.Write(groupData); writeErr != nil {
+		if !exists {
+			reqID = "unknown"
+			slog.WarnContext(ctx, "request id not found", "method", r.Method, "group", group.Name)
+		}
+
+		slog.ErrorContext(ctx, "response write error", "id", reqID, "error", writeErr)
 	}
 }
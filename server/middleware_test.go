@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"strings"
 	"testing"
 	"time"
@@ -159,7 +160,7 @@ func TestLoggingMiddleware(t *testing.T) {
 			req := httptest.NewRequest(tc.method, url, nil)
 			rec := httptest.NewRecorder()
 
-			handler := LoggingMiddleware(tc.handler)
+			handler := LoggingMiddleware(tc.handler, nil, nil)
 			handler.ServeHTTP(rec, req)
 
 			if rec.Code != tc.expectedCode {
@@ -177,6 +178,73 @@ func TestLoggingMiddleware(t *testing.T) {
 	}
 }
 
+func TestLoggingMiddleware_RequestID(t *testing.T) {
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string // empty value means a generated ID
+	}{
+		{name: "no headers", remoteAddr: "10.0.0.1:1234"},
+		{
+			name:       "trusted request ID",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Request-ID": "abc-123", "traceparent": traceParent},
+			expected:   "abc-123",
+		},
+		{
+			name:       "trusted traceparent",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"traceparent": traceParent},
+			expected:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:       "invalid request ID",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Request-ID": "abc 123\n", "traceparent": traceParent},
+			expected:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:       "untrusted",
+			remoteAddr: "192.168.1.1:1234",
+			headers:    map[string]string{"X-Request-ID": "abc-123", "traceparent": traceParent},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var ctxID string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctxID, _ = GetRequestID(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for key, value := range tc.headers {
+				req.Header.Set(key, value)
+			}
+
+			rec := httptest.NewRecorder()
+			ClientIPMiddleware(LoggingMiddleware(next, nil, nil), proxies, false).ServeHTTP(rec, req)
+
+			reqID := rec.Header().Get("X-Request-ID")
+			if reqID != ctxID {
+				t.Errorf("got header request ID %q, context one %q", reqID, ctxID)
+			}
+
+			switch {
+			case tc.expected != "" && reqID != tc.expected:
+				t.Errorf("got request ID %q, want %q", reqID, tc.expected)
+			case tc.expected == "" && len(reqID) != requestIDLen*2:
+				t.Errorf("got request ID %q, want a generated one", reqID)
+			}
+		})
+	}
+}
+
 type negativeResponseWriter struct {
 	statusCode int
 	header     http.Header
@@ -428,7 +496,7 @@ func TestRateLimiterMiddleware(t *testing.T) {
 				w.WriteHeader(http.StatusOK)
 			})
 
-			handler := RateLimiterMiddleware(nextHandler, tc.ipLimiter)
+			handler := RateLimiterMiddleware(nextHandler, tc.ipLimiter, nil)
 			handler.ServeHTTP(rec, req)
 
 			if rec.Code != tc.expectedCode {
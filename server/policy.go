@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/limiter"
+)
+
+// forcePolicy is a name of the rate limit policy of forced refreshes of all groups.
+const forcePolicy = "force"
+
+// groupPolicy returns a name of the group rate limit policy of regular requests or forced refreshes.
+func groupPolicy(groupName string, force bool) string {
+	if force {
+		return "group:" + groupName + ":force"
+	}
+	return "group:" + groupName
+}
+
+// limiterPolicies returns named rate limit policies of forced refreshes and active groups.
+func limiterPolicies(config *cfg.Config) map[string]limiter.Policy {
+	var (
+		policies = make(map[string]limiter.Policy)
+		add      = func(name string, p *cfg.RatePolicy) {
+			if p != nil {
+				policies[name] = limiter.Policy{Rate: p.Rate, Burst: p.Burst, Interval: p.Interval.Timed()}
+			}
+		}
+	)
+
+	add(forcePolicy, config.Limiter.Force)
+
+	for _, group := range config.ActiveGroups() {
+		add(groupPolicy(group.Name, false), group.Limit)
+		add(groupPolicy(group.Name, true), group.ForceLimit)
+	}
+
+	return policies
+}
+
+// ratePolicies chooses rate limit policies of requests by groups' endpoints and forced refreshes.
+type ratePolicies struct {
+	groups map[string]*cfg.Group // by endpoints
+	force  bool                  // forced refreshes of all groups have a policy
+}
+
+// newRatePolicies returns rate limit policies of the configuration.
+func newRatePolicies(config *cfg.Config) *ratePolicies {
+	return &ratePolicies{groups: config.GroupsEndpoints(), force: config.Limiter.Force != nil}
+}
+
+// Name returns a name of the request rate limit policy, it's empty for the default policy.
+// A forced refresh uses the group force limit, the common force limit or a regular policy in this order.
+// A regular group request uses the group limit, other requests use the default policy.
+func (rp *ratePolicies) Name(r *http.Request) string {
+	if rp == nil {
+		return ""
+	}
+
+	group, ok := requestGroup(rp.groups, r.URL.Path)
+	if !ok {
+		return ""
+	}
+
+	if parseBool(r.URL.Query().Get("force")) {
+		switch {
+		case group.ForceLimit != nil:
+			return groupPolicy(group.Name, true)
+		case rp.force:
+			return forcePolicy
+		}
+	}
+
+	if group.Limit != nil {
+		return groupPolicy(group.Name, false)
+	}
+
+	return ""
+}
+
+// lookupGroup returns the group of the path "/{endpoint}" or "/{endpoint}/{token}" and the path token.
+func lookupGroup(groups map[string]*cfg.Group, path string) (*cfg.Group, string, bool) {
+	url := strings.Trim(path, "/ ")
+
+	if group, ok := groups[url]; ok {
+		return group, "", true
+	}
+
+	if i := strings.LastIndexByte(url, '/'); i > 0 {
+		group, ok := groups[url[:i]]
+		return group, url[i+1:], ok
+	}
+
+	return nil, "", false
+}
+
+// requestGroup returns the group of a group or user's personal endpoint path.
+func requestGroup(groups map[string]*cfg.Group, path string) (*cfg.Group, bool) {
+	if path, ok := strings.CutPrefix(path, usersPrefix); ok {
+		_, endpoint, _ := strings.Cut(path, "/")
+		group, exists := groups[strings.Trim(endpoint, "/ ")]
+		return group, exists
+	}
+
+	group, _, ok := lookupGroup(groups, path)
+	return group, ok
+}
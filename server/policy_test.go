@@ -0,0 +1,142 @@
+package server
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/limiter"
+)
+
+// policiesConfig returns a configuration with rate limit policies of forced refreshes and groups.
+func policiesConfig() *cfg.Config {
+	return &cfg.Config{
+		Limiter: cfg.LimitOptions{
+			Rate:     10,
+			Burst:    10,
+			Interval: cfg.Duration(time.Minute),
+			Force:    &cfg.RatePolicy{Rate: 1, Burst: 1, Interval: cfg.Duration(10 * time.Minute)},
+		},
+		Groups: []cfg.Group{
+			{Name: "group1", Endpoint: "/group1"},
+			{
+				Name:       "group2",
+				Endpoint:   "/group2",
+				Limit:      &cfg.RatePolicy{Rate: 5, Burst: 5, Interval: cfg.Duration(time.Minute)},
+				ForceLimit: &cfg.RatePolicy{Rate: 2, Burst: 2, Interval: cfg.Duration(time.Hour)},
+			},
+			{
+				Name:     "group3",
+				Endpoint: "/group3",
+				Disabled: true,
+				Limit:    &cfg.RatePolicy{Rate: 5, Burst: 5, Interval: cfg.Duration(time.Minute)},
+			},
+		},
+	}
+}
+
+func TestLimiterPolicies(t *testing.T) {
+	expected := map[string]limiter.Policy{
+		forcePolicy:                  {Rate: 1, Burst: 1, Interval: 10 * time.Minute},
+		groupPolicy("group2", false): {Rate: 5, Burst: 5, Interval: time.Minute},
+		groupPolicy("group2", true):  {Rate: 2, Burst: 2, Interval: time.Hour},
+	}
+
+	if policies := limiterPolicies(policiesConfig()); !maps.Equal(policies, expected) {
+		t.Errorf("got %v, want %v", policies, expected)
+	}
+
+	if policies := limiterPolicies(&cfg.Config{}); len(policies) != 0 {
+		t.Errorf("unexpected policies %v", policies)
+	}
+}
+
+func TestRatePolicies_Name(t *testing.T) {
+	config := policiesConfig()
+	rp := newRatePolicies(config)
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{name: "health check", path: "/ok"},
+		{name: "regular without group limit", path: "/group1"},
+		{name: "force without group limit", path: "/group1?force=true", expected: forcePolicy},
+		{name: "force false", path: "/group1?force=false"},
+		{name: "regular with group limit", path: "/group2", expected: "group:group2"},
+		{name: "path token", path: "/group2/token12345", expected: "group:group2"},
+		{name: "force with group limit", path: "/group2/?force=1", expected: "group:group2:force"},
+		{name: "user endpoint", path: "/u/token12345/group2?force=true", expected: "group:group2:force"},
+		{name: "user unknown endpoint", path: "/u/token12345/unknown?force=true"},
+		{name: "disabled group", path: "/group3"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+
+			if name := rp.Name(r); name != tc.expected {
+				t.Errorf("got policy %q, want %q", name, tc.expected)
+			}
+		})
+	}
+
+	config.Limiter.Force = nil
+	r := httptest.NewRequest(http.MethodGet, "/group1?force=true", nil)
+
+	if name := newRatePolicies(config).Name(r); name != "" {
+		t.Errorf("got policy %q without force limit", name)
+	}
+
+	var empty *ratePolicies
+	if name := empty.Name(r); name != "" {
+		t.Errorf("got policy %q without policies", name)
+	}
+}
+
+func TestRateLimiterMiddleware_Policies(t *testing.T) {
+	var (
+		config    = policiesConfig()
+		rp        = newRatePolicies(config)
+		ipLimiter = limiter.NewIPRateLimiter(
+			config.Limiter.Rate, config.Limiter.Burst, config.Limiter.Interval.Timed(), nil,
+			limiter.WithPolicies(limiterPolicies(config)),
+		)
+		handler = RateLimiterMiddleware(
+			http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }),
+			ipLimiter,
+			rp.Name,
+		)
+	)
+
+	tests := []struct {
+		path    string
+		allowed int
+	}{
+		{path: "/group1?force=true", allowed: 1},
+		{path: "/group2?force=true", allowed: 2},
+		{path: "/group2", allowed: 5},
+		{path: "/group1", allowed: 10},
+	}
+
+	for _, tc := range tests {
+		var allowed int
+
+		for range 12 {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code == http.StatusOK {
+				allowed++
+			}
+		}
+
+		if allowed != tc.allowed {
+			t.Errorf("path %q: allowed %d requests, want %d", tc.path, allowed, tc.allowed)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/crawler"
+	"github.com/z0rr0/smerge/limiter"
+)
+
+// reloadableHandler is a handler which can be replaced without a restart.
+type reloadableHandler struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+// newReloadableHandler creates a new reloadable handler with the initial handler.
+func newReloadableHandler(handler http.Handler) *reloadableHandler {
+	rh := &reloadableHandler{}
+	rh.Store(handler)
+	return rh
+}
+
+// Store replaces the current handler.
+func (rh *reloadableHandler) Store(handler http.Handler) {
+	rh.handler.Store(&handler)
+}
+
+// ServeHTTP passes the request to the current handler.
+func (rh *reloadableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*rh.handler.Load()).ServeHTTP(w, r)
+}
+
+// buildGroupsHandler returns a handler of groups, users, admin API on the main listener, metrics and health checks.
+func buildGroupsHandler(config *cfg.Config, cr *crawler.Crawler, users *userRegistry) http.Handler {
+	groupsEndpoints := config.GroupsEndpoints()
+	handler := handleUsers(
+		handleGroup(groupsEndpoints, config.GroupsTokens(), config.FormatRules, cr),
+		groupsEndpoints, users, config.FormatRules, cr,
+	)
+
+	if config.Admin.Enabled() && config.Admin.Listen == "" {
+		handler = handleAdmin(handler, &config.Admin, cr, users, config.GroupsTokens)
+	}
+
+	if config.Metrics.Enabled {
+		handler = handleMetrics(handler, config.Metrics.Path, config.Metrics.Token)
+	}
+
+	return handleHealth(handler, cr, config.Health.StaleFactor)
+}
+
+// restartOptions returns names of changed options, which are applied only after a restart.
+func restartOptions(current, config *cfg.Config) []string {
+	var (
+		names   []string
+		limited = func(c *cfg.Config) bool {
+			return c.Limiter.Rate != 0 && c.Limiter.Burst != 0 || len(limiterPolicies(c)) > 0
+		}
+		checks = []struct {
+			name    string
+			changed bool
+		}{
+			{name: "host/port", changed: current.Addr() != config.Addr()},
+			{
+				name:    "listen",
+				changed: !slices.Equal(current.Listen, config.Listen) || current.SocketMode != config.SocketMode,
+			},
+			{
+				name: "tls",
+				changed: current.TLSCert != config.TLSCert || current.TLSKey != config.TLSKey ||
+					current.TLSMinVersion != config.TLSMinVersion,
+			},
+			{name: "trusted_proxies", changed: !slices.Equal(current.TrustedProxies, config.TrustedProxies)},
+			{name: "timeout", changed: current.Timeout != config.Timeout},
+			{name: "root", changed: current.Root != config.Root},
+			{name: "user_agent", changed: current.UserAgent != config.UserAgent},
+			{name: "retries", changed: current.Retries != config.Retries},
+			{name: "retry", changed: !reflect.DeepEqual(current.Retry, config.Retry)},
+			{name: "breaker", changed: current.Breaker != config.Breaker},
+			{name: "watch", changed: current.Watch != config.Watch},
+			{name: "debug", changed: current.Debug != config.Debug},
+			{name: "log", changed: current.Log != config.Log},
+			{name: "access_log", changed: current.AccessLog != config.AccessLog},
+			{name: "limiter.max_concurrent", changed: current.Limiter.MaxConcurrent != config.Limiter.MaxConcurrent},
+			{name: "limiter.clean_interval", changed: current.Limiter.CleanInterval != config.Limiter.CleanInterval},
+			{name: "limiter.ipv4_prefix", changed: current.Limiter.IPv4Prefix != config.Limiter.IPv4Prefix},
+			{name: "limiter.ipv6_prefix", changed: current.Limiter.IPv6Prefix != config.Limiter.IPv6Prefix},
+			{name: "limiter.max_buckets", changed: current.Limiter.MaxBuckets != config.Limiter.MaxBuckets},
+			{name: "limiter enabled", changed: limited(current) != limited(config)},
+			{name: "admin.listen", changed: current.Admin.Listen != config.Admin.Listen},
+			{
+				name: "admin",
+				changed: current.Admin.Listen != "" &&
+					(current.Admin.Prefix != config.Admin.Prefix || current.Admin.Token != config.Admin.Token ||
+						current.Admin.PublicURL != config.Admin.PublicURL),
+			},
+			{name: "users_stats", changed: current.UsersStats != config.UsersStats},
+		}
+	)
+
+	for _, check := range checks {
+		if check.changed {
+			names = append(names, check.name)
+		}
+	}
+
+	return names
+}
+
+// reloader applies a new configuration to running components.
+type reloader struct {
+	sync.Mutex
+	audit     auditLog
+	config    *cfg.Config // current configuration
+	cr        *crawler.Crawler
+	users     *userRegistry
+	ipLimiter *limiter.IPRateLimiter // nil if rate limiting is disabled
+	groups    *reloadableHandler
+	policies  atomic.Pointer[ratePolicies]
+	endpoints atomic.Pointer[map[string]*cfg.Group] // groups by endpoints to redact logged paths
+}
+
+// current returns the current configuration.
+func (rl *reloader) current() *cfg.Config {
+	rl.Lock()
+	defer rl.Unlock()
+
+	return rl.config
+}
+
+// ratePolicy returns a name of the request rate limit policy of the current configuration.
+func (rl *reloader) ratePolicy(r *http.Request) string {
+	return rl.policies.Load().Name(r)
+}
+
+// storeEndpoints stores groups by endpoints of the configuration.
+func (rl *reloader) storeEndpoints(config *cfg.Config) {
+	endpoints := config.GroupsEndpoints()
+	rl.endpoints.Store(&endpoints)
+}
+
+// redactPath returns the path with hidden access token of the current configuration groups.
+func (rl *reloader) redactPath(path string) string {
+	var groups map[string]*cfg.Group
+	if endpoints := rl.endpoints.Load(); endpoints != nil {
+		groups = *endpoints
+	}
+
+	return redactPath(path, groups)
+}
+
+// Apply applies the new valid configuration: groups, users, group endpoints and rate limiter parameters.
+// Other changed options are logged, they require a restart.
+func (rl *reloader) Apply(config *cfg.Config) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	rl.apply(config)
+}
+
+// apply applies the new configuration, a caller should hold the lock.
+func (rl *reloader) apply(config *cfg.Config) {
+	if names := restartOptions(rl.config, config); len(names) > 0 {
+		slog.Warn("changed options are not applied until restart", "options", names)
+	}
+
+	rl.cr.Reload(config.ActiveGroups())
+	rl.users.Update(config.Users)
+
+	if rl.ipLimiter != nil {
+		// zero rate or burst doesn't limit requests without a named policy
+		limits := &config.Limiter
+		rl.ipLimiter.Update(limits.Rate, limits.Burst, limits.Interval.Timed(), limits.Excluded())
+		rl.ipLimiter.UpdatePolicies(limiterPolicies(config))
+	}
+
+	rl.groups.Store(buildGroupsHandler(config, rl.cr, rl.users))
+	rl.policies.Store(newRatePolicies(config))
+	rl.storeEndpoints(config)
+	rl.config = config
+	slog.Info("configuration reloaded", "file", config.File(), "groups", len(config.Groups), "users", len(config.Users))
+}
+
+// reloadConfig re-reads the configuration file on every signal and applies it,
+// the current configuration is kept if the new one is invalid. It works until the signals channel is closed.
+func reloadConfig(signals <-chan os.Signal, configFile string, apply func(*cfg.Config)) {
+	for range signals {
+		if configFile == "" {
+			slog.Warn("configuration reload skipped, no configuration file")
+			continue
+		}
+
+		config, err := cfg.New(configFile)
+		if err != nil {
+			slog.Error("configuration reload failed, current one is kept", "file", configFile, "error", err)
+			continue
+		}
+
+		apply(config)
+	}
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/crawler"
+	"github.com/z0rr0/smerge/limiter"
+)
+
+// reloadConfigJSON is a configuration template, groups are set by the argument.
+const reloadConfigJSON = `{
+  "host": "localhost",
+  "port": 43210,
+  "user_agent": "TestUserAgent",
+  "timeout": "5s",
+  "root": "/tmp",
+  "retries": 1,
+  "limiter": {"max_concurrent": 2, "rate": 1, "burst": 3, "interval": "1s", "clean_interval": "1m"},
+  "groups": %s
+}`
+
+// waitStatus waits the expected status code of the handler request.
+func waitStatus(handler http.Handler, path string, expected int) int {
+	var code int
+
+	for range 100 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if code = w.Code; code == expected {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return code
+}
+
+func TestReloader_Apply(t *testing.T) {
+	var (
+		configFile = filepath.Join(t.TempDir(), "config.json")
+		group1     = `{"name": "group1", "endpoint": "/group1", "period": "1h", "static": ["ss://a"]}`
+		group2     = `{"name": "group2", "endpoint": "/group2", "period": "1h", "static": ["ss://b"]}`
+		write      = func(groups string) {
+			data := []byte(fmt.Sprintf(reloadConfigJSON, groups))
+			if err := os.WriteFile(configFile, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	)
+
+	write("[" + group1 + "]")
+	config, err := cfg.New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cr := crawler.New(config.Groups, config.UserAgent, config.Retries, 2, config.Root)
+	cr.Run()
+	defer cr.Shutdown()
+
+	var (
+		users     = newUserRegistry(nil, "", "")
+		ipLimiter = limiter.NewIPRateLimiter(1, 1, time.Second, nil)
+		groups    = newReloadableHandler(buildGroupsHandler(config, cr, users))
+		rl        = &reloader{config: config, cr: cr, users: users, ipLimiter: ipLimiter, groups: groups}
+		signals   = make(chan os.Signal)
+		done      = make(chan struct{})
+	)
+
+	go func() {
+		reloadConfig(signals, configFile, rl.Apply)
+		close(done)
+	}()
+
+	if code := waitStatus(groups, "/group1", http.StatusOK); code != http.StatusOK {
+		t.Fatalf("group1 status %d", code)
+	}
+
+	// invalid configuration is not applied
+	write(`[{"name": "group2"}]`)
+	signals <- syscall.SIGHUP
+
+	write("[" + group2 + "]")
+	signals <- syscall.SIGHUP
+	close(signals)
+	<-done
+
+	if code := waitStatus(groups, "/group2", http.StatusOK); code != http.StatusOK {
+		t.Errorf("group2 status %d", code)
+	}
+
+	if code := waitStatus(groups, "/group1", http.StatusNotFound); code != http.StatusNotFound {
+		t.Errorf("removed group1 status %d", code)
+	}
+
+	if rl.config.Groups[0].Name != "group2" {
+		t.Errorf("unexpected current config groups: %+v", rl.config.Groups)
+	}
+
+	bucket := ipLimiter.GetBucket("127.0.0.1")
+	for i := range 4 {
+		if allowed := bucket.Allow(); allowed != (i < 3) {
+			t.Errorf("request %d: allowed = %v, limiter burst is not updated", i, allowed)
+		}
+	}
+}
+
+func TestReloader_ApplyUnlimited(t *testing.T) {
+	const groupsJSON = `[{"name": "group1", "endpoint": "/group1", "period": "1h", "static": ["ss://a"],
+		"limit": {"rate": 1, "burst": 1, "interval": "1h"}}]`
+
+	var (
+		configFile = filepath.Join(t.TempDir(), "config.json")
+		data       = fmt.Sprintf(reloadConfigJSON, groupsJSON)
+	)
+
+	// the default rate limit is disabled
+	data = strings.Replace(data, `"rate": 1, "burst": 3`, `"rate": 0, "burst": 0`, 1)
+	if err := os.WriteFile(configFile, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := cfg.New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cr := crawler.New(config.Groups, config.UserAgent, config.Retries, 2, config.Root)
+	defer cr.Shutdown()
+
+	var (
+		users     = newUserRegistry(nil, "", "")
+		ipLimiter = limiter.NewIPRateLimiter(1, 1, time.Hour, nil)
+		groups    = newReloadableHandler(buildGroupsHandler(config, cr, users))
+		rl        = &reloader{config: config, cr: cr, users: users, ipLimiter: ipLimiter, groups: groups}
+	)
+
+	// the limiter exists due to the group policy, zero default rate disables limits of other requests
+	rl.Apply(config)
+	bucket := ipLimiter.GetBucket("127.0.0.1")
+
+	for i := range 3 {
+		if !bucket.Allow() {
+			t.Errorf("request %d is limited, default rate is not updated", i)
+		}
+	}
+
+	bucket = ipLimiter.GetPolicyBucket(groupPolicy("group1", false), "127.0.0.1")
+	for i := range 2 {
+		if allowed := bucket.Allow(); allowed != (i == 0) {
+			t.Errorf("group request %d: allowed = %v", i, allowed)
+		}
+	}
+}
+
+func TestReloadConfig_NoFile(t *testing.T) {
+	signals := make(chan os.Signal, 1)
+	signals <- syscall.SIGHUP
+	close(signals)
+
+	reloadConfig(signals, "", func(*cfg.Config) {
+		t.Error("unexpected apply without configuration file")
+	})
+}
+
+func TestRestartOptions(t *testing.T) {
+	current := &cfg.Config{
+		Host:    "localhost",
+		Port:    43210,
+		Timeout: cfg.Duration(time.Second),
+		Limiter: cfg.LimitOptions{MaxConcurrent: 1, Rate: 1, Burst: 1},
+		Admin:   cfg.AdminOptions{Listen: "localhost:43211", Prefix: "/admin"},
+	}
+
+	testCases := []struct {
+		name     string
+		change   func(c *cfg.Config)
+		expected []string
+	}{
+		{name: "no changes", change: func(*cfg.Config) {}},
+		{name: "groups", change: func(c *cfg.Config) { c.Groups = []cfg.Group{{Name: "group1"}} }},
+		{name: "limiter rate", change: func(c *cfg.Config) { c.Limiter.Rate = 2 }},
+		{name: "port", change: func(c *cfg.Config) { c.Port = 43212 }, expected: []string{"host/port"}},
+		{
+			name:     "listen",
+			change:   func(c *cfg.Config) { c.Listen = []string{"unix:/tmp/smerge.sock"} },
+			expected: []string{"listen"},
+		},
+		{
+			name:     "limiter disabled",
+			change:   func(c *cfg.Config) { c.Limiter.Burst, c.Limiter.MaxConcurrent = 0, 2 },
+			expected: []string{"limiter.max_concurrent", "limiter enabled"},
+		},
+		{name: "admin token", change: func(c *cfg.Config) { c.Admin.Token = "admin12345" }, expected: []string{"admin"}},
+		{name: "retry", change: func(c *cfg.Config) { c.Retry.Statuses = []int{500} }, expected: []string{"retry"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := *current
+			tc.change(&config)
+
+			if names := restartOptions(current, &config); !slices.Equal(names, tc.expected) {
+				t.Errorf("restart options = %v, want %v", names, tc.expected)
+			}
+		})
+	}
+}
@@ -2,11 +2,15 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/z0rr0/smerge/cfg"
@@ -14,10 +18,14 @@ import (
 	"github.com/z0rr0/smerge/limiter"
 )
 
+// usersStatsInterval is a period of users' statistics saving.
+const usersStatsInterval = time.Minute
+
 func runLimiter(ctx context.Context, config *cfg.Config) (*limiter.IPRateLimiter, chan struct{}) {
 	const noRate = 0.0
 
-	if config.Limiter.Rate == noRate || config.Limiter.Burst == noRate {
+	policies := limiterPolicies(config)
+	if (config.Limiter.Rate == noRate || config.Limiter.Burst == noRate) && len(policies) == 0 {
 		slog.Info("IP rate limiting disabled")
 		done := make(chan struct{})
 		close(done)
@@ -25,50 +33,209 @@ func runLimiter(ctx context.Context, config *cfg.Config) (*limiter.IPRateLimiter
 	}
 
 	interval := config.Limiter.Interval.Timed()
-	excluded := config.Limiter.ExcludedIPS()
+	excluded := config.Limiter.Excluded()
 
-	ipLimiter := limiter.NewIPRateLimiter(config.Limiter.Rate, config.Limiter.Burst, interval, excluded)
+	ipLimiter := limiter.NewIPRateLimiter(
+		config.Limiter.Rate, config.Limiter.Burst, interval, excluded,
+		limiter.WithKeyPrefix(int(config.Limiter.IPv4Prefix), int(config.Limiter.IPv6Prefix)),
+		limiter.WithMaxBuckets(int(config.Limiter.MaxBuckets)),
+		limiter.WithPolicies(policies),
+	)
 	interval = config.Limiter.CleanInterval.Timed()
+	limiterBuckets.Set(func() float64 { return float64(ipLimiter.Len()) })
 
 	return ipLimiter, ipLimiter.Cleanup(ctx, interval, interval)
 }
 
-func Run(config *cfg.Config, versionInfo string, signals ...os.Signal) {
+// newServer creates a new HTTP server with common timeouts.
+func newServer(addr string, handler http.Handler, timeout time.Duration) *http.Server {
+	return &http.Server{
+		Addr:           addr,
+		Handler:        handler,
+		ReadTimeout:    timeout,
+		WriteTimeout:   timeout,
+		MaxHeaderBytes: 1 << 16, // 64Kb
+	}
+}
+
+// serve accepts connections of the listener with HTTPS if it's enabled.
+func serve(srv *http.Server, ln net.Listener, tlsEnabled bool) error {
+	if tlsEnabled {
+		// certificate is provided by TLSConfig.GetCertificate
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.Serve(ln)
+}
+
+// serveAll serves all listeners in separate goroutines, onError is called after a failure of any of them.
+// HTTPS is used if the server has a TLS configuration, it's checked before serving,
+// because http.Server sets a default one for HTTP/2.
+// The returned wait group is done when all listeners are closed.
+func serveAll(srv *http.Server, listeners []net.Listener, name string, onError func()) *sync.WaitGroup {
 	var (
-		serverTimeout   = time.Duration(config.Timeout)
-		serverAddr      = config.Addr()
-		groupsEndpoints = config.GroupsEndpoints()
+		wg         sync.WaitGroup
+		tlsEnabled = srv.TLSConfig != nil
+	)
+
+	for _, ln := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slog.Info("starting "+name, "addr", ln.Addr().String(), "network", ln.Addr().Network(), "tls", tlsEnabled)
+			if err := serve(srv, ln, tlsEnabled); !errors.Is(err, http.ErrServerClosed) {
+				slog.Error(name+" Serve error", "addr", ln.Addr().String(), "error", err)
+				onError()
+			}
+		}()
+	}
+
+	return &wg
+}
+
+// openListeners returns listeners of the main and admin servers, including sockets of systemd activation.
+func openListeners(config *cfg.Config) ([]net.Listener, []net.Listener, error) {
+	sockets, err := systemdSockets()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listeners, err := listenAll(config.Listeners(), config.SocketFileMode(), sockets)
+	if err != nil {
+		return nil, nil, errors.Join(err, sockets.Close())
+	}
+
+	var adminListeners []net.Listener
+	if config.Admin.Listen != "" {
+		if adminListeners, err = listen(config.Admin.Listen, config.SocketFileMode(), sockets); err != nil {
+			return nil, nil, errors.Join(err, closeListeners(listeners), sockets.Close())
+		}
+	}
+
+	if err = sockets.Close(); err != nil {
+		slog.Warn("failed to close unused systemd sockets", "error", err)
+	}
+
+	return listeners, adminListeners, nil
+}
+
+// runAdminServer starts the admin API server on its separate listeners.
+// It returns nil if the admin API is disabled or served by the main listener.
+func runAdminServer(
+	config *cfg.Config, sg StatusGetter, users *userRegistry, rl *reloader, listeners []net.Listener, al *accessLogger,
+) (*http.Server, *sync.WaitGroup) {
+	if len(listeners) == 0 {
+		return nil, &sync.WaitGroup{}
+	}
+
+	handler := ClientIPMiddleware(
+		LoggingMiddleware(
+			ErrorHandlingMiddleware(
+				handleRefresh(
+					handleManage(
+						ValidationMiddleware(
+							handleAdmin(http.NotFoundHandler(), &config.Admin, sg, users, func() map[string][]string {
+								return rl.current().GroupsTokens()
+							}),
+						),
+						rl,
+					),
+					rl,
+				),
+			),
+			al,
+			nil,
+		),
+		config.Proxies(),
+		config.UnixTrusted(),
 	)
+	srv := newServer(config.Admin.Listen, handler, config.Timeout.Timed())
+	slog.Info("admin API prefix", "prefix", config.Admin.Prefix)
+
+	return srv, serveAll(srv, listeners, "admin HTTP server", func() {})
+}
+
+func Run(config *cfg.Config, versionInfo string, signals ...os.Signal) {
+	serverTimeout := time.Duration(config.Timeout)
+
+	var tlsConfig *tls.Config
+	if config.TLSEnabled() {
+		var err error
+		if tlsConfig, err = newTLSConfig(config); err != nil {
+			slog.Error("TLS configuration error", "error", err)
+			return
+		}
+	}
+
+	al, err := newAccessLogger(&config.AccessLog)
+	if err != nil {
+		slog.Error("access log error", "error", err)
+		return
+	}
+	defer func() {
+		if closeErr := al.Close(); closeErr != nil {
+			slog.Error("access log close error", "error", closeErr)
+		}
+	}()
+
+	// listeners are opened before the crawler to fail fast, they accept connections before the first fetches,
+	// so group requests fail until groups have results, the readiness check reports it
+	listeners, adminListeners, err := openListeners(config)
+	if err != nil {
+		slog.Error("listen error", "error", err)
+		return
+	}
 
 	limiterCtx, limiterCancel := context.WithCancel(context.Background())
 	ipLimiter, limiterDone := runLimiter(limiterCtx, config)
 	activeLimiter := ipLimiter != nil
 
 	slog.Info("starting crawler", "groups", len(config.Groups))
-	cr := crawler.New(config.Groups, config.UserAgent, config.Retries, int(config.Limiter.MaxConcurrent), config.Root)
+	cr := crawler.New(
+		config.ActiveGroups(),
+		config.UserAgent,
+		config.Retries,
+		int(config.Limiter.MaxConcurrent),
+		config.Root,
+		crawler.WithRetryOptions(config.Retry),
+		crawler.WithBreakerOptions(config.Breaker),
+		crawler.WithWatchOptions(config.Watch),
+	)
 	cr.Run()
 
-	handler := LoggingMiddleware(
-		ErrorHandlingMiddleware(
-			RateLimiterMiddleware(
-				ValidationMiddleware(
-					HealthCheckMiddleware(
-						handleGroup(groupsEndpoints, cr),
-						versionInfo,
-					),
-				),
-				ipLimiter,
+	usersCtx, usersCancel := context.WithCancel(context.Background())
+	users := newUserRegistry(config.Users, config.Root, config.UsersStats)
+	usersDone := users.Persist(usersCtx, usersStatsInterval)
+
+	groupsHandler := newReloadableHandler(buildGroupsHandler(config, cr, users))
+	rl := &reloader{config: config, cr: cr, users: users, ipLimiter: ipLimiter, groups: groupsHandler}
+	rl.policies.Store(newRatePolicies(config))
+	rl.storeEndpoints(config)
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go reloadConfig(reload, config.File(), rl.Apply)
+
+	var mainHandler http.Handler = ValidationMiddleware(HealthCheckMiddleware(groupsHandler, versionInfo))
+	if config.Admin.Listen == "" {
+		// the management API and the refresh accept other methods, so they're before the validation
+		mainHandler = handleRefresh(handleManage(mainHandler, rl), rl)
+	}
+
+	handler := ClientIPMiddleware(
+		LoggingMiddleware(
+			ErrorHandlingMiddleware(
+				RateLimiterMiddleware(mainHandler, ipLimiter, rl.ratePolicy),
 			),
+			al,
+			rl.redactPath,
 		),
+		config.Proxies(),
+		config.UnixTrusted(),
 	)
 
-	srv := &http.Server{
-		Addr:           serverAddr,
-		Handler:        handler,
-		ReadTimeout:    serverTimeout,
-		WriteTimeout:   serverTimeout,
-		MaxHeaderBytes: 1 << 16, // 64Kb
-	}
+	srv := newServer(config.Addr(), handler, serverTimeout)
+	srv.TLSConfig = tlsConfig
+	adminSrv, adminServing := runAdminServer(config, cr, users, rl, adminListeners, al)
 	serverStopped := make(chan struct{})
 
 	sigint := make(chan os.Signal, 1)
@@ -87,18 +254,34 @@ func Run(config *cfg.Config, versionInfo string, signals ...os.Signal) {
 		if err := srv.Shutdown(shutdownCtx); err != nil {
 			slog.Error("HTTP server shutdown error", "error", err)
 		}
+
+		if adminSrv != nil {
+			if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+				slog.Error("admin HTTP server shutdown error", "error", err)
+			}
+		}
 		close(serverStopped)
 	}()
 
-	slog.Info("starting server", "addr", serverAddr)
-	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-		slog.Error("HTTP server ListenAndServe error", "error", err)
-		sigint <- os.Interrupt
-	}
+	serving := serveAll(srv, listeners, "HTTP server", func() {
+		select {
+		case sigint <- os.Interrupt:
+		default:
+			// the shutdown is already requested
+		}
+	})
 
 	<-serverStopped
+	serving.Wait()
+	adminServing.Wait()
 	slog.Info("HTTP server stopped")
 
+	signal.Stop(reload)
+	close(reload)
+
+	usersCancel()
+	<-usersDone
+
 	limiterCancel()
 	<-limiterDone
 	slog.Info("IP rate limiter shutdown complete", "activated", activeLimiter)
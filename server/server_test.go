@@ -36,6 +36,26 @@ func waitForServerReady(address string, timeout time.Duration) error {
 	return fmt.Errorf("server did not start within %s", timeout)
 }
 
+// waitForReady waits for the readiness check success, so all groups have results.
+// The listener accepts connections before the first fetches are completed.
+func waitForReady(client *http.Client, baseURL string, timeout time.Duration) error {
+	const step = 10 * time.Millisecond
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		resp, err := client.Get(baseURL + readyPath)
+		if err == nil {
+			_ = resp.Body.Close()
+
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		time.Sleep(step)
+	}
+	return fmt.Errorf("server is not ready within %s", timeout)
+}
+
 func TestRun(t *testing.T) {
 	subsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if _, err := w.Write([]byte("line1\nline2")); err != nil {
@@ -57,6 +77,8 @@ func TestRun(t *testing.T) {
 			Interval:      cfg.Duration(time.Second),
 			CleanInterval: cfg.Duration(time.Minute),
 		},
+		Admin:   cfg.AdminOptions{Prefix: "/admin", Token: "admin12345"},
+		Metrics: cfg.MetricsOptions{Enabled: true, Path: "/metrics"},
 		Groups: []cfg.Group{
 			{
 				Name:     "test1",
@@ -83,6 +105,10 @@ func TestRun(t *testing.T) {
 		Timeout: time.Second,
 	}
 
+	if err := waitForReady(client, fmt.Sprintf("http://%s", config.Addr()), startTime); err != nil {
+		t.Fatal(err)
+	}
+
 	tests := []struct {
 		name           string
 		path           string
@@ -113,6 +139,24 @@ func TestRun(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectBody:     true,
 		},
+		{
+			name:           "metrics",
+			path:           "/metrics",
+			expectedStatus: http.StatusOK,
+			expectBody:     true,
+		},
+		{
+			name:           "admin without token",
+			path:           "/admin/status",
+			expectedStatus: http.StatusNotFound,
+			expectBody:     true,
+		},
+		{
+			name:           "admin status",
+			path:           "/admin/status?token=admin12345",
+			expectedStatus: http.StatusOK,
+			expectBody:     true,
+		},
 	}
 
 	baseURL := fmt.Sprintf("http://%s", config.Addr())
@@ -211,6 +255,10 @@ func TestRunWithoutRateLimit(t *testing.T) {
 	client := &http.Client{Timeout: time.Second}
 	clientURL := fmt.Sprintf("http://%s/test1/", config.Addr())
 
+	if err := waitForReady(client, fmt.Sprintf("http://%s", config.Addr()), startTime); err != nil {
+		t.Fatal(err)
+	}
+
 	resp, err := client.Get(clientURL)
 	if err != nil {
 		t.Fatalf("failed to make request: %v", err)
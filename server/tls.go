@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+// certCheckInterval is a minimal interval between checks of certificate files changes.
+const certCheckInterval = 10 * time.Second
+
+// certReloader keeps the TLS certificate and reloads it after changes of its files,
+// so renewed certificates are used without a restart.
+type certReloader struct {
+	sync.Mutex
+	certFile      string
+	keyFile       string
+	checkInterval time.Duration
+	cert          *tls.Certificate
+	modTime       time.Time // latest modification time of the loaded files
+	checked       time.Time // time of the last files check
+}
+
+// newCertReloader loads the certificate and returns a new certificate reloader.
+func newCertReloader(certFile, keyFile string, checkInterval time.Duration) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile, checkInterval: checkInterval}
+
+	modTime, err := cr.modified()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cr.load(modTime); err != nil {
+		return nil, err
+	}
+
+	cr.checked = time.Now()
+	return cr, nil
+}
+
+// modified returns the latest modification time of the certificate and key files.
+func (cr *certReloader) modified() (time.Time, error) {
+	var modTime time.Time
+
+	for _, name := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("stat TLS file: %w", err)
+		}
+
+		if t := info.ModTime(); t.After(modTime) {
+			modTime = t
+		}
+	}
+
+	return modTime, nil
+}
+
+// load reads the certificate and key files.
+func (cr *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+
+	cr.cert, cr.modTime = &cert, modTime
+	return nil
+}
+
+// reload loads the certificate again if its files are changed, the current one is kept on errors.
+// A caller should hold the lock.
+func (cr *certReloader) reload() {
+	modTime, err := cr.modified()
+	if err != nil {
+		slog.Error("TLS certificate check failed, current one is kept", "error", err)
+		return
+	}
+
+	if modTime.Equal(cr.modTime) {
+		return
+	}
+
+	if err = cr.load(modTime); err != nil {
+		slog.Error("TLS certificate reload failed, current one is kept", "error", err)
+		return
+	}
+
+	slog.Info("TLS certificate reloaded", "cert", cr.certFile, "key", cr.keyFile)
+}
+
+// GetCertificate returns the current certificate, its files are checked not often than the check interval.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.Lock()
+	defer cr.Unlock()
+
+	if now := time.Now(); now.Sub(cr.checked) >= cr.checkInterval {
+		cr.checked = now
+		cr.reload()
+	}
+
+	return cr.cert, nil
+}
+
+// newTLSConfig returns a TLS configuration of the main listener with the reloadable certificate.
+func newTLSConfig(config *cfg.Config) (*tls.Config, error) {
+	cr, err := newCertReloader(config.TLSCert, config.TLSKey, certCheckInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{MinVersion: config.MinTLSVersion(), GetCertificate: cr.GetCertificate}, nil
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+// writeTestCert writes a self-signed certificate for localhost with the common name and its key,
+// it returns the certificate in PEM format.
+func writeTestCert(t *testing.T, certFile, keyFile, commonName string) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err = os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certPEM
+}
+
+// certCommonName returns the common name of the certificate leaf.
+func certCommonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+// touch sets the modification time of the files.
+func touch(t *testing.T, modTime time.Time, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		certFile = filepath.Join(dir, "cert.pem")
+		keyFile  = filepath.Join(dir, "key.pem")
+		now      = time.Now()
+	)
+
+	if _, err := newCertReloader(certFile, keyFile, 0); err == nil {
+		t.Error("expected error for missing files")
+	}
+
+	writeTestCert(t, certFile, keyFile, "first")
+	touch(t, now.Add(-time.Hour), certFile, keyFile)
+
+	cr, err := newCertReloader(certFile, keyFile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := cr.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name := certCommonName(t, cert); name != "first" {
+		t.Errorf("got certificate %q, want first", name)
+	}
+
+	// renewed certificate
+	writeTestCert(t, certFile, keyFile, "second")
+	touch(t, now.Add(-time.Minute), certFile, keyFile)
+
+	if cert, err = cr.GetCertificate(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if name := certCommonName(t, cert); name != "second" {
+		t.Errorf("got certificate %q, want second", name)
+	}
+
+	// invalid files, the current certificate is kept
+	if err = os.WriteFile(keyFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, now, keyFile)
+
+	if cert, err = cr.GetCertificate(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if name := certCommonName(t, cert); name != "second" {
+		t.Errorf("got certificate %q, want second", name)
+	}
+
+	// files are not checked until the interval is passed
+	cr.checkInterval = time.Hour
+	writeTestCert(t, certFile, keyFile, "third")
+	touch(t, now.Add(time.Minute), certFile, keyFile)
+
+	if cert, err = cr.GetCertificate(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if name := certCommonName(t, cert); name != "second" {
+		t.Errorf("got certificate %q, want second", name)
+	}
+}
+
+func TestRunTLS(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		certFile = filepath.Join(dir, "cert.pem")
+		keyFile  = filepath.Join(dir, "key.pem")
+		certPEM  = writeTestCert(t, certFile, keyFile, "localhost")
+		pool     = x509.NewCertPool()
+	)
+
+	if !pool.AppendCertsFromPEM(certPEM) {
+		t.Fatal("failed to add certificate to pool")
+	}
+
+	config := &cfg.Config{
+		Host:          "localhost",
+		Port:          43210,
+		TLSCert:       certFile,
+		TLSKey:        keyFile,
+		TLSMinVersion: "1.3",
+		Timeout:       cfg.Duration(time.Second), // TLS handshake is slow with the race detector
+		UserAgent:     "TestUserAgent",
+		Retries:       3,
+		Limiter:       cfg.LimitOptions{MaxConcurrent: 2},
+		Groups: []cfg.Group{
+			{Name: "test1", Endpoint: "/test1", Period: cfg.Duration(time.Hour), Static: []string{"ss://a"}},
+		},
+	}
+
+	serverDone := make(chan struct{})
+	go func() {
+		Run(config, "test version", testSignal)
+		close(serverDone)
+	}()
+	if err := waitForServerReady(config.Addr(), startTime); err != nil {
+		t.Fatalf("server did not start: %v", err)
+	}
+
+	clientURL := fmt.Sprintf("https://%s/test1", config.Addr())
+	client := &http.Client{
+		Timeout:   time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+
+	if err := waitForReady(client, fmt.Sprintf("https://%s", config.Addr()), startTime); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Get(clientURL)
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+
+	if err = resp.Body.Close(); err != nil {
+		t.Errorf("failed to close response body: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil || resp.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("unexpected response status %d, TLS %+v", resp.StatusCode, resp.TLS)
+	}
+
+	// the minimum TLS version is 1.3
+	oldClient := &http.Client{
+		Timeout: time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, MaxVersion: tls.VersionTLS12},
+		},
+	}
+
+	if resp, err = oldClient.Get(clientURL); err == nil {
+		_ = resp.Body.Close()
+		t.Error("expected handshake error for TLS 1.2 client")
+	}
+
+	proc, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("failed to find current process: %v", err)
+	}
+
+	if err = proc.Signal(testSignal); err != nil {
+		t.Fatalf("failed to send signal: %v", err)
+	}
+
+	select {
+	case <-serverDone:
+		// server stopped successfully
+	case <-time.After(5 * time.Second):
+		t.Error("server didn't stop within timeout")
+	}
+}
+
+func TestRunTLS_InvalidCertificate(t *testing.T) {
+	config := &cfg.Config{
+		Host:    "localhost",
+		Port:    43210,
+		TLSCert: filepath.Join(t.TempDir(), "cert.pem"),
+		TLSKey:  filepath.Join(t.TempDir(), "key.pem"),
+	}
+
+	serverDone := make(chan struct{})
+	go func() {
+		Run(config, "test version", testSignal)
+		close(serverDone)
+	}()
+
+	select {
+	case <-serverDone:
+		// server is not started
+	case <-time.After(time.Second):
+		t.Error("server didn't stop within timeout")
+	}
+}
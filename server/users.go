@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+// usersPrefix is a path prefix of users' personal endpoints.
+const usersPrefix = "/u/"
+
+// UserStats is a usage statistics of a user.
+type UserStats struct {
+	Requests uint64    `json:"requests"`
+	LastSeen time.Time `json:"last_seen,omitzero"`
+	LastIP   string    `json:"last_ip,omitempty"`
+}
+
+// userRegistry is a thread-safe set of users with their usage statistics.
+// Users are searched by hashes of their tokens, so tokens are not compared directly.
+type userRegistry struct {
+	sync.RWMutex
+	users   map[[sha256.Size]byte]cfg.User
+	stats   map[string]UserStats // by users' names
+	file    string               // statistics file, empty value disables persistence
+	changed bool                 // statistics were changed after the last saving
+}
+
+// newUserRegistry creates a new users registry.
+// The statistics file is relative to the root directory, it's not used without root,
+// users can be added by a configuration reload, so it doesn't depend on them.
+func newUserRegistry(users []cfg.User, root, statsFile string) *userRegistry {
+	ur := &userRegistry{stats: make(map[string]UserStats, len(users))}
+
+	if root != "" && statsFile != "" {
+		ur.file = filepath.Join(root, statsFile)
+	}
+
+	ur.Update(users)
+	return ur
+}
+
+// Update replaces all users, statistics of removed users are kept.
+func (ur *userRegistry) Update(users []cfg.User) {
+	byToken := make(map[[sha256.Size]byte]cfg.User, len(users))
+	for _, user := range users {
+		byToken[sha256.Sum256([]byte(user.Token))] = user
+	}
+
+	ur.Lock()
+	ur.users = byToken
+	ur.Unlock()
+
+	slog.Info("users updated", "count", len(users))
+}
+
+// Lookup returns a user by the token.
+func (ur *userRegistry) Lookup(token string) (cfg.User, bool) {
+	if token == "" {
+		return cfg.User{}, false
+	}
+
+	ur.RLock()
+	defer ur.RUnlock()
+
+	user, ok := ur.users[sha256.Sum256([]byte(token))]
+	return user, ok
+}
+
+// Visit updates the user statistics of a request.
+func (ur *userRegistry) Visit(name, ip string, now time.Time) {
+	ur.Lock()
+	defer ur.Unlock()
+
+	stats := ur.stats[name]
+	stats.Requests++
+	stats.LastSeen = now
+	stats.LastIP = ip
+
+	ur.stats[name] = stats
+	ur.changed = true
+}
+
+// Stats returns a copy of users' statistics.
+func (ur *userRegistry) Stats() map[string]UserStats {
+	ur.RLock()
+	defer ur.RUnlock()
+
+	return maps.Clone(ur.stats)
+}
+
+// load reads users' statistics from the file, a missing file is not an error.
+func (ur *userRegistry) load() error {
+	data, err := os.ReadFile(ur.file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read users stats: %w", err)
+	}
+
+	stats := make(map[string]UserStats)
+	if err = json.Unmarshal(data, &stats); err != nil {
+		return fmt.Errorf("unmarshal users stats: %w", err)
+	}
+
+	ur.Lock()
+	ur.stats = stats
+	ur.Unlock()
+
+	return nil
+}
+
+// save writes users' statistics to the file if they were changed.
+// A temporary file is renamed to the target one, so the file is never partially written.
+func (ur *userRegistry) save() error {
+	ur.Lock()
+	if !ur.changed {
+		ur.Unlock()
+		return nil
+	}
+
+	data, err := json.Marshal(ur.stats)
+	ur.changed = false
+	ur.Unlock()
+
+	if err == nil {
+		err = writeFileAtomic(ur.file, data)
+	}
+
+	if err != nil {
+		ur.Lock()
+		ur.changed = true // try again next time
+		ur.Unlock()
+		return fmt.Errorf("save users stats: %w", err)
+	}
+
+	return nil
+}
+
+// Persist loads users' statistics and saves them with the interval and when the context is done.
+// The returned channel is closed after the final saving.
+func (ur *userRegistry) Persist(ctx context.Context, interval time.Duration) chan struct{} {
+	done := make(chan struct{})
+
+	if ur.file == "" {
+		slog.Info("users stats persistence disabled")
+		close(done)
+		return done
+	}
+
+	if err := ur.load(); err != nil {
+		slog.Error("failed to load users stats", "file", ur.file, "error", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer func() {
+			ticker.Stop()
+			close(done)
+		}()
+
+		slog.Info("starting users stats persistence", "file", ur.file, "interval", interval)
+		for {
+			select {
+			case <-ticker.C:
+				if err := ur.save(); err != nil {
+					slog.Error("failed to save users stats", "file", ur.file, "error", err)
+				}
+			case <-ctx.Done():
+				if err := ur.save(); err != nil {
+					slog.Error("failed to save users stats", "file", ur.file, "error", err)
+				}
+				slog.Info("users stats persistence stopped")
+				return
+			}
+		}
+	}()
+
+	return done
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and renames it to the file name.
+func writeFileAtomic(fileName string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+
+	tmpName := f.Name()
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); closeErr != nil {
+		err = errors.Join(err, closeErr)
+	}
+
+	if err == nil {
+		err = os.Rename(tmpName, fileName)
+	}
+
+	if err != nil {
+		if removeErr := os.Remove(tmpName); removeErr != nil {
+			err = errors.Join(err, removeErr)
+		}
+		return fmt.Errorf("write file %q: %w", fileName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/smerge/cfg"
+)
+
+func TestHandleUsers(t *testing.T) {
+	var (
+		cr     = &mockCrawler{data: "test data"}
+		groups = map[string]*cfg.Group{"test": {Name: "test"}, "other": {Name: "other"}}
+		now    = time.Now()
+	)
+
+	users := newUserRegistry([]cfg.User{
+		{Name: "alice", Token: "alice12345", Groups: []string{"test"}},
+		{Name: "bob", Token: "bob1234567", Groups: []string{"test", "other"}, Disabled: true},
+		{Name: "carol", Token: "carol12345", Groups: []string{"test"}, Expires: now.Add(-time.Minute)},
+		{Name: "dave", Token: "dave123456", Groups: []string{"other"}, Expires: now.Add(time.Hour)},
+	}, "", "")
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := handleUsers(next, groups, users, nil, cr)
+
+	tests := []struct {
+		name         string
+		path         string
+		expectedCode int
+	}{
+		{name: "valid", path: "/u/alice12345/test", expectedCode: http.StatusOK},
+		{name: "valid with slash", path: "/u/dave123456/other/", expectedCode: http.StatusOK},
+		{name: "not allowed group", path: "/u/alice12345/other", expectedCode: http.StatusNotFound},
+		{name: "unknown group", path: "/u/alice12345/unknown", expectedCode: http.StatusNotFound},
+		{name: "unknown user", path: "/u/unknown123/test", expectedCode: http.StatusNotFound},
+		{name: "disabled user", path: "/u/bob1234567/test", expectedCode: http.StatusNotFound},
+		{name: "expired user", path: "/u/carol12345/test", expectedCode: http.StatusNotFound},
+		{name: "no group", path: "/u/alice12345", expectedCode: http.StatusNotFound},
+		{name: "other path", path: "/test", expectedCode: http.StatusTeapot},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.expectedCode {
+				t.Errorf("got status code %d, want %d", rec.Code, tc.expectedCode)
+			}
+		})
+	}
+
+	stats := users.Stats()
+	if n := len(stats); n != 2 {
+		t.Errorf("stats length = %d, want 2", n)
+	}
+
+	if s := stats["alice"]; s.Requests != 1 || s.LastIP != "192.0.2.1" || s.LastSeen.IsZero() {
+		t.Errorf("unexpected alice stats: %+v", s)
+	}
+}
+
+func TestUserRegistry_Update(t *testing.T) {
+	users := newUserRegistry([]cfg.User{{Name: "alice", Token: "alice12345"}}, "", "")
+	users.Visit("alice", "127.0.0.1", time.Now())
+
+	if _, ok := users.Lookup("alice12345"); !ok {
+		t.Fatal("user not found")
+	}
+
+	users.Update([]cfg.User{{Name: "bob", Token: "bob1234567"}})
+
+	if _, ok := users.Lookup("alice12345"); ok {
+		t.Error("removed user found")
+	}
+
+	if user, ok := users.Lookup("bob1234567"); !ok || user.Name != "bob" {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	if _, ok := users.Lookup(""); ok {
+		t.Error("user found by empty token")
+	}
+
+	if s := users.Stats()["alice"]; s.Requests != 1 {
+		t.Errorf("stats of removed user are lost: %+v", s)
+	}
+}
+
+func TestUserRegistry_Persist(t *testing.T) {
+	const statsFile = "stats.json"
+	var (
+		root  = t.TempDir()
+		users = []cfg.User{{Name: "alice", Token: "alice12345"}}
+		now   = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+
+	ur := newUserRegistry(users, root, statsFile)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := ur.Persist(ctx, time.Hour)
+
+	ur.Visit("alice", "127.0.0.1", now)
+	ur.Visit("alice", "127.0.0.2", now)
+
+	cancel()
+	<-done
+
+	if _, err := os.Stat(filepath.Join(root, statsFile)); err != nil {
+		t.Fatalf("stats file is not saved: %v", err)
+	}
+
+	loaded := newUserRegistry(users, root, statsFile)
+	ctx, cancel = context.WithCancel(context.Background())
+	done = loaded.Persist(ctx, time.Hour)
+
+	cancel()
+	<-done
+
+	expected := UserStats{Requests: 2, LastSeen: now, LastIP: "127.0.0.2"}
+	if s := loaded.Stats()["alice"]; s != expected {
+		t.Errorf("loaded stats = %+v, want %+v", s, expected)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(entries); n != 1 {
+		t.Errorf("unexpected files in root: %d", n)
+	}
+}
+
+func TestUserRegistry_PersistReloadedUsers(t *testing.T) {
+	const statsFile = "stats.json"
+	var (
+		root = t.TempDir()
+		now  = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+
+	// no users at startup, they are added by a configuration reload
+	ur := newUserRegistry(nil, root, statsFile)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := ur.Persist(ctx, time.Hour)
+
+	ur.Update([]cfg.User{{Name: "alice", Token: "alice12345"}})
+	ur.Visit("alice", "127.0.0.1", now)
+
+	cancel()
+	<-done
+
+	if _, err := os.Stat(filepath.Join(root, statsFile)); err != nil {
+		t.Errorf("stats file is not saved: %v", err)
+	}
+}
@@ -3,23 +3,44 @@ package server
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/z0rr0/smerge/cfg"
 )
 
 const (
 	// HTTP headers for IP address.
 	httpIPHeader       = "X-Real-IP"
 	httpIPForwardedFor = "X-Forwarded-For"
+	httpForwarded      = "Forwarded" // RFC 7239
+
+	// HTTP headers of incoming request IDs.
+	httpRequestID   = "X-Request-ID"
+	httpTraceParent = "traceparent" // W3C Trace Context
 
 	// requestIDLen is a length of generated request ID in bytes.
 	requestIDLen = 16
+	// maxRequestIDLen is a maximum length of accepted incoming request ID.
+	maxRequestIDLen = 128
+
+	// tokenParam is a query parameter name of access token.
+	tokenParam = "token"
+	// bearerPrefix is a prefix of access token in Authorization header.
+	bearerPrefix = "Bearer "
+	// unixPeerAddr is a client address of Unix socket connections without forwarded headers.
+	unixPeerAddr = "unix"
 )
 
 var (
@@ -30,8 +51,14 @@ var (
 // ctxKey is a type for context key.
 type ctxKey string
 
-// requestID is a key for request ID in a request context.
-const requestID ctxKey = "requestID"
+const (
+	// requestID is a key for request ID in a request context.
+	requestID ctxKey = "requestID"
+	// clientIP is a key for client IP address in a request context.
+	clientIP ctxKey = "clientIP"
+	// trustedProxy is a key for a flag that the connection remote address is a trusted proxy.
+	trustedProxy ctxKey = "trustedProxy"
+)
 
 // GetRequestID returns request ID from context.
 // The second return value indicates if the request ID was found.
@@ -55,6 +82,74 @@ func generateRequestID() string {
 	return hex.EncodeToString(bytes)
 }
 
+// incomingRequestID returns a valid request ID of "X-Request-ID" header
+// or a trace ID of W3C "traceparent" header, the first one has priority.
+func incomingRequestID(r *http.Request) (string, bool) {
+	if reqID := strings.TrimSpace(r.Header.Get(httpRequestID)); validRequestID(reqID) {
+		return reqID, true
+	}
+
+	return traceID(r.Header.Get(httpTraceParent))
+}
+
+// validRequestID returns true if the request ID is not empty, not too long
+// and contains only ASCII letters, digits and "-", "_", ".", ":" symbols, so it's safe for logs and headers.
+func validRequestID(reqID string) bool {
+	if reqID == "" || len(reqID) > maxRequestIDLen {
+		return false
+	}
+
+	for _, c := range []byte(reqID) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// traceID returns a trace ID of W3C "traceparent" header value "version-traceid-parentid-flags".
+func traceID(traceParent string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 {
+		return "", false
+	}
+
+	version, trace, parent, flags := parts[0], parts[1], parts[2], parts[3]
+	if !lowerHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return "", false
+	}
+
+	if !lowerHex(trace, 32) || !lowerHex(parent, 16) || !lowerHex(flags, 2) {
+		return "", false
+	}
+
+	if strings.Trim(trace, "0") == "" || strings.Trim(parent, "0") == "" {
+		// all zeros are invalid identifiers
+		return "", false
+	}
+
+	return trace, true
+}
+
+// lowerHex returns true if the value is a lowercase hex string of the length.
+func lowerHex(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+
+	for _, c := range []byte(value) {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
 // parseBool converts string value to boolean.
 // Accepted values: true, 1, yes, on, enabled, t, y.
 func parseBool(value string) bool {
@@ -63,24 +158,222 @@ func parseBool(value string) bool {
 	return ok
 }
 
-// remoteAddress returns remote address from request.
+// remoteAddress returns the client address of the request found by ClientIPMiddleware,
+// or the connection remote address if the middleware wasn't used.
 func remoteAddress(r *http.Request) string {
 	if r == nil {
 		return ""
 	}
 
-	if ra := r.Header.Get(httpIPForwardedFor); ra != "" {
-		return strings.SplitN(ra, ",", 2)[0]
+	if ip, ok := r.Context().Value(clientIP).(string); ok {
+		return ip
 	}
 
-	if ra := r.Header.Get(httpIPHeader); ra != "" {
-		return ra
+	return clientAddress(r, nil, false)
+}
+
+// isTrustedProxy returns true if the request was marked by ClientIPMiddleware as received from a trusted proxy.
+func isTrustedProxy(r *http.Request) bool {
+	trusted, _ := r.Context().Value(trustedProxy).(bool)
+	return trusted
+}
+
+// unixPeer returns true if the request is received by a Unix socket listener.
+// Such peer is a local process allowed by the socket file mode, it has no IP address.
+func unixPeer(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
+
+// trustedPeer returns true if the connection remote address belongs to trusted proxies
+// or the request is received by a Unix socket listener and its peers are trusted.
+func trustedPeer(r *http.Request, proxies []netip.Prefix, unixTrusted bool) bool {
+	if unixPeer(r) {
+		return unixTrusted
+	}
+
+	if len(proxies) == 0 {
+		return false
 	}
 
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
 	if err != nil {
-		slog.Error("failed to parse remote address", "error", err)
+		return false
+	}
+
+	return trustedAddr(addrPort.Addr().Unmap(), proxies)
+}
+
+// clientAddress returns the client address of the request.
+// Forwarded headers are used only if the connection remote address is a trusted proxy or a trusted Unix socket peer,
+// then the rightmost untrusted hop of "Forwarded" or "X-Forwarded-For" header or "X-Real-IP" value is returned.
+// A Unix socket connection without trusted forwarded headers has "unix" address.
+func clientAddress(r *http.Request, proxies []netip.Prefix, unixTrusted bool) string {
+	var host string
+
+	if unixPeer(r) {
+		if !unixTrusted {
+			return unixPeerAddr
+		}
+		host = unixPeerAddr
+	} else {
+		h, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			slog.Error("failed to parse remote address", "remote_addr", r.RemoteAddr, "error", err)
+			return h
+		}
+
+		addr, err := netip.ParseAddr(h)
+		if err != nil || !trustedAddr(addr.Unmap(), proxies) {
+			return h
+		}
+		host = addr.Unmap().String()
+	}
+
+	hops := forwardedHops(r.Header.Values(httpForwarded))
+	if len(hops) == 0 {
+		hops = forwardedForHops(r.Header.Values(httpIPForwardedFor))
+	}
+
+	if len(hops) == 0 {
+		if ip, ipErr := netip.ParseAddr(strings.TrimSpace(r.Header.Get(httpIPHeader))); ipErr == nil {
+			return ip.Unmap().String()
+		}
+		return host
+	}
+
+	// the connection address is a trusted proxy, so hops are checked from the nearest one
+	client := host
+	for _, hop := range slices.Backward(hops) {
+		ip, ipErr := netip.ParseAddr(hop)
+		if ipErr != nil {
+			// unknown or obfuscated identifier, the last known hop is used
+			break
+		}
+
+		ip = ip.Unmap()
+		client = ip.String()
+
+		if !trustedAddr(ip, proxies) {
+			break
+		}
+	}
+
+	return client
+}
+
+// trustedAddr returns true if the address belongs to one of trusted networks.
+func trustedAddr(addr netip.Addr, proxies []netip.Prefix) bool {
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedForHops returns addresses of "X-Forwarded-For" header values from the client to the last proxy.
+func forwardedForHops(values []string) []string {
+	var hops []string
+
+	for _, value := range values {
+		for hop := range strings.SplitSeq(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	return hops
+}
+
+// forwardedHops returns "for" node identifiers of RFC 7239 "Forwarded" header values
+// from the client to the last proxy, ports and IPv6 brackets are removed.
+func forwardedHops(values []string) []string {
+	var hops []string
+
+	for _, value := range values {
+		for element := range strings.SplitSeq(value, ",") {
+			for pair := range strings.SplitSeq(element, ";") {
+				key, node, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(key, "for") {
+					continue
+				}
+
+				node = strings.Trim(node, `"`)
+				if rest, ok := strings.CutPrefix(node, "["); ok {
+					node, _, _ = strings.Cut(rest, "]")
+				} else if h, _, splitErr := net.SplitHostPort(node); splitErr == nil {
+					node = h
+				}
+
+				hops = append(hops, node)
+			}
+		}
+	}
+
+	return hops
+}
+
+// requestToken returns an access token of the request.
+// The path token has priority, then Authorization header and query parameter are checked.
+func requestToken(r *http.Request, pathToken string) string {
+	if pathToken != "" {
+		return pathToken
+	}
+
+	if auth := r.Header.Get("Authorization"); len(auth) > len(bearerPrefix) &&
+		strings.EqualFold(auth[:len(bearerPrefix)], bearerPrefix) {
+		return strings.TrimSpace(auth[len(bearerPrefix):])
+	}
+
+	return r.URL.Query().Get(tokenParam)
+}
+
+// validToken checks that the token is one of allowed tokens.
+// Hashes of tokens are compared in constant time, so neither tokens nor their lengths are leaked.
+func validToken(token string, tokens []string) bool {
+	if token == "" {
+		return false
+	}
+
+	var (
+		valid int
+		hash  = sha256.Sum256([]byte(token))
+	)
+
+	for _, t := range tokens {
+		allowed := sha256.Sum256([]byte(t))
+		valid |= subtle.ConstantTimeCompare(hash[:], allowed[:])
+	}
+
+	return valid == 1
+}
+
+// redactPath returns the URL path with hidden access token of a user's personal endpoint "/u/{token}/{endpoint}"
+// or a group endpoint "/{endpoint}/{token}", other paths are returned as is.
+func redactPath(path string, groups map[string]*cfg.Group) string {
+	if rest, ok := strings.CutPrefix(path, usersPrefix); ok && rest != "" {
+		if _, endpoint, found := strings.Cut(rest, "/"); found {
+			return usersPrefix + "***/" + endpoint
+		}
+		return usersPrefix + "***"
+	}
+
+	if _, token, ok := lookupGroup(groups, path); ok && token != "" {
+		return "/" + strings.TrimSuffix(strings.Trim(path, "/ "), token) + "***"
+	}
+
+	return path
+}
+
+// redactQuery returns the raw query of URL with hidden access token.
+func redactQuery(u *url.URL) string {
+	query := u.Query()
+	if !query.Has(tokenParam) {
+		return u.RawQuery
 	}
 
-	return host
+	query.Set(tokenParam, "***")
+	return query.Encode()
 }
@@ -2,9 +2,15 @@ package server
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
 	"testing"
+
+	"github.com/z0rr0/smerge/cfg"
 )
 
 func TestGetRequestID(t *testing.T) {
@@ -62,6 +68,99 @@ func TestRequestID(t *testing.T) {
 	}
 }
 
+func TestIncomingRequestID(t *testing.T) {
+	tests := []struct {
+		name        string
+		requestID   string
+		traceParent string
+		expected    string
+		ok          bool
+	}{
+		{name: "empty"},
+		{name: "request ID", requestID: " abc-123_x.y:z ", expected: "abc-123_x.y:z", ok: true},
+		{name: "too long request ID", requestID: strings.Repeat("a", maxRequestIDLen+1)},
+		{name: "invalid symbols", requestID: "abc/123"},
+		{
+			name:        "traceparent",
+			traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			expected:    "4bf92f3577b34da6a3ce929d0e0e4736",
+			ok:          true,
+		},
+		{
+			name:        "future traceparent version",
+			traceParent: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			expected:    "4bf92f3577b34da6a3ce929d0e0e4736",
+			ok:          true,
+		},
+		{name: "extra fields of version 00", traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-x"},
+		{name: "invalid version", traceParent: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "uppercase trace ID", traceParent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{name: "zero trace ID", traceParent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "zero parent ID", traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{name: "short", traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-01"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.requestID != "" {
+				req.Header.Set(httpRequestID, tc.requestID)
+			}
+			if tc.traceParent != "" {
+				req.Header.Set(httpTraceParent, tc.traceParent)
+			}
+
+			reqID, ok := incomingRequestID(req)
+			if reqID != tc.expected || ok != tc.ok {
+				t.Errorf("got %q, %v, want %q, %v", reqID, ok, tc.expected, tc.ok)
+			}
+		})
+	}
+}
+
+func TestTrustedPeer(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+	tests := []struct {
+		remoteAddr string
+		proxies    []netip.Prefix
+		expected   bool
+	}{
+		{remoteAddr: "10.1.2.3:1234", proxies: proxies, expected: true},
+		{remoteAddr: "[::1]:1234", proxies: proxies, expected: true},
+		{remoteAddr: "[::ffff:10.1.2.3]:1234", proxies: proxies, expected: true},
+		{remoteAddr: "192.168.1.1:1234", proxies: proxies},
+		{remoteAddr: "10.1.2.3:1234"},
+		{remoteAddr: "invalid", proxies: proxies},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+
+		if trusted := trustedPeer(req, tc.proxies, false); trusted != tc.expected {
+			t.Errorf("remote address %q: got %v, want %v", tc.remoteAddr, trusted, tc.expected)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "@"
+
+	if !trustedPeer(withUnixListener(req), nil, true) {
+		t.Error("unix socket peer is not trusted")
+	}
+
+	if trustedPeer(withUnixListener(req), proxies, false) {
+		t.Error("unix socket peer is trusted without the option")
+	}
+}
+
+// withUnixListener returns the request received by a Unix socket listener.
+func withUnixListener(r *http.Request) *http.Request {
+	addr := &net.UnixAddr{Name: "/run/smerge.sock", Net: "unix"}
+	return r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, addr))
+}
+
 func TestParseBool(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -99,84 +198,276 @@ func TestParseBool(t *testing.T) {
 }
 
 func TestRemoteAddress(t *testing.T) {
+	if got := remoteAddress(nil); got != "" {
+		t.Errorf("got %q for nil request", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.168.1.2:1234"
+	req.Header.Set(httpIPForwardedFor, "192.168.1.1")
+
+	if got := remoteAddress(req); got != "192.168.1.2" {
+		t.Errorf("got %q without middleware, want 192.168.1.2", got)
+	}
+
+	var got string
+	handler := ClientIPMiddleware(
+		http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { got = remoteAddress(r) }),
+		[]netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")},
+		false,
+	)
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "192.168.1.1" {
+		t.Errorf("got %q with middleware, want 192.168.1.1", got)
+	}
+}
+
+func TestClientAddress(t *testing.T) {
+	proxies := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("127.0.0.1/32"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
 	tests := []struct {
-		name        string
-		request     *http.Request
-		withHeader  bool
-		withForward bool
-		header      string
-		remoteAddr  string
-		expected    string
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		proxies    []netip.Prefix
+		unix       bool // the request is received by a Unix socket listener
+		trustUnix  bool
+		expected   string
 	}{
+		{name: "no header", remoteAddr: "192.168.1.2:1234", proxies: proxies, expected: "192.168.1.2"},
 		{
-			name:       "nil request",
-			header:     "192.168.1.1",
-			remoteAddr: "192.168.1.2:1234",
-			expected:   "",
+			name:       "IP v6",
+			remoteAddr: "[2a00:1370:8174:5308:3075:623b:a456:2891]:1234",
+			proxies:    proxies,
+			expected:   "2a00:1370:8174:5308:3075:623b:a456:2891",
 		},
+		{name: "invalid remote address", remoteAddr: "192.168.1.2", proxies: proxies, expected: ""},
 		{
-			name:       "with header",
-			request:    httptest.NewRequest("GET", "/", nil),
-			withHeader: true,
-			header:     "192.168.1.1",
+			name:       "untrusted forwarded for",
 			remoteAddr: "192.168.1.2:1234",
-			expected:   "192.168.1.1",
+			headers:    map[string][]string{httpIPForwardedFor: {"127.0.0.1"}},
+			proxies:    proxies,
+			expected:   "192.168.1.2",
 		},
 		{
-			name:       "no header",
-			request:    httptest.NewRequest("GET", "/", nil),
+			name:       "untrusted real IP",
 			remoteAddr: "192.168.1.2:1234",
+			headers:    map[string][]string{httpIPHeader: {"127.0.0.1"}},
+			proxies:    proxies,
 			expected:   "192.168.1.2",
 		},
 		{
-			name:       "empty header",
-			request:    httptest.NewRequest("GET", "/", nil),
-			withHeader: true,
-			header:     "",
-			remoteAddr: "192.168.1.2:1234",
-			expected:   "192.168.1.2",
+			name:       "no proxies",
+			remoteAddr: "127.0.0.1:1234",
+			headers:    map[string][]string{httpIPForwardedFor: {"192.168.1.1"}},
+			expected:   "127.0.0.1",
 		},
 		{
-			name:        "with forward header",
-			request:     httptest.NewRequest("GET", "/", nil),
-			withForward: true,
-			header:      "192.168.1.1",
-			remoteAddr:  "192.168.1.2:1234",
-			expected:    "192.168.1.1",
+			name:       "trusted forwarded for",
+			remoteAddr: "127.0.0.1:1234",
+			headers:    map[string][]string{httpIPForwardedFor: {"192.168.1.1"}},
+			proxies:    proxies,
+			expected:   "192.168.1.1",
 		},
 		{
-			name:       "IP v6",
-			request:    httptest.NewRequest("GET", "/", nil),
-			remoteAddr: "[2a00:1370:8174:5308:3075:623b:a456:2891]:1234",
-			expected:   "2a00:1370:8174:5308:3075:623b:a456:2891",
+			name:       "forged forwarded for",
+			remoteAddr: "127.0.0.1:1234",
+			headers:    map[string][]string{httpIPForwardedFor: {"127.0.0.1, 192.168.1.1", "10.1.2.3"}},
+			proxies:    proxies,
+			expected:   "192.168.1.1",
+		},
+		{
+			name:       "all trusted",
+			remoteAddr: "127.0.0.1:1234",
+			headers:    map[string][]string{httpIPForwardedFor: {"10.0.0.2, 10.0.0.3"}},
+			proxies:    proxies,
+			expected:   "10.0.0.2",
 		},
 		{
-			name:        "IP v6 with header",
-			request:     httptest.NewRequest("GET", "/", nil),
-			withForward: true,
-			header:      "2a00:1370:8174:5308:3075:623b:a456:2891",
-			remoteAddr:  "[2a00:1370:8174:5308:3075:623b:a456:2891]:1234",
-			expected:    "2a00:1370:8174:5308:3075:623b:a456:2891",
+			name:       "invalid hop",
+			remoteAddr: "127.0.0.1:1234",
+			headers:    map[string][]string{httpIPForwardedFor: {"192.168.1.1, unknown, 10.0.0.3"}},
+			proxies:    proxies,
+			expected:   "10.0.0.3",
+		},
+		{
+			name:       "trusted real IP",
+			remoteAddr: "127.0.0.1:1234",
+			headers:    map[string][]string{httpIPHeader: {"192.168.1.1"}},
+			proxies:    proxies,
+			expected:   "192.168.1.1",
+		},
+		{
+			name:       "invalid real IP",
+			remoteAddr: "127.0.0.1:1234",
+			headers:    map[string][]string{httpIPHeader: {"unknown"}},
+			proxies:    proxies,
+			expected:   "127.0.0.1",
+		},
+		{
+			name:       "forwarded",
+			remoteAddr: "[fd00::1]:1234",
+			headers: map[string][]string{
+				httpForwarded:      {`for=192.0.2.60;proto=http;by=203.0.113.43, For="[2001:db8:cafe::17]:4711"`},
+				httpIPForwardedFor: {"192.168.1.1"},
+			},
+			proxies:  proxies,
+			expected: "2001:db8:cafe::17",
+		},
+		{
+			name:       "forwarded with port",
+			remoteAddr: "127.0.0.1:1234",
+			headers:    map[string][]string{httpForwarded: {`for="192.0.2.60:8080"`, "for=10.0.0.5"}},
+			proxies:    proxies,
+			expected:   "192.0.2.60",
+		},
+		{
+			name:       "mapped address",
+			remoteAddr: "[::ffff:127.0.0.1]:1234",
+			headers:    map[string][]string{httpIPForwardedFor: {"::ffff:192.168.1.1"}},
+			proxies:    proxies,
+			expected:   "192.168.1.1",
+		},
+		{name: "unix socket", remoteAddr: "@", unix: true, trustUnix: true, expected: unixPeerAddr},
+		{
+			name:       "unix socket forwarded for",
+			remoteAddr: "@",
+			headers:    map[string][]string{httpIPForwardedFor: {"192.168.1.1"}},
+			unix:       true,
+			trustUnix:  true,
+			expected:   "192.168.1.1",
+		},
+		{
+			name:       "untrusted unix socket forwarded for",
+			remoteAddr: "@",
+			headers:    map[string][]string{httpIPForwardedFor: {"192.168.1.1"}},
+			proxies:    proxies,
+			unix:       true,
+			expected:   unixPeerAddr,
+		},
+		{
+			name:       "unix socket trusted hops",
+			remoteAddr: "",
+			headers:    map[string][]string{httpIPForwardedFor: {"192.168.1.1, 10.0.0.3"}},
+			proxies:    proxies,
+			unix:       true,
+			trustUnix:  true,
+			expected:   "192.168.1.1",
+		},
+		{
+			name:       "unix socket real IP",
+			remoteAddr: "@",
+			headers:    map[string][]string{httpIPHeader: {"192.168.1.1"}},
+			unix:       true,
+			trustUnix:  true,
+			expected:   "192.168.1.1",
 		},
 	}
 
 	for _, tc := range tests {
-
 		t.Run(tc.name, func(t *testing.T) {
-			if tc.request != nil {
-				if tc.withHeader {
-					tc.request.Header.Set(httpIPHeader, tc.header)
-				}
-				if tc.withForward {
-					tc.request.Header.Set(httpIPForwardedFor, tc.header)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+
+			if tc.unix {
+				req = withUnixListener(req)
+			}
+
+			for name, values := range tc.headers {
+				for _, value := range values {
+					req.Header.Add(name, value)
 				}
+			}
 
-				tc.request.RemoteAddr = tc.remoteAddr
+			if got := clientAddress(req, tc.proxies, tc.trustUnix); got != tc.expected {
+				t.Errorf("got %q, want %q", got, tc.expected)
 			}
+		})
+	}
+}
 
-			if got := remoteAddress(tc.request); got != tc.expected {
-				t.Errorf("got %v, expected %v", got, tc.expected)
+func TestValidToken(t *testing.T) {
+	tokens := []string{"token12345", "other12345"}
+
+	tests := []struct {
+		name   string
+		token  string
+		tokens []string
+		want   bool
+	}{
+		{name: "valid", token: "token12345", tokens: tokens, want: true},
+		{name: "valid second", token: "other12345", tokens: tokens, want: true},
+		{name: "invalid", token: "token1234", tokens: tokens},
+		{name: "empty", tokens: tokens},
+		{name: "no tokens", token: "token12345"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := validToken(tc.token, tc.tokens); got != tc.want {
+				t.Errorf("validToken() = %v, want %v", got, tc.want)
 			}
 		})
 	}
 }
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "no token", query: "force=1&decode=0", want: "force=1&decode=0"},
+		{name: "token", query: "force=1&token=secret", want: "force=1&token=%2A%2A%2A"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &url.URL{Path: "/group", RawQuery: tc.query}
+			if got := redactQuery(u); got != tc.want {
+				t.Errorf("redactQuery() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRedactPath(t *testing.T) {
+	groups := map[string]*cfg.Group{
+		"group1":     {Name: "group1", Endpoint: "group1"},
+		"nested/sub": {Name: "nested", Endpoint: "nested/sub"},
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "root", path: "/", want: "/"},
+		{name: "group", path: "/group1", want: "/group1"},
+		{name: "group slash", path: "/group1/", want: "/group1/"},
+		{name: "group token", path: "/group1/secret12345", want: "/group1/***"},
+		{name: "group token slash", path: "/group1/secret12345/", want: "/group1/***"},
+		{name: "nested group token", path: "/nested/sub/secret12345", want: "/nested/sub/***"},
+		{name: "unknown", path: "/unknown/secret12345", want: "/unknown/secret12345"},
+		{name: "user", path: "/u/secret12345/group1", want: "/u/***/group1"},
+		{name: "user without endpoint", path: "/u/secret12345", want: "/u/***"},
+		{name: "users prefix", path: "/u/", want: "/u/"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := redactPath(tc.path, groups); got != tc.want {
+				t.Errorf("redactPath() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	if got := redactPath("/group1/secret12345", nil); got != "/group1/secret12345" {
+		t.Errorf("redactPath() without groups = %q", got)
+	}
+}
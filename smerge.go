@@ -12,6 +12,7 @@ import (
 	_ "time/tzdata"
 
 	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/logfile"
 	"github.com/z0rr0/smerge/server"
 )
 
@@ -60,20 +61,48 @@ func main() {
 		os.Exit(1)
 	}
 
+	output, err := logOutput(&config.Log)
+	if err != nil {
+		slog.Error("failed to open log output", "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		if closeErr := output.Close(); closeErr != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to close log output: %v\n", closeErr)
+		}
+	}()
+
 	dev = dev || config.Debug
-	initLogger(dev, os.Stdout)
+	initLogger(&config.Log, dev, output)
 	slog.Info(name, "version", Version, "revision", Revision, "go", GoVersion, "build", BuildDate, "dev", dev)
 
 	server.Run(config, versionInfo, os.Interrupt, os.Signal(syscall.SIGTERM), os.Signal(syscall.SIGQUIT))
 	slog.Info("stopped")
 }
 
-// initLogger initializes logger with debug mode and writer.
-func initLogger(dev bool, w io.Writer) {
-	var level = slog.LevelInfo
-	if dev {
-		level = slog.LevelDebug
+// initLogger initializes logger with its options, debug mode and writer.
+// The debug mode sets the debug level if the level is not set in the options.
+func initLogger(options *cfg.LogOptions, dev bool, w io.Writer) {
+	var (
+		handler     slog.Handler
+		handlerOpts = &slog.HandlerOptions{Level: options.SlogLevel(dev)}
+	)
+
+	if options.Format == cfg.LogJSON {
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	} else {
+		handler = slog.NewTextHandler(w, handlerOpts)
 	}
 
-	slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})))
+	slog.SetDefault(slog.New(handler))
+}
+
+// logOutput returns a writer of logs, it's a standard output or a rotated log file.
+func logOutput(options *cfg.LogOptions) (io.WriteCloser, error) {
+	return logfile.Open(
+		options.Output,
+		logfile.WithMaxSize(int64(options.MaxSize)<<20),
+		logfile.WithMaxAge(options.MaxAge.Timed()),
+		logfile.WithMaxBackups(int(options.MaxBackups)),
+	)
 }
@@ -6,25 +6,43 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/z0rr0/smerge/cfg"
+	"github.com/z0rr0/smerge/logfile"
 )
 
 func TestInitLogger(t *testing.T) {
 	tests := []struct {
 		name     string
+		options  cfg.LogOptions
 		debug    bool
-		wantText string
+		expected []string
+		missing  []string
 	}{
 		{
 			name:     "debug mode",
 			debug:    true,
-			wantText: "DEBUG",
+			expected: []string{"level=DEBUG msg=\"debug message\"", "level=INFO msg=\"info message\""},
 		},
 		{
 			name:     "info mode",
-			debug:    false,
-			wantText: "INFO",
+			expected: []string{"level=INFO msg=\"info message\""},
+			missing:  []string{"debug message"},
+		},
+		{
+			name:     "level is independent of debug",
+			options:  cfg.LogOptions{Level: "warn"},
+			debug:    true,
+			expected: []string{"level=WARN msg=\"warn message\""},
+			missing:  []string{"debug message", "info message"},
+		},
+		{
+			name:     "json format",
+			options:  cfg.LogOptions{Format: cfg.LogJSON, Level: "debug"},
+			expected: []string{`"level":"DEBUG","msg":"debug message"`, `"level":"WARN","msg":"warn message"`},
 		},
 	}
 
@@ -32,26 +50,64 @@ func TestInitLogger(t *testing.T) {
 		tc := tests[i]
 		t.Run(tc.name, func(t *testing.T) {
 			var buf bytes.Buffer
-			initLogger(tc.debug, &buf)
+			initLogger(&tc.options, tc.debug, &buf)
 
 			slog.Debug("debug message")
 			slog.Info("info message")
+			slog.Warn("warn message")
 
 			output := buf.String()
-			if tc.debug {
-				if !strings.Contains(output, "debug message") {
-					t.Errorf("debug message not found in debug mode: %q", output)
+			for _, expected := range tc.expected {
+				if !strings.Contains(output, expected) {
+					t.Errorf("%q not found: %q", expected, output)
 				}
-				return
 			}
 
-			if strings.Contains(output, "debug message") {
-				t.Errorf("debug message found in info mode")
+			for _, missing := range tc.missing {
+				if strings.Contains(output, missing) {
+					t.Errorf("%q found: %q", missing, output)
+				}
 			}
 		})
 	}
 }
 
+func TestLogOutput(t *testing.T) {
+	for _, output := range []string{"", cfg.LogStdout, cfg.LogStderr} {
+		w, err := logOutput(&cfg.LogOptions{Output: output})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := w.(*logfile.Writer); ok {
+			t.Errorf("unexpected file writer for %q", output)
+		}
+	}
+
+	name := filepath.Join(t.TempDir(), "smerge.log")
+	w, err := logOutput(&cfg.LogOptions{Output: name, MaxSize: 1, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = w.Write([]byte("message\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "message\n" {
+		t.Errorf("unexpected log file content %q", data)
+	}
+}
+
 func TestMainVersion(t *testing.T) {
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()